@@ -5,6 +5,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/ProtocolONE/rain/internal/banlist"
 	"github.com/ProtocolONE/rain/internal/blocklist"
 	"github.com/ProtocolONE/rain/internal/externalip"
 	"github.com/ProtocolONE/rain/internal/peerpriority"
@@ -21,11 +22,12 @@ type AddrList struct {
 	listenPort int
 	clientIP   *net.IP
 	blocklist  *blocklist.Blocklist
+	banlist    *banlist.BanList
 
 	countBySource map[peersource.Source]int
 }
 
-func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP *net.IP) *AddrList {
+func New(maxItems int, blocklist *blocklist.Blocklist, banlist *banlist.BanList, listenPort int, clientIP *net.IP) *AddrList {
 	return &AddrList{
 		peerByPriority: btree.New(2),
 
@@ -33,6 +35,7 @@ func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP
 		listenPort:    listenPort,
 		clientIP:      clientIP,
 		blocklist:     blocklist,
+		banlist:       banlist,
 		countBySource: make(map[peersource.Source]int),
 	}
 }
@@ -43,6 +46,19 @@ func (d *AddrList) Reset() {
 	d.countBySource = make(map[peersource.Source]int)
 }
 
+// SetMaxItems changes the maximum number of addresses in the list.
+// Oldest addresses are removed if the list is longer than maxItems.
+func (d *AddrList) SetMaxItems(maxItems int) {
+	d.maxItems = maxItems
+	delta := d.peerByPriority.Len() - d.maxItems
+	if delta > 0 {
+		// Popped items leave nil holes in peerByTime.
+		d.filterNils()
+		d.removeExcessItems(delta)
+		d.filterNils()
+	}
+}
+
 func (d *AddrList) Len() int {
 	return d.peerByPriority.Len()
 }
@@ -82,6 +98,9 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 		if d.blocklist != nil && d.blocklist.Blocked(ad.IP) {
 			continue
 		}
+		if d.banlist != nil && d.banlist.Banned(ad.IP) {
+			continue
+		}
 		p := &peerAddr{
 			addr:      ad,
 			timestamp: now,
@@ -108,7 +127,6 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 	if delta > 0 {
 		d.removeExcessItems(delta)
 		d.filterNils()
-		d.countBySource[source] -= delta
 	}
 	if len(d.peerByTime) != d.peerByPriority.Len() {
 		panic("addr list data structures not in sync")
@@ -128,7 +146,9 @@ func (d *AddrList) filterNils() {
 
 func (d *AddrList) removeExcessItems(delta int) {
 	for i := 0; i < delta; i++ {
-		d.peerByPriority.Delete(d.peerByTime[i])
+		p := d.peerByTime[i]
+		d.peerByPriority.Delete(p)
+		d.countBySource[p.source]--
 		d.peerByTime[i] = nil
 	}
 }
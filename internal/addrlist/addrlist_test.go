@@ -10,7 +10,7 @@ import (
 
 func TestAddrList(t *testing.T) {
 	clientIP := net.IPv4(1, 2, 3, 4)
-	al := New(2, nil, 5000, &clientIP)
+	al := New(2, nil, nil, 5000, &clientIP)
 
 	// Push 1st addr
 	al.Push([]*net.TCPAddr{newAddr("1.1.1.1")}, peersource.Tracker)
@@ -51,6 +51,16 @@ func TestAddrList(t *testing.T) {
 	assert.Equal(t, al.peerByPriority.Len(), 2)
 	assert.Equal(t, al.peerByTime[0].index, 0)
 	assert.Equal(t, al.peerByTime[1].index, 1)
+
+	// Pop an addr and shrink list
+	al.Pop()
+	al.Push([]*net.TCPAddr{newAddr("5.5.5.5")}, peersource.DHT)
+	al.SetMaxItems(1)
+	assert.Equal(t, len(al.peerByTime), 1)
+	assert.Equal(t, al.peerByPriority.Len(), 1)
+	assert.Equal(t, al.peerByTime[0].index, 0)
+	assert.Equal(t, al.LenSource(peersource.Tracker), 0)
+	assert.Equal(t, al.LenSource(peersource.DHT), 1)
 }
 
 func newAddr(ip string) *net.TCPAddr {
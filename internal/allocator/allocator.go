@@ -37,6 +37,12 @@ func (a *Allocator) Close() {
 	<-a.doneC
 }
 
+// Closing returns a channel that is closed when Close is called.
+// Work done before Run can stop early by watching it.
+func (a *Allocator) Closing() <-chan struct{} {
+	return a.closeC
+}
+
 func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan Progress, resultC chan *Allocator) {
 	defer close(a.doneC)
 
@@ -54,6 +60,12 @@ func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan
 		}
 	}()
 
+	select {
+	case <-a.closeC:
+		return
+	default:
+	}
+
 	var allocatedSize int64
 
 	// Single file in torrent
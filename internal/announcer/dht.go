@@ -10,6 +10,7 @@ type DHTAnnouncer struct {
 	lastAnnounce   time.Time
 	needMorePeers  bool
 	needMorePeersC chan bool
+	intervalsC     chan dhtIntervals
 	closeC         chan struct{}
 	doneC          chan struct{}
 }
@@ -17,6 +18,7 @@ type DHTAnnouncer struct {
 func NewDHTAnnouncer() *DHTAnnouncer {
 	return &DHTAnnouncer{
 		needMorePeersC: make(chan bool),
+		intervalsC:     make(chan dhtIntervals),
 		closeC:         make(chan struct{}),
 		doneC:          make(chan struct{}),
 	}
@@ -34,6 +36,18 @@ func (a *DHTAnnouncer) NeedMorePeers(val bool) {
 	}
 }
 
+type dhtIntervals struct {
+	interval, minInterval time.Duration
+}
+
+// SetIntervals changes the announce intervals given to Run.
+func (a *DHTAnnouncer) SetIntervals(interval, minInterval time.Duration) {
+	select {
+	case a.intervalsC <- dhtIntervals{interval: interval, minInterval: minInterval}:
+	case <-a.doneC:
+	}
+}
+
 func (a *DHTAnnouncer) Run(announceFunc func(), interval, minInterval time.Duration, l logger.Logger) {
 	defer close(a.doneC)
 
@@ -61,6 +75,9 @@ func (a *DHTAnnouncer) Run(announceFunc func(), interval, minInterval time.Durat
 			announce()
 		case a.needMorePeers = <-a.needMorePeersC:
 			resetTimer()
+		case iv := <-a.intervalsC:
+			interval, minInterval = iv.interval, iv.minInterval
+			resetTimer()
 		case <-a.closeC:
 			return
 		}
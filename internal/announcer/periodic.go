@@ -26,6 +26,7 @@ type PeriodicalAnnouncer struct {
 	Tracker       tracker.Tracker
 	status        Status
 	statsCommandC chan statsRequest
+	configC       chan periodicalConfig
 	numWant       int
 	interval      time.Duration
 	minInterval   time.Duration
@@ -37,6 +38,7 @@ type PeriodicalAnnouncer struct {
 	newPeers      chan []*net.TCPAddr
 	backoff       backoff.BackOff
 	getTorrent    func() tracker.Torrent
+	onError       func(error)
 	lastAnnounce  time.Time
 	HasAnnounced  bool
 	responseC     chan *tracker.AnnounceResponse
@@ -49,17 +51,21 @@ type PeriodicalAnnouncer struct {
 	needMorePeersC chan struct{}
 }
 
-func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, newPeers chan []*net.TCPAddr, l logger.Logger) *PeriodicalAnnouncer {
+// NewPeriodicalAnnouncer returns a new PeriodicalAnnouncer.
+// If onError is not nil, it is called from the announcer goroutine when an announce fails.
+func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, newPeers chan []*net.TCPAddr, onError func(error), l logger.Logger) *PeriodicalAnnouncer {
 	return &PeriodicalAnnouncer{
 		Tracker:        trk,
 		status:         NotContactedYet,
 		statsCommandC:  make(chan statsRequest),
+		configC:        make(chan periodicalConfig),
 		numWant:        numWant,
 		minInterval:    minInterval,
 		log:            l,
 		completedC:     completedC,
 		newPeers:       newPeers,
 		getTorrent:     getTorrent,
+		onError:        onError,
 		needMorePeersC: make(chan struct{}, 1),
 		responseC:      make(chan *tracker.AnnounceResponse),
 		errC:           make(chan error),
@@ -99,6 +105,20 @@ func (a *PeriodicalAnnouncer) Stats() Stats {
 	return stats
 }
 
+type periodicalConfig struct {
+	numWant     int
+	minInterval time.Duration
+}
+
+// SetConfig changes the number of peers requested from tracker and the minimum announce interval.
+// Interval returned from tracker in following announces overrides minInterval.
+func (a *PeriodicalAnnouncer) SetConfig(numWant int, minInterval time.Duration) {
+	select {
+	case a.configC <- periodicalConfig{numWant: numWant, minInterval: minInterval}:
+	case <-a.doneC:
+	}
+}
+
 func (a *PeriodicalAnnouncer) NeedMorePeers(val bool) {
 	a.mNeedMorePeers.Lock()
 	a.needMorePeers = val
@@ -158,6 +178,9 @@ func (a *PeriodicalAnnouncer) Run() {
 				a.lastError = errors.New("timeout")
 			}
 			a.log.Debugln("announce error:", a.lastError)
+			if a.onError != nil {
+				a.onError(a.lastError)
+			}
 			if terr, ok := a.lastError.(*tracker.Error); ok && terr.RetryIn > 0 {
 				timer.Reset(terr.RetryIn)
 			} else {
@@ -184,6 +207,9 @@ func (a *PeriodicalAnnouncer) Run() {
 			a.completedC = nil // do not send more than one "completed" event
 		case req := <-a.statsCommandC:
 			req.Response <- a.stats()
+		case cfg := <-a.configC:
+			a.numWant = cfg.numWant
+			a.minInterval = cfg.minInterval
 		case <-a.closeC:
 			return
 		}
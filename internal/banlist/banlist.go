@@ -0,0 +1,91 @@
+package banlist
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ban prevents connecting to a peer IP until it expires.
+type Ban struct {
+	IP        net.IP
+	Reason    string
+	CreatedAt time.Time
+	// Zero value means the ban never expires.
+	ExpiresAt time.Time
+}
+
+// Expired returns true if the ban is not effective at time t.
+func (b Ban) Expired(t time.Time) bool {
+	return !b.ExpiresAt.IsZero() && !t.Before(b.ExpiresAt)
+}
+
+// BanList is a set of banned peer IPs that is safe for concurrent use.
+type BanList struct {
+	m    sync.RWMutex
+	bans map[string]Ban
+}
+
+func New() *BanList {
+	return &BanList{
+		bans: make(map[string]Ban),
+	}
+}
+
+// Add bans the IP in b. Existing ban of the same IP is replaced.
+func (l *BanList) Add(b Ban) {
+	l.m.Lock()
+	l.bans[key(b.IP)] = b
+	l.m.Unlock()
+}
+
+// Remove lifts the ban on ip. Returns false if ip is not banned.
+func (l *BanList) Remove(ip net.IP) bool {
+	k := key(ip)
+	l.m.Lock()
+	defer l.m.Unlock()
+	_, ok := l.bans[k]
+	delete(l.bans, k)
+	return ok
+}
+
+// Banned returns true if there is an effective ban on ip.
+func (l *BanList) Banned(ip net.IP) bool {
+	l.m.RLock()
+	b, ok := l.bans[key(ip)]
+	l.m.RUnlock()
+	return ok && !b.Expired(time.Now())
+}
+
+// List returns effective bans sorted by creation time. Expired bans are removed from the list.
+func (l *BanList) List() []Ban {
+	now := time.Now()
+	l.m.Lock()
+	ret := make([]Ban, 0, len(l.bans))
+	for k, b := range l.bans {
+		if b.Expired(now) {
+			delete(l.bans, k)
+			continue
+		}
+		ret = append(ret, b)
+	}
+	l.m.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].CreatedAt.Before(ret[j].CreatedAt) })
+	return ret
+}
+
+// Len returns the number of bans including the expired ones that are not removed yet.
+func (l *BanList) Len() int {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return len(l.bans)
+}
+
+// key normalizes IPv4 addresses that may be in 16 byte form.
+func key(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return string(ip)
+}
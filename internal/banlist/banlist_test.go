@@ -0,0 +1,39 @@
+package banlist
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBanList(t *testing.T) {
+	l := New()
+	ip := net.ParseIP("1.2.3.4")
+	assert.False(t, l.Banned(ip))
+
+	l.Add(Ban{IP: ip, Reason: "test", CreatedAt: time.Now()})
+	assert.True(t, l.Banned(ip))
+	assert.True(t, l.Banned(net.IPv4(1, 2, 3, 4).To4()))
+	assert.False(t, l.Banned(net.ParseIP("1.2.3.5")))
+	assert.Len(t, l.List(), 1)
+
+	assert.True(t, l.Remove(ip))
+	assert.False(t, l.Remove(ip))
+	assert.False(t, l.Banned(ip))
+}
+
+func TestBanExpiry(t *testing.T) {
+	l := New()
+	ip := net.ParseIP("1.2.3.4")
+	now := time.Now()
+	l.Add(Ban{IP: ip, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)})
+	assert.False(t, l.Banned(ip))
+	assert.Equal(t, 1, l.Len())
+	assert.Empty(t, l.List())
+	assert.Equal(t, 0, l.Len())
+
+	l.Add(Ban{IP: ip, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	assert.True(t, l.Banned(ip))
+}
@@ -16,6 +16,7 @@ func Accept(
 	getSKey func(sKeyHash [20]byte) (sKey []byte),
 	forceEncryption bool,
 	hasInfoHash func([20]byte) bool,
+	isBanned func(net.IP) bool,
 	ourExtensions [8]byte, ourID [20]byte) (
 	encConn net.Conn, cipher mse.CryptoMethod, peerExtensions [8]byte, peerID [20]byte, infoHash [20]byte, err error) {
 
@@ -25,6 +26,11 @@ func Accept(
 		panic("forceEncryption && getSKey == nil")
 	}
 
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && isBanned != nil && isBanned(tcpAddr.IP) {
+		err = errBanned
+		return
+	}
+
 	if err = conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
 		return
 	}
@@ -10,17 +10,28 @@ import (
 	"github.com/ProtocolONE/rain/internal/mse"
 )
 
+// Dial connects to addr and does the BitTorrent handshake.
+// If localAddr is not nil, the connection is made from localAddr.
+// It may be the address of a listener created with ListenReusePort.
 func Dial(
 	addr net.Addr,
+	localAddr *net.TCPAddr,
 	dialTimeout, handshakeTimeout time.Duration,
 	enableEncryption,
 	forceEncryption bool,
 	ourExtensions [8]byte,
 	ih [20]byte,
 	ourID [20]byte,
+	isBanned func(net.IP) bool,
 	stopC chan struct{}) (
 	conn net.Conn, cipher mse.CryptoMethod, peerExtensions [8]byte, peerID [20]byte, err error) {
 
+	// Ban may be added after the address is queued for dialing.
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && isBanned != nil && isBanned(tcpAddr.IP) {
+		err = errBanned
+		return
+	}
+
 	log := logger.New("conn -> " + addr.String())
 	done := make(chan struct{})
 	defer close(done)
@@ -37,6 +48,10 @@ func Dial(
 	// First connection
 	log.Debug("Connecting to peer...")
 	dialer := net.Dialer{Timeout: dialTimeout}
+	if localAddr != nil {
+		dialer.LocalAddr = localAddr
+		dialer.Control = reusePort
+	}
 	conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
 	if err != nil {
 		return
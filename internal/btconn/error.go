@@ -5,6 +5,7 @@ var (
 	errOwnConnection   = &Error{"dropped own connection"}
 	errNotEncrypted    = &Error{"connection is not encrypted"}
 	errInvalidProtocol = &Error{"invalid protocol"}
+	errBanned          = &Error{"peer is banned"}
 )
 
 type Error struct {
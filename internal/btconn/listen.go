@@ -0,0 +1,16 @@
+package btconn
+
+import (
+	"context"
+	"net"
+)
+
+// ListenReusePort is same as net.ListenTCP but the port of the listener can be used as local address in Dial.
+func ListenReusePort(network string, addr *net.TCPAddr) (*net.TCPListener, error) {
+	lc := net.ListenConfig{Control: reusePort}
+	l, err := lc.Listen(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
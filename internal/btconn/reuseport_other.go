@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package btconn
+
+import "syscall"
+
+// ReusePortSupported is true if a listener created with ListenReusePort and connections made with Dial
+// can share the same local port.
+const ReusePortSupported = false
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
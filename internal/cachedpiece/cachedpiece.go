@@ -8,35 +8,32 @@ import (
 )
 
 type CachedPiece struct {
-	pi       *piece.Piece
-	cache    *piececache.Cache
-	readSize int64
-	peerID   []byte
+	pieces    []piece.Piece
+	pi        *piece.Piece
+	cache     *piececache.Cache
+	readSize  int64
+	torrentID string
+	stream    *Stream
 }
 
-func New(pi *piece.Piece, cache *piececache.Cache, readSize int64, peerID [20]byte) *CachedPiece {
+// New returns a new CachedPiece for reading the piece at index through cache.
+// If stream is not nil, next regions are prefetched when the peer is reading sequentially.
+func New(pieces []piece.Piece, index uint32, cache *piececache.Cache, readSize int64, torrentID string, stream *Stream) *CachedPiece {
 	return &CachedPiece{
-		pi:       pi,
-		cache:    cache,
-		readSize: readSize,
-		peerID:   peerID[:],
+		pieces:    pieces,
+		pi:        &pieces[index],
+		cache:     cache,
+		readSize:  readSize,
+		torrentID: torrentID,
+		stream:    stream,
 	}
 }
 
 func (c *CachedPiece) ReadAt(p []byte, off int64) (n int, err error) {
 	blk := uint32(off / c.readSize)
-	blkBegin := uint32(int64(blk) * c.readSize)
-	blkEnd := uint32(int64(blkBegin) + c.readSize)
-	if blkEnd > c.pi.Length {
-		blkEnd = c.pi.Length
-	}
-
-	key := make([]byte, 20+4+4)
-	copy(key, c.peerID)
-	binary.BigEndian.PutUint32(key[20:24], c.pi.Index)
-	binary.BigEndian.PutUint32(key[24:28], blk)
+	blkBegin, blkEnd := c.bounds(c.pi, blk)
 
-	buf, err := c.cache.Get(string(key), func() ([]byte, error) {
+	buf, err := c.cache.GetGroup(c.torrentID, c.key(c.pi.Index, blk), func() ([]byte, error) {
 		b := make([]byte, blkEnd-blkBegin)
 		_, err = c.pi.Data.ReadAt(b, int64(blkBegin))
 		return b, err
@@ -45,6 +42,113 @@ func (c *CachedPiece) ReadAt(p []byte, off int64) (n int, err error) {
 		return
 	}
 
+	if c.stream != nil {
+		c.readAhead(blk)
+	}
+
 	begin := off - int64(blkBegin)
 	return copy(p, buf[begin:]), nil
 }
+
+// CachedPieces returns the indexes of pieces of the torrent that have regions in cache, most recently read first.
+func CachedPieces(cache *piececache.Cache, torrentID string) []uint32 {
+	var ret []uint32
+	seen := make(map[uint32]struct{})
+	for _, key := range cache.Keys(torrentID) {
+		if len(key) != len(torrentID)+4+4 {
+			continue
+		}
+		index := binary.BigEndian.Uint32([]byte(key[len(torrentID) : len(torrentID)+4]))
+		if _, ok := seen[index]; ok {
+			continue
+		}
+		seen[index] = struct{}{}
+		ret = append(ret, index)
+	}
+	return ret
+}
+
+func (c *CachedPiece) key(index, blk uint32) string {
+	key := make([]byte, len(c.torrentID)+4+4)
+	n := copy(key, c.torrentID)
+	binary.BigEndian.PutUint32(key[n:n+4], index)
+	binary.BigEndian.PutUint32(key[n+4:n+8], blk)
+	return string(key)
+}
+
+// bounds returns the offsets of the region in piece.
+func (c *CachedPiece) bounds(pi *piece.Piece, blk uint32) (begin, end uint32) {
+	begin = uint32(int64(blk) * c.readSize)
+	end = uint32(int64(begin) + c.readSize)
+	if end > pi.Length {
+		end = pi.Length
+	}
+	return
+}
+
+func (c *CachedPiece) numRegions(pi *piece.Piece) uint32 {
+	return uint32((int64(pi.Length) + c.readSize - 1) / c.readSize)
+}
+
+type region struct {
+	index uint32
+	blk   uint32
+}
+
+func (c *CachedPiece) readAhead(blk uint32) {
+	// All pieces except the last one have the same length, so the number of regions in first piece can be used
+	// for converting the region to an absolute position in torrent.
+	pos := int64(c.pi.Index)*int64(c.numRegions(&c.pieces[0])) + int64(blk)
+	n := c.stream.next(pos)
+	if n == 0 {
+		return
+	}
+	regions := make([]region, 0, n)
+	index, b := c.pi.Index, blk
+	for len(regions) < n {
+		b++
+		if b >= c.numRegions(&c.pieces[index]) {
+			index++
+			b = 0
+		}
+		if index >= uint32(len(c.pieces)) {
+			break
+		}
+		regions = append(regions, region{index: index, blk: b})
+	}
+	if len(regions) == 0 {
+		return
+	}
+	keys := make([]string, len(regions))
+	for i, r := range regions {
+		keys[i] = c.key(r.index, r.blk)
+	}
+	c.cache.Prefetch(c.torrentID, keys, func(begin, end int) ([][]byte, error) {
+		return c.load(regions[begin:end])
+	})
+}
+
+// load reads consecutive regions with a single read operation per piece.
+func (c *CachedPiece) load(regions []region) ([][]byte, error) {
+	values := make([][]byte, 0, len(regions))
+	for len(regions) > 0 {
+		pi := &c.pieces[regions[0].index]
+		n := 1
+		for n < len(regions) && regions[n].index == pi.Index {
+			n++
+		}
+		begin, _ := c.bounds(pi, regions[0].blk)
+		_, end := c.bounds(pi, regions[n-1].blk)
+		b := make([]byte, end-begin)
+		_, err := pi.Data.ReadAt(b, int64(begin))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range regions[:n] {
+			rb, re := c.bounds(pi, r.blk)
+			values = append(values, b[rb-begin:re-begin:re-begin])
+		}
+		regions = regions[n:]
+	}
+	return values, nil
+}
@@ -0,0 +1,75 @@
+package cachedpiece
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/filesection"
+	"github.com/ProtocolONE/rain/internal/piece"
+	"github.com/ProtocolONE/rain/internal/piececache"
+)
+
+type countingFile struct {
+	data []byte
+
+	m     sync.Mutex
+	reads int
+}
+
+func (f *countingFile) ReadAt(b []byte, off int64) (int, error) {
+	f.m.Lock()
+	f.reads++
+	f.m.Unlock()
+	return copy(b, f.data[off:]), nil
+}
+
+func (f *countingFile) WriteAt(b []byte, off int64) (int, error) {
+	return copy(f.data[off:], b), nil
+}
+
+func (f *countingFile) numReads() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.reads
+}
+
+func TestReadAhead(t *testing.T) {
+	const pieceLength = 8
+	const readSize = 4
+
+	f := &countingFile{data: []byte("abcdefghijklmnopqrstuvwx")}
+	pieces := make([]piece.Piece, len(f.data)/pieceLength)
+	for i := range pieces {
+		pieces[i] = piece.Piece{
+			Index:  uint32(i),
+			Length: pieceLength,
+			Data:   filesection.Piece{{File: f, Offset: int64(i * pieceLength), Length: pieceLength}},
+		}
+	}
+	cache := piececache.New(100, time.Minute, 1)
+	defer cache.Close()
+	stream := NewStream(4)
+
+	// Read all regions sequentially.
+	for pos := 0; pos < len(f.data)/readSize; pos++ {
+		index := uint32(pos * readSize / pieceLength)
+		off := int64(pos*readSize) % pieceLength
+		b := make([]byte, readSize)
+		_, err := New(pieces, index, cache, readSize, "t1", stream).ReadAt(b, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := f.data[pos*readSize : (pos+1)*readSize]; !bytes.Equal(b, expected) {
+			t.Fatalf("invalid data at region %d: %q", pos, b)
+		}
+	}
+	// First region is read on demand, the rest is prefetched with a single read per piece.
+	if n := f.numReads(); n != 4 {
+		t.Fatalf("unexpected number of reads: %d", n)
+	}
+	if pieces := CachedPieces(cache, "t1"); len(pieces) != 3 || pieces[0] != 2 {
+		t.Fatalf("unexpected cached pieces: %v", pieces)
+	}
+}
@@ -0,0 +1,46 @@
+package cachedpiece
+
+import "sync"
+
+// Stream tracks the regions read by a peer in order to detect sequential reads.
+// Number of regions to read ahead is doubled on each sequential read, up to a maximum.
+// It is reset when the peer reads a region that does not follow the previous one.
+type Stream struct {
+	max int
+
+	m      sync.Mutex
+	last   int64
+	window int
+}
+
+// NewStream returns a new Stream that reads ahead at most max regions.
+func NewStream(max int) *Stream {
+	return &Stream{
+		max:  max,
+		last: -1,
+	}
+}
+
+// next records the read of region at pos and returns the number of regions to prefetch after it.
+func (s *Stream) next(pos int64) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	switch pos {
+	case s.last:
+		// Another block in the same region. Regions are already prefetched.
+		return 0
+	case s.last + 1:
+		if s.window == 0 {
+			s.window = 1
+		} else if s.window < s.max {
+			s.window *= 2
+		}
+		if s.window > s.max {
+			s.window = s.max
+		}
+	default:
+		s.window = 0
+	}
+	s.last = pos
+	return s.window
+}
@@ -0,0 +1,24 @@
+package cachedpiece
+
+import "testing"
+
+func TestStream(t *testing.T) {
+	s := NewStream(4)
+	cases := []struct {
+		pos    int64
+		window int
+	}{
+		{0, 1},
+		{0, 0}, // same region
+		{1, 2},
+		{2, 4},
+		{3, 4},  // limited by max
+		{10, 0}, // not sequential
+		{11, 1},
+	}
+	for _, c := range cases {
+		if n := s.next(c.pos); n != c.window {
+			t.Fatalf("unexpected window at %d: %d", c.pos, n)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package console
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -19,20 +21,50 @@ const (
 	trackers
 	peers
 	webseeds
+	files
+	pieces
 )
 
+const (
+	// columns of torrent list that can be sorted
+	sortAdded int = iota
+	sortName
+	sortStatus
+	sortSize
+	sortProgress
+	sortDownload
+	sortUpload
+	sortPeers
+	numSortColumns
+)
+
+var sortColumnNames = [numSortColumns]string{"added", "name", "status", "size", "progress", "download", "upload", "peers"}
+
+type torrentItem struct {
+	rpctypes.Torrent
+	Stats rpctypes.Stats
+}
+
 type Console struct {
 	client          *rainrpc.Client
-	torrents        []rpctypes.Torrent
+	torrents        []torrentItem
 	errTorrents     error
+	filter          rpctypes.TorrentFilter
+	filterText      string
+	sortColumn      int
+	sortReverse     bool
 	selectedID      string
 	selectedTab     int
 	stats           rpctypes.Stats
 	trackers        []rpctypes.Tracker
 	peers           []rpctypes.Peer
 	webseeds        []rpctypes.Webseed
+	files           []rpctypes.File
+	pieces          rpctypes.GetTorrentPiecesResponse
 	errDetails      error
 	updatingDetails bool
+	dialog          *dialog
+	message         string
 	m               sync.Mutex
 	updateTorrentsC chan struct{}
 	updateDetailsC  chan struct{}
@@ -54,9 +86,11 @@ func (c *Console) Run() error {
 	defer g.Close()
 
 	g.SetManagerFunc(c.layout)
+	// Needed for closing dialogs with Esc key.
+	g.InputEsc = true
 
 	_ = g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, quit)
-	_ = g.SetKeybinding("", 'q', gocui.ModNone, quit)
+	_ = g.SetKeybinding("torrents", 'q', gocui.ModNone, quit)
 	_ = g.SetKeybinding("torrents", 'j', gocui.ModNone, c.cursorDown)
 	_ = g.SetKeybinding("torrents", 'k', gocui.ModNone, c.cursorUp)
 	_ = g.SetKeybinding("torrents", 'R', gocui.ModNone, c.removeTorrent)
@@ -68,6 +102,16 @@ func (c *Console) Run() error {
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlT, gocui.ModNone, c.switchTrackers)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlP, gocui.ModNone, c.switchPeers)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlW, gocui.ModNone, c.switchWebseeds)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlF, gocui.ModNone, c.switchFiles)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlO, gocui.ModNone, c.switchPieces)
+	_ = g.SetKeybinding("torrents", 'o', gocui.ModNone, c.nextSortColumn)
+	_ = g.SetKeybinding("torrents", 'O', gocui.ModNone, c.reverseSort)
+	_ = g.SetKeybinding("torrents", '/', gocui.ModNone, c.openFilterDialog)
+	_ = g.SetKeybinding("torrents", 'a', gocui.ModNone, c.openAddTorrentDialog)
+	_ = g.SetKeybinding("torrents", 'p', gocui.ModNone, c.openAddPeerDialog)
+	_ = g.SetKeybinding("torrents", 't', gocui.ModNone, c.openAddTrackerDialog)
+	_ = g.SetKeybinding("dialog", gocui.KeyEnter, gocui.ModNone, c.submitDialog)
+	_ = g.SetKeybinding("dialog", gocui.KeyEsc, gocui.ModNone, c.closeDialog)
 
 	go c.updateLoop(g)
 
@@ -79,7 +123,11 @@ func (c *Console) Run() error {
 }
 
 func (c *Console) layout(g *gocui.Gui) error {
-	err := c.drawTorrents(g)
+	err := c.drawHeader(g)
+	if err != nil {
+		return err
+	}
+	err = c.drawTorrents(g)
 	if err != nil {
 		return err
 	}
@@ -87,8 +135,36 @@ func (c *Console) layout(g *gocui.Gui) error {
 	if err != nil {
 		return err
 	}
-	_, err = g.SetCurrentView("torrents")
-	return err
+	return c.drawDialog(g)
+}
+
+const torrentRowFormat = "%-22s %-11s %10s %6s %10s %10s %5s %s\n"
+
+func (c *Console) drawHeader(g *gocui.Gui) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	maxX, _ := g.Size()
+	v, err := g.SetView("header", -1, -1, maxX, 1)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = false
+	}
+	v.Clear()
+	status := "sort: " + sortColumnNames[c.sortColumn]
+	if c.sortReverse {
+		status += " (reversed)"
+	}
+	if c.filterText != "" {
+		status += ", filter: " + c.filterText
+	}
+	if c.message != "" {
+		status += ", " + c.message
+	}
+	fmt.Fprintf(v, torrentRowFormat, "ID", "Status", "Size", "Done", "Down", "Up", "Peers", "Name  ["+status+"]")
+	return nil
 }
 
 func (c *Console) drawTorrents(g *gocui.Gui) error {
@@ -97,7 +173,7 @@ func (c *Console) drawTorrents(g *gocui.Gui) error {
 
 	maxX, maxY := g.Size()
 	halfY := maxY / 2
-	if v, err := g.SetView("torrents", -1, -1, maxX, halfY); err != nil {
+	if v, err := g.SetView("torrents", -1, 0, maxX, halfY); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
@@ -112,13 +188,29 @@ func (c *Console) drawTorrents(g *gocui.Gui) error {
 			return nil
 		}
 		for _, t := range c.torrents {
-			fmt.Fprintf(v, "%s %s %5d %s\n", t.ID, t.InfoHash, t.Port, t.Name)
+			fmt.Fprintf(v, torrentRowFormat,
+				t.ID,
+				shortStatus(t.Stats),
+				formatBytes(t.Stats.Bytes.Total),
+				fmt.Sprintf("%d%%", int(progress(t.Stats)*100)),
+				formatSpeed(t.Stats.Speed.Download),
+				formatSpeed(t.Stats.Speed.Upload),
+				fmt.Sprint(t.Stats.Peers.Total),
+				t.Name)
+		}
+		// Keep the cursor on selected torrent when the order of list changes.
+		for i, t := range c.torrents {
+			if t.ID == c.selectedID {
+				return c.switchRow(v, i)
+			}
 		}
 		_, cy := v.Cursor()
 		_, oy := v.Origin()
 		selectedRow := cy + oy
 		if selectedRow < len(c.torrents) {
 			c.setSelectedID(c.torrents[selectedRow].ID)
+		} else if len(c.torrents) > 0 {
+			return c.switchRow(v, len(c.torrents)-1)
 		}
 	}
 	return nil
@@ -166,8 +258,8 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 				}
 			}
 		case peers:
-			format := "%2s %21s %7s %8s %6s %s\n"
-			fmt.Fprintf(v, format, "#", "Addr", "Flags", "Download", "Upload", "Client")
+			format := "%2s %21s %7s %8s %6s %7s %5s %s\n"
+			fmt.Fprintf(v, format, "#", "Addr", "Flags", "Download", "Upload", "Queue", "RTT", "Client")
 			for i, p := range c.peers {
 				num := fmt.Sprintf("%d", i)
 				var dl string
@@ -178,7 +270,12 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 				if p.UploadSpeed > 0 {
 					ul = fmt.Sprintf("%d", p.UploadSpeed/1024)
 				}
-				fmt.Fprintf(v, format, num, p.Addr, flags(p), dl, ul, p.Client)
+				queue := fmt.Sprintf("%d/%d", p.PendingRequests, p.RequestQueue)
+				var rtt string
+				if p.RTT > 0 {
+					rtt = fmt.Sprintf("%dms", p.RTT)
+				}
+				fmt.Fprintf(v, format, num, p.Addr, flags(p), dl, ul, queue, rtt, p.Client)
 			}
 		case webseeds:
 			format := "%2s %40s %8s %s\n"
@@ -195,11 +292,49 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 				}
 				fmt.Fprintf(v, format, num, p.URL, dl, errstr)
 			}
+		case files:
+			format := "%2s %6s %10s %s\n"
+			fmt.Fprintf(v, format, "#", "Done", "Size", "Path")
+			for i, f := range c.files {
+				done := 100
+				if f.Length > 0 {
+					done = int(f.Completed * 100 / f.Length)
+				}
+				fmt.Fprintf(v, format, fmt.Sprint(i), fmt.Sprintf("%d%%", done), formatBytes(f.Length), f.Path)
+			}
+		case pieces:
+			drawPieceMap(v, c.pieces)
 		}
 	}
 	return nil
 }
 
+// drawPieceMap writes a character for each piece in torrent.
+// Downloaded pieces are shown as '#'. Other pieces are shown with the number of peers that have the piece.
+func drawPieceMap(v *gocui.View, p rpctypes.GetTorrentPiecesResponse) {
+	have, err := base64.StdEncoding.DecodeString(p.Have)
+	if err != nil {
+		fmt.Fprintln(v, "error:", err)
+		return
+	}
+	fmt.Fprintln(v, "#: downloaded, 1-9: number of peers having the piece, +: more than 9, .: not available")
+	var sb strings.Builder
+	sb.Grow(int(p.NumPieces))
+	for i := uint32(0); i < p.NumPieces; i++ {
+		switch a := p.Availability[i]; {
+		case int(i/8) < len(have) && have[i/8]&(0x80>>(i%8)) != 0:
+			sb.WriteByte('#')
+		case a == 0:
+			sb.WriteByte('.')
+		case a < 10:
+			sb.WriteByte(byte('0' + a))
+		default:
+			sb.WriteByte('+')
+		}
+	}
+	fmt.Fprintln(v, sb.String())
+}
+
 func (c *Console) updateLoop(g *gocui.Gui) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
@@ -220,19 +355,23 @@ func (c *Console) updateLoop(g *gocui.Gui) {
 }
 
 func (c *Console) updateTorrents(g *gocui.Gui) {
-	torrents, err := c.client.ListTorrents()
+	c.m.Lock()
+	filter := c.filter
+	c.m.Unlock()
 
-	sort.Slice(torrents, func(i, j int) bool {
-		a, b := torrents[i], torrents[j]
-		if a.AddedAt.Equal(b.AddedAt.Time) {
-			return a.ID < b.ID
+	list, err := c.client.ListTorrentsWithStats(filter, nil)
+	torrents := make([]torrentItem, len(list))
+	for i, t := range list {
+		torrents[i].Torrent = t.Torrent
+		if err == nil {
+			err = convertStats(t.Stats, &torrents[i].Stats)
 		}
-		return a.AddedAt.Time.Before(b.AddedAt.Time)
-	})
+	}
 
 	c.m.Lock()
 	c.torrents = torrents
 	c.errTorrents = err
+	c.sortTorrents()
 	if len(c.torrents) == 0 {
 		c.setSelectedID("")
 	} else if c.selectedID == "" {
@@ -240,7 +379,60 @@ func (c *Console) updateTorrents(g *gocui.Gui) {
 	}
 	c.m.Unlock()
 
-	g.Update(c.drawTorrents)
+	g.Update(c.layout)
+}
+
+// convertStats converts the stats that are returned as map from ListTorrentsWithStats.
+func convertStats(m map[string]interface{}, stats *rpctypes.Stats) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, stats)
+}
+
+// sortTorrents sorts torrent list by selected column. Torrents are ordered by the time they are added if values are equal.
+func (c *Console) sortTorrents() {
+	value := func(t torrentItem) float64 {
+		switch c.sortColumn {
+		case sortSize:
+			return float64(t.Stats.Bytes.Total)
+		case sortProgress:
+			return progress(t.Stats)
+		case sortDownload:
+			return float64(t.Stats.Speed.Download)
+		case sortUpload:
+			return float64(t.Stats.Speed.Upload)
+		case sortPeers:
+			return float64(t.Stats.Peers.Total)
+		}
+		return 0
+	}
+	sort.SliceStable(c.torrents, func(i, j int) bool {
+		a, b := c.torrents[i], c.torrents[j]
+		if c.sortReverse {
+			a, b = b, a
+		}
+		switch c.sortColumn {
+		case sortName:
+			if a.Name != b.Name {
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case sortStatus:
+			if sa, sb := shortStatus(a.Stats), shortStatus(b.Stats); sa != sb {
+				return sa < sb
+			}
+		case sortAdded:
+		default:
+			if va, vb := value(a), value(b); va != vb {
+				return va < vb
+			}
+		}
+		if a.AddedAt.Equal(b.AddedAt.Time) {
+			return a.ID < b.ID
+		}
+		return a.AddedAt.Time.Before(b.AddedAt.Time)
+	})
 }
 
 func (c *Console) updateDetails(g *gocui.Gui) {
@@ -289,6 +481,18 @@ func (c *Console) updateDetails(g *gocui.Gui) {
 		c.webseeds = webseeds
 		c.errDetails = err
 		c.m.Unlock()
+	case files:
+		files, err := c.client.GetTorrentFiles(selectedID)
+		c.m.Lock()
+		c.files = files
+		c.errDetails = err
+		c.m.Unlock()
+	case pieces:
+		pieces, err := c.client.GetTorrentPieces(selectedID)
+		c.m.Lock()
+		c.pieces = *pieces
+		c.errDetails = err
+		c.m.Unlock()
 	}
 
 	c.m.Lock()
@@ -476,6 +680,38 @@ func (c *Console) switchWebseeds(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) switchFiles(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.selectedTab = files
+	c.m.Unlock()
+	c.triggerUpdateDetails(true)
+	return nil
+}
+
+func (c *Console) switchPieces(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.selectedTab = pieces
+	c.m.Unlock()
+	c.triggerUpdateDetails(true)
+	return nil
+}
+
+func (c *Console) nextSortColumn(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.sortColumn = (c.sortColumn + 1) % numSortColumns
+	c.sortTorrents()
+	c.m.Unlock()
+	return nil
+}
+
+func (c *Console) reverseSort(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.sortReverse = !c.sortReverse
+	c.sortTorrents()
+	c.m.Unlock()
+	return nil
+}
+
 func (c *Console) triggerUpdateDetails(clear bool) {
 	if clear {
 		c.updatingDetails = true
@@ -546,6 +782,8 @@ func flags(p rpctypes.Peer) string {
 		sb.WriteString("I")
 	case "MANUAL":
 		sb.WriteString("M")
+	case "HOLEPUNCH":
+		sb.WriteString("P")
 	default:
 		sb.WriteString(" ")
 	}
@@ -559,3 +797,40 @@ func flags(p rpctypes.Peer) string {
 	}
 	return sb.String()
 }
+
+func shortStatus(s rpctypes.Stats) string {
+	if s.Error != nil {
+		return "Error"
+	}
+	if s.Status == "Downloading Metadata" {
+		return "Metadata"
+	}
+	return s.Status
+}
+
+func progress(s rpctypes.Stats) float64 {
+	if s.Pieces.Total == 0 {
+		return 0
+	}
+	return float64(s.Pieces.Have) / float64(s.Pieces.Total)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatSpeed(n uint) string {
+	if n == 0 {
+		return ""
+	}
+	return formatBytes(int64(n)) + "/s"
+}
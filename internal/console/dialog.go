@@ -0,0 +1,200 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+	"github.com/jroimartin/gocui"
+)
+
+// dialog is a single line input box shown in the middle of the screen.
+type dialog struct {
+	title   string
+	initial string
+	// Returned message is shown in the header after the dialog is closed.
+	onSubmit func(input string) (string, error)
+}
+
+func (c *Console) openDialog(title, initial string, onSubmit func(input string) (string, error)) {
+	c.m.Lock()
+	c.dialog = &dialog{title: title, initial: initial, onSubmit: onSubmit}
+	c.message = ""
+	c.m.Unlock()
+}
+
+func (c *Console) drawDialog(g *gocui.Gui) error {
+	c.m.Lock()
+	d := c.dialog
+	c.m.Unlock()
+
+	if d == nil {
+		err := g.DeleteView("dialog")
+		if err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		_, err = g.SetCurrentView("torrents")
+		return err
+	}
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("dialog", maxX/6, maxY/2-1, maxX*5/6, maxY/2+1); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = d.title + " (Enter: OK, Esc: cancel)"
+		v.Editable = true
+		fmt.Fprint(v, d.initial)
+		_ = v.SetCursor(len(d.initial), 0)
+	}
+	_, err := g.SetCurrentView("dialog")
+	return err
+}
+
+func (c *Console) submitDialog(g *gocui.Gui, v *gocui.View) error {
+	input := strings.TrimSpace(v.Buffer())
+	c.m.Lock()
+	d := c.dialog
+	c.dialog = nil
+	c.m.Unlock()
+
+	if d == nil {
+		return nil
+	}
+	msg, err := d.onSubmit(input)
+	if err != nil {
+		msg = "error: " + err.Error()
+	}
+	c.m.Lock()
+	c.message = msg
+	c.m.Unlock()
+	return nil
+}
+
+func (c *Console) closeDialog(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.dialog = nil
+	c.m.Unlock()
+	return nil
+}
+
+func (c *Console) openAddTorrentDialog(g *gocui.Gui, v *gocui.View) error {
+	c.openDialog("Add torrent file path, magnet link or URL", "", func(input string) (string, error) {
+		if input == "" {
+			return "", nil
+		}
+		var t *rpctypes.Torrent
+		var err error
+		if strings.HasPrefix(input, "magnet:") || strings.Contains(input, "://") {
+			t, err = c.client.AddURI(input)
+		} else {
+			var f *os.File
+			f, err = os.Open(input) // nolint: gosec
+			if err != nil {
+				return "", err
+			}
+			t, err = c.client.AddTorrent(f)
+			f.Close()
+		}
+		if err != nil {
+			return "", err
+		}
+		c.m.Lock()
+		c.setSelectedID(t.ID)
+		c.m.Unlock()
+		c.triggerUpdateTorrents()
+		return "added " + t.Name, nil
+	})
+	return nil
+}
+
+func (c *Console) openAddPeerDialog(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	if id == "" {
+		return nil
+	}
+	c.openDialog("Add peer address (IP:PORT)", "", func(input string) (string, error) {
+		if input == "" {
+			return "", nil
+		}
+		err := c.client.AddPeer(id, input)
+		if err != nil {
+			return "", err
+		}
+		c.triggerUpdateDetails(false)
+		return "added peer " + input, nil
+	})
+	return nil
+}
+
+func (c *Console) openAddTrackerDialog(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	if id == "" {
+		return nil
+	}
+	c.openDialog("Add tracker URL", "", func(input string) (string, error) {
+		if input == "" {
+			return "", nil
+		}
+		err := c.client.AddTracker(id, input)
+		if err != nil {
+			return "", err
+		}
+		c.triggerUpdateDetails(false)
+		return "added tracker " + input, nil
+	})
+	return nil
+}
+
+func (c *Console) openFilterDialog(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	text := c.filterText
+	c.m.Unlock()
+
+	c.openDialog("Filter torrents: name or KEY=VALUE (id, status, name, tracker)", text, func(input string) (string, error) {
+		filter, err := parseFilter(input)
+		if err != nil {
+			return "", err
+		}
+		c.m.Lock()
+		c.filter = filter
+		c.filterText = input
+		c.m.Unlock()
+		c.triggerUpdateTorrents()
+		return "", nil
+	})
+	return nil
+}
+
+// parseFilter parses space separated KEY=VALUE pairs.
+// Words without "=" match the torrents having the word in their names.
+func parseFilter(s string) (rpctypes.TorrentFilter, error) {
+	var f rpctypes.TorrentFilter
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			f.Name = "*" + field + "*"
+			continue
+		}
+		switch key {
+		case "id":
+			f.IDs = append(f.IDs, value)
+		case "status":
+			f.Status = append(f.Status, value)
+		case "name":
+			f.Name = value
+		case "tracker":
+			f.TrackerHost = value
+		default:
+			return f, errors.New("unknown filter key: " + key)
+		}
+	}
+	return f, nil
+}
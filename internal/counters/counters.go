@@ -10,10 +10,13 @@ const (
 	BytesUploaded
 	BytesWasted
 	SeededFor // time.Duration
+	// Below are not saved to resume db.
+	HashFailures
+	TrackerErrors
 )
 
 // counters provides concurrent-safe access over set of integers.
-type Counters [4]int64
+type Counters [6]int64
 
 func New(dl, ul, waste, seed int64) Counters {
 	var c Counters
@@ -0,0 +1,251 @@
+// Package existingdata finds the files of a torrent that already exist on disk in another directory.
+package existingdata
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtocolONE/rain/internal/metainfo"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+)
+
+// Match is a file in torrent that is found on disk.
+type Match struct {
+	// Path of the file relative to the storage destination of the torrent.
+	Name string
+	// Path of the existing file on disk.
+	Source string
+}
+
+type file struct {
+	name   string
+	offset int64 // offset of the file in torrent data
+	length int64
+}
+
+// ErrCancelled is returned from Find and Link when cancel channel is closed.
+var ErrCancelled = errors.New("cancelled")
+
+// spotChecks is the max number of pieces that are checked in a candidate file.
+// All pieces are verified after the files are allocated, so only a sample is enough to tell that a file is the same.
+const spotChecks = 5
+
+// Find searches dir for the files in torrent.
+// Candidates are the file at the same relative path and the files with the same size in dir.
+// A candidate matches if the hashes of a sample of the pieces that lie completely in the file are correct.
+// If there is no such piece, the file cannot be checked and only the candidate at the same path is accepted.
+// Find returns ErrCancelled when cancel is closed.
+func Find(info *metainfo.Info, dir string, cancel <-chan struct{}) ([]Match, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "find", Path: dir, Err: os.ErrInvalid}
+	}
+
+	files := filesOf(info)
+
+	var matches []Match
+	var bySize map[int64][]string // lazily built on first miss
+	for _, f := range files {
+		if f.length == 0 {
+			continue
+		}
+		select {
+		case <-cancel:
+			return nil, ErrCancelled
+		default:
+		}
+		// Look for the file under the torrent name first, then in dir as if it is the root of the torrent.
+		candidates := []string{filepath.Join(dir, f.name)}
+		if info.MultiFile() {
+			rel, _ := filepath.Rel(info.Name, f.name)
+			candidates = append(candidates, filepath.Join(dir, rel))
+		}
+		var found string
+		for _, path := range candidates {
+			if sizeOf(path) == f.length && checkPieces(info, f, path, true) {
+				found = path
+				break
+			}
+		}
+		if found == "" {
+			if bySize == nil {
+				bySize, err = indexBySize(dir)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for _, path := range bySize[f.length] {
+				if checkPieces(info, f, path, false) {
+					found = path
+					break
+				}
+			}
+		}
+		if found != "" {
+			matches = append(matches, Match{Name: f.name, Source: found})
+		}
+	}
+	return matches, nil
+}
+
+func sizeOf(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return -1
+	}
+	return fi.Size()
+}
+
+func indexBySize(dir string) (map[int64][]string, error) {
+	m := make(map[int64][]string)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// Skip unreadable entries.
+			return nil
+		}
+		if fi.Mode().IsRegular() && fi.Size() > 0 {
+			m[fi.Size()] = append(m[fi.Size()], path)
+		}
+		return nil
+	})
+	return m, err
+}
+
+// checkPieces returns true if the hashes of a sample of the pieces that lie completely in f match the data in the file at path.
+// If there is no such piece, samePath is returned.
+func checkPieces(info *metainfo.Info, f file, path string, samePath bool) bool {
+	pieceLength := int64(info.PieceLength)
+	first := (f.offset + pieceLength - 1) / pieceLength
+	last := first - 1
+	for last+1 < int64(info.NumPieces) && pieceEnd(info, last+1) <= f.offset+f.length {
+		last++
+	}
+	if last < first {
+		return samePath
+	}
+	of, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return false
+	}
+	defer of.Close()
+	buf := make([]byte, pieceLength)
+	for _, index := range sample(first, last, spotChecks) {
+		begin, end := index*pieceLength, pieceEnd(info, index)
+		b := buf[:end-begin]
+		_, err = of.ReadAt(b, begin-f.offset)
+		if err != nil {
+			return false
+		}
+		sum := sha1.Sum(b) // nolint: gosec
+		if !bytes.Equal(sum[:], info.HashOf(uint32(index))) {
+			return false
+		}
+	}
+	return true
+}
+
+// sample returns at most n evenly spaced numbers between first and last, including both.
+func sample(first, last int64, n int) []int64 {
+	count := last - first + 1
+	if count <= int64(n) {
+		ret := make([]int64, 0, count)
+		for i := first; i <= last; i++ {
+			ret = append(ret, i)
+		}
+		return ret
+	}
+	ret := make([]int64, n)
+	for i := range ret {
+		ret[i] = first + int64(i)*(count-1)/int64(n-1)
+	}
+	return ret
+}
+
+func pieceEnd(info *metainfo.Info, index int64) int64 {
+	end := (index + 1) * int64(info.PieceLength)
+	if end > info.TotalLength {
+		end = info.TotalLength
+	}
+	return end
+}
+
+// Link creates the matched files under dest, so they can be opened by the storage of the torrent.
+// Files are hard linked if file storage can detect links, otherwise or if linking fails they are copied.
+// File storage replaces a linked file with a private copy before changing it,
+// so writes to the torrent data never change the existing files or the data of other torrents.
+// Files that already exist under dest are left untouched.
+// If an error occurs or cancel is closed, the files created so far are removed.
+func Link(matches []Match, dest string, cancel <-chan struct{}) (err error) {
+	var created []string
+	defer func() {
+		if err != nil {
+			for _, name := range created {
+				_ = os.Remove(name)
+			}
+		}
+	}()
+	for _, m := range matches {
+		select {
+		case <-cancel:
+			return ErrCancelled
+		default:
+		}
+		target := filepath.Join(dest, m.Name)
+		if _, err = os.Lstat(target); err == nil {
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(target), os.ModeDir|0750)
+		if err != nil {
+			return err
+		}
+		if !filestorage.DetectsLinks || os.Link(m.Source, target) != nil {
+			err = copyFile(m.Source, target, cancel)
+			if err != nil {
+				return err
+			}
+		}
+		created = append(created, target)
+	}
+	return nil
+}
+
+// copyBufferSize is the size of the chunks read from the source file between the checks of cancel channel.
+const copyBufferSize = 1 << 20
+
+func copyFile(source, target string, cancel <-chan struct{}) error {
+	src, err := os.Open(source) // nolint: gosec
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640) // nolint: gosec
+	if err != nil {
+		return err
+	}
+	for err == nil {
+		select {
+		case <-cancel:
+			err = ErrCancelled
+		default:
+			_, err = io.CopyN(dst, src, copyBufferSize)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Do not leave a partial file. It would be verified as a file with missing pieces.
+		_ = os.Remove(target)
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package existingdata
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtocolONE/rain/internal/metainfo"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+	"github.com/zeebo/bencode"
+)
+
+func newInfo(t *testing.T, name string, pieceLength int, files map[string][]byte, order []string) *metainfo.Info {
+	var data []byte
+	var dicts []metainfo.FileDict
+	for _, name := range order {
+		data = append(data, files[name]...)
+		dicts = append(dicts, metainfo.FileDict{Length: int64(len(files[name])), Path: []string{name}})
+	}
+	var pieces []byte
+	for i := 0; i < len(data); i += pieceLength {
+		end := i + pieceLength
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha1.Sum(data[i:end]) // nolint: gosec
+		pieces = append(pieces, sum[:]...)
+	}
+	b, err := bencode.EncodeBytes(map[string]interface{}{
+		"name":         name,
+		"piece length": pieceLength,
+		"pieces":       pieces,
+		"files":        dicts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := metainfo.NewInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestFindAndLink(t *testing.T) {
+	files := map[string][]byte{
+		"a": []byte("0123456789"),
+		"b": []byte("abcdef"),
+		"c": []byte("ghijkl"),
+	}
+	info := newInfo(t, "foo", 4, files, []string{"a", "b", "c"})
+
+	dir, err := ioutil.TempDir("", "rain-existingdata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// "a" is at the same relative path and "b" is renamed.
+	// "c" has different content with same size, both at the same path and elsewhere.
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "foo", "a"), files["a"])
+	writeFile(t, filepath.Join(src, "other", "renamed"), files["b"])
+	writeFile(t, filepath.Join(src, "foo", "c"), []byte("ghijkX"))
+	writeFile(t, filepath.Join(src, "other", "decoy"), []byte("Xhijkl"))
+
+	matches, err := Find(info, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+	expected := []Match{
+		{Name: filepath.Join("foo", "a"), Source: filepath.Join(src, "foo", "a")},
+		{Name: filepath.Join("foo", "b"), Source: filepath.Join(src, "other", "renamed")},
+	}
+	for i := range expected {
+		if matches[i] != expected[i] {
+			t.Fatalf("unexpected match at %d: %v", i, matches[i])
+		}
+	}
+
+	dest := filepath.Join(dir, "dest")
+	err = Link(matches, dest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "foo", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcdef" {
+		t.Fatalf("unexpected content: %q", b)
+	}
+
+	// Writing to the torrent data must not change the existing file.
+	sto, err := filestorage.New(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := sto.Open(filepath.Join("foo", "b"), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("XXXXXX"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	b, err = ioutil.ReadFile(filepath.Join(src, "other", "renamed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcdef" {
+		t.Fatalf("existing file is changed: %q", b)
+	}
+}
+
+func TestLinkError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-existingdata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "src", "a"), []byte("abcd"))
+	matches := []Match{
+		{Name: "a", Source: filepath.Join(dir, "src", "a")},
+		{Name: "b", Source: filepath.Join(dir, "src", "missing")},
+	}
+	dest := filepath.Join(dir, "dest")
+	err = Link(matches, dest, nil)
+	if !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Files created before the error are removed.
+	if _, err = os.Lstat(filepath.Join(dest, "a")); !os.IsNotExist(err) {
+		t.Fatalf("file is not removed: %v", err)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	err = Link(matches, dest, cancel)
+	if err != ErrCancelled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSample(t *testing.T) {
+	cases := []struct {
+		first, last int64
+		expected    []int64
+	}{
+		{2, 2, []int64{2}},
+		{0, 3, []int64{0, 1, 2, 3}},
+		{1, 101, []int64{1, 26, 51, 76, 101}},
+	}
+	for _, c := range cases {
+		s := sample(c.first, c.last, 5)
+		if fmt.Sprint(s) != fmt.Sprint(c.expected) {
+			t.Errorf("sample(%d, %d) = %v, expected %v", c.first, c.last, s, c.expected)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	err := os.MkdirAll(filepath.Dir(name), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(name, data, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindInTorrent(t *testing.T) {
+	prev := newInfo(t, "v1", 4, map[string][]byte{"a": []byte("01234567"), "b": []byte("abcd"), "c": []byte("efgh")}, []string{"a", "b", "c"})
+	info := newInfo(t, "v2", 4, map[string][]byte{"a": []byte("01234567"), "b": []byte("ABCD"), "c": []byte("efgh")}, []string{"a", "b", "c"})
+
+	has := func(uint32) bool { return true }
+	matches := FindInTorrent(info, prev, has, "prev")
+	expected := []Match{
+		{Name: filepath.Join("v2", "a"), Source: filepath.Join("prev", "v1", "a")},
+		{Name: filepath.Join("v2", "c"), Source: filepath.Join("prev", "v1", "c")},
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+	for i := range expected {
+		if matches[i] != expected[i] {
+			t.Fatalf("unexpected match at %d: %v", i, matches[i])
+		}
+	}
+
+	// Files with missing pieces in previous version are not matched.
+	has = func(i uint32) bool { return i != 3 }
+	matches = FindInTorrent(info, prev, has, "prev")
+	if len(matches) != 1 || matches[0] != expected[0] {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+
+	// Renamed files are matched by their sizes and piece hashes, even if they are moved by a whole piece.
+	similar := newInfo(t, "other", 4, map[string][]byte{"new": []byte("wxyz"), "x": []byte("01234567"), "y": []byte("efgh")}, []string{"new", "x", "y"})
+	matches = FindInTorrent(similar, prev, func(uint32) bool { return true }, "prev")
+	expected = []Match{
+		{Name: filepath.Join("other", "x"), Source: filepath.Join("prev", "v1", "a")},
+		{Name: filepath.Join("other", "y"), Source: filepath.Join("prev", "v1", "c")},
+	}
+	if len(matches) != len(expected) || matches[0] != expected[0] || matches[1] != expected[1] {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+}
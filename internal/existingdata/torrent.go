@@ -0,0 +1,85 @@
+package existingdata
+
+import (
+	"bytes"
+	"path/filepath"
+
+	"github.com/ProtocolONE/rain/internal/metainfo"
+)
+
+// FindInTorrent returns the files of torrent that are identical in another torrent, such as a previous version of it or a similar torrent (BEP 38).
+// other is the info of the torrent whose files are in otherDir and otherHas reports if a piece of it is downloaded.
+// A file matches a file in other torrent if both have the same size, and all pieces containing the file have the same hashes in both torrents.
+// Pieces can be compared only if the file starts at the same position in a piece in both torrents.
+// Files at the same path are tried first, then files with the same size.
+func FindInTorrent(info, other *metainfo.Info, otherHas func(uint32) bool, otherDir string) []Match {
+	if info.PieceLength != other.PieceLength {
+		return nil
+	}
+	otherFiles := filesOf(other)
+	byName := make(map[string]file, len(otherFiles))
+	bySize := make(map[int64][]file)
+	for _, f := range otherFiles {
+		byName[relName(other, f.name)] = f
+		bySize[f.length] = append(bySize[f.length], f)
+	}
+	var matches []Match
+	for _, f := range filesOf(info) {
+		if f.length == 0 {
+			continue
+		}
+		candidates := bySize[f.length]
+		if of, ok := byName[relName(info, f.name)]; ok && of.length == f.length {
+			candidates = append([]file{of}, candidates...)
+		}
+		for _, of := range candidates {
+			if samePieces(info, other, otherHas, f, of) {
+				matches = append(matches, Match{Name: f.name, Source: filepath.Join(otherDir, of.name)})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// samePieces returns true if the pieces containing f in info have the same hashes with the pieces containing of in other.
+func samePieces(info, other *metainfo.Info, otherHas func(uint32) bool, f, of file) bool {
+	pieceLength := int64(info.PieceLength)
+	if (f.offset-of.offset)%pieceLength != 0 {
+		return false
+	}
+	shift := (f.offset - of.offset) / pieceLength
+	first := f.offset / pieceLength
+	last := (f.offset + f.length - 1) / pieceLength
+	for i := first; i <= last; i++ {
+		j := i - shift
+		if j < 0 || j >= int64(other.NumPieces) || !otherHas(uint32(j)) || !bytes.Equal(info.HashOf(uint32(i)), other.HashOf(uint32(j))) {
+			return false
+		}
+	}
+	return true
+}
+
+func filesOf(info *metainfo.Info) []file {
+	var files []file
+	var offset int64
+	for _, f := range info.GetFiles() {
+		name := info.Name
+		if info.MultiFile() {
+			name = filepath.Join(append([]string{info.Name}, f.Path...)...)
+		}
+		files = append(files, file{name: name, offset: offset, length: f.Length})
+		offset += f.Length
+	}
+	return files
+}
+
+// relName returns the path of the file relative to the root directory of the torrent.
+// The name of a single file torrent may change between versions, so it is not a part of the path.
+func relName(info *metainfo.Info, name string) string {
+	if !info.MultiFile() {
+		return "/"
+	}
+	rel, _ := filepath.Rel(info.Name, name)
+	return rel
+}
@@ -34,7 +34,7 @@ func (h *IncomingHandshaker) Close() {
 	<-h.doneC
 }
 
-func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []byte, checkInfoHashFunc func([20]byte) bool, resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
+func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []byte, checkInfoHashFunc func([20]byte) bool, isBannedFunc func(net.IP) bool, resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
 	defer close(h.doneC)
 	defer func() {
 		select {
@@ -47,7 +47,7 @@ func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []b
 	log := logger.New("conn <- " + h.Conn.RemoteAddr().String())
 
 	conn, cipher, peerExtensions, peerID, _, err := btconn.Accept(
-		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, checkInfoHashFunc, ourExtensions, peerID)
+		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, checkInfoHashFunc, isBannedFunc, ourExtensions, peerID)
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -0,0 +1,80 @@
+// Package hasher provides a pool of goroutines for calculating piece hashes on multiple CPU cores.
+package hasher
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"hash"
+	"sync"
+)
+
+// Pool runs hash calculations in a fixed number of worker goroutines shared by all torrents in a session.
+type Pool struct {
+	workers int
+	jobC    chan job
+	closeC  chan struct{}
+	wg      sync.WaitGroup
+}
+
+type job struct {
+	fn    func(h hash.Hash)
+	doneC chan struct{}
+}
+
+// New starts a new Pool with given number of workers.
+func New(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{
+		workers: workers,
+		jobC:    make(chan job),
+		closeC:  make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Workers returns the number of worker goroutines.
+func (p *Pool) Workers() int {
+	return p.workers
+}
+
+// Close stops the worker goroutines after running jobs are finished.
+func (p *Pool) Close() {
+	close(p.closeC)
+	p.wg.Wait()
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	h := sha1.New() // nolint: gosec
+	for {
+		select {
+		case j := <-p.jobC:
+			h.Reset()
+			j.fn(h)
+			close(j.doneC)
+		case <-p.closeC:
+			return
+		}
+	}
+}
+
+// Do runs fn in one of the workers and waits for it to return.
+// fn is called with a SHA-1 hash that is reset before the call.
+// If cancelC is closed before a worker is available, Do returns false without calling fn.
+func (p *Pool) Do(fn func(h hash.Hash), cancelC <-chan struct{}) bool {
+	j := job{fn: fn, doneC: make(chan struct{})}
+	select {
+	case p.jobC <- j:
+	case <-cancelC:
+		return false
+	case <-p.closeC:
+		return false
+	}
+	<-j.doneC
+	return true
+}
@@ -18,6 +18,15 @@ type Magnet struct {
 	Name     string
 	Trackers [][]string
 	Peers    []string
+	// Public key and salt of a mutable torrent (BEP 46). InfoHash is zero if the link has no "xt" param.
+	// Current info hash must be resolved from DHT.
+	PublicKey []byte
+	Salt      []byte
+}
+
+// Mutable returns true if the link points to a mutable torrent.
+func (m *Magnet) Mutable() bool {
+	return len(m.PublicKey) > 0
 }
 
 func New(s string) (*Magnet, error) {
@@ -34,21 +43,26 @@ func New(s string) (*Magnet, error) {
 
 	params := u.Query()
 
-	xts, ok := params["xt"]
-	if !ok {
-		return nil, errors.New("missing xt param")
-	}
-	if len(xts) == 0 {
-		return nil, errors.New("empty xt param")
-	}
-	xt := xts[0]
-
 	var magnet Magnet
-	magnet.InfoHash, err = infoHashString(xt)
+	magnet.PublicKey, magnet.Salt, err = publicKeyString(params)
 	if err != nil {
 		return nil, err
 	}
 
+	xts, ok := params["xt"]
+	if !ok && !magnet.Mutable() {
+		return nil, errors.New("missing xt param")
+	}
+	if ok {
+		if len(xts) == 0 {
+			return nil, errors.New("empty xt param")
+		}
+		magnet.InfoHash, err = infoHashString(xts[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	names := params["dn"]
 	if len(names) != 0 {
 		magnet.Name = names[0]
@@ -121,6 +135,37 @@ func infoHashString(xt string) ([20]byte, error) {
 	return ih, nil
 }
 
+// publicKeyString returns the public key in "xs" param and the salt in "s" param of a mutable torrent link (BEP 46).
+// Returns nil if the link does not have a public key.
+func publicKeyString(params url.Values) (publicKey, salt []byte, err error) {
+	for _, xs := range params["xs"] {
+		if !strings.HasPrefix(xs, "urn:btpk:") {
+			continue
+		}
+		publicKey, err = hex.DecodeString(xs[9:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(publicKey) != 32 {
+			return nil, nil, errors.New("public key must be 64 characters")
+		}
+		break
+	}
+	if publicKey == nil {
+		return nil, nil, nil
+	}
+	if s := params.Get("s"); s != "" {
+		salt, err = hex.DecodeString(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(salt) > 64 {
+			return nil, nil, errors.New("salt must be at most 64 bytes")
+		}
+	}
+	return publicKey, salt, nil
+}
+
 func filterOutControlChars(s string) string {
 	var sb strings.Builder
 	sb.Grow(len(s))
@@ -25,3 +25,26 @@ func TestParse(t *testing.T) {
 		t.Fatal("invalid tracker")
 	}
 }
+
+func TestParseMutable(t *testing.T) {
+	u := "magnet:?xs=urn:btpk:77ff84905a91936367c01360803104f92432fcd904a43511876df5cdf3e7e548&s=666f6f626172&dn=nightly"
+	m, err := New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Mutable() {
+		t.Fatal("link must be mutable")
+	}
+	if hex.EncodeToString(m.PublicKey) != "77ff84905a91936367c01360803104f92432fcd904a43511876df5cdf3e7e548" {
+		t.Fatal("invalid public key")
+	}
+	if string(m.Salt) != "foobar" {
+		t.Fatal("invalid salt")
+	}
+	if m.Name != "nightly" {
+		t.Fatal("invalid name")
+	}
+	if _, err = New("magnet:?xs=urn:btpk:1234"); err == nil {
+		t.Fatal("short public key must not be accepted")
+	}
+}
@@ -21,6 +21,11 @@ type Info struct {
 	Length      int64      `bencode:"length" json:"length"` // Single File Mode
 	Files       []FileDict `bencode:"files" json:"files"`   // Multiple File mode
 
+	// Info hashes of torrents that have files in common with this torrent (BEP 38).
+	Similar [][]byte `bencode:"-" json:"similar,omitempty"`
+	// Names of collections that this torrent belongs to (BEP 38).
+	Collections []string `bencode:"-" json:"collections,omitempty"`
+
 	// Calculated fileds
 	Hash        [20]byte `bencode:"-" json:"-"`
 	TotalLength int64    `bencode:"-" json:"-"`
@@ -28,6 +33,13 @@ type Info struct {
 	Bytes       []byte   `bencode:"-" json:"-"`
 }
 
+// infoBEP38 contains the keys of info dictionary that are decoded separately,
+// so invalid values in them do not make the torrent invalid.
+type infoBEP38 struct {
+	Similar     bencode.RawMessage `bencode:"similar"`
+	Collections bencode.RawMessage `bencode:"collections"`
+}
+
 type FileDict struct {
 	Length int64    `bencode:"length" json:"length"`
 	Path   []string `bencode:"path" json:"path"`
@@ -50,6 +62,11 @@ func NewInfo(b []byte) (*Info, error) {
 			}
 		}
 	}
+	var ext infoBEP38
+	if err := bencode.DecodeBytes(b, &ext); err == nil {
+		i.Similar = decodeSimilar(ext.Similar)
+		i.Collections = decodeCollections(ext.Collections)
+	}
 	i.NumPieces = uint32(len(i.Pieces)) / sha1.Size
 	if !i.MultiFile() {
 		i.TotalLength = i.Length
@@ -70,6 +87,38 @@ func NewInfo(b []byte) (*Info, error) {
 	return &i, nil
 }
 
+// decodeSimilar returns the info hashes in bencoded list b. Invalid values are ignored.
+func decodeSimilar(b bencode.RawMessage) [][]byte {
+	var l []bencode.RawMessage
+	if len(b) == 0 || bencode.DecodeBytes(b, &l) != nil {
+		return nil
+	}
+	var ret [][]byte
+	for _, e := range l {
+		var ih []byte
+		if bencode.DecodeBytes(e, &ih) == nil && len(ih) == sha1.Size {
+			ret = append(ret, ih)
+		}
+	}
+	return ret
+}
+
+// decodeCollections returns the collection names in bencoded list b. Invalid values are ignored.
+func decodeCollections(b bencode.RawMessage) []string {
+	var l []bencode.RawMessage
+	if len(b) == 0 || bencode.DecodeBytes(b, &l) != nil {
+		return nil
+	}
+	var ret []string
+	for _, e := range l {
+		var s string
+		if bencode.DecodeBytes(e, &s) == nil {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
 func (i *Info) MultiFile() bool {
 	return len(i.Files) != 0
 }
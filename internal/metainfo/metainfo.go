@@ -14,6 +14,8 @@ type MetaInfo struct {
 	Info         *Info
 	AnnounceList [][]string
 	URLList      []string
+	// Names of collections that this torrent belongs to (BEP 38), including the ones in info dictionary.
+	Collections []string
 }
 
 type metaInfo struct {
@@ -21,6 +23,7 @@ type metaInfo struct {
 	Announce     bencode.RawMessage `bencode:"announce"`
 	AnnounceList bencode.RawMessage `bencode:"announce-list"`
 	URLList      bencode.RawMessage `bencode:"url-list"`
+	Collections  bencode.RawMessage `bencode:"collections"`
 }
 
 // New returns a torrent from bencoded stream.
@@ -81,9 +84,24 @@ func New(r io.Reader) (*MetaInfo, error) {
 			}
 		}
 	}
+	ret.Collections = append(ret.Collections, info.Collections...)
+	for _, c := range decodeCollections(t.Collections) {
+		if !containsString(ret.Collections, c) {
+			ret.Collections = append(ret.Collections, c)
+		}
+	}
 	return &ret, nil
 }
 
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 func isTrackerSupported(s string) bool {
 	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "udp://")
 }
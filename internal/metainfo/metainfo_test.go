@@ -1,11 +1,13 @@
 package metainfo
 
 import (
+	"bytes"
 	"encoding/hex"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zeebo/bencode"
 )
 
 func TestTorrent(t *testing.T) {
@@ -27,3 +29,70 @@ func TestTorrent(t *testing.T) {
 		{"http://ipv6.torrent.ubuntu.com:6969/announce"},
 	}, tor.AnnounceList)
 }
+
+func TestSimilarAndCollections(t *testing.T) {
+	similar := "01234567890123456789"
+	info, err := bencode.EncodeBytes(map[string]interface{}{
+		"name":         "foo",
+		"piece length": 4,
+		"pieces":       "0123456789012345678901234567890123456789",
+		"length":       8,
+		"similar":      []string{similar, "short"},
+		"collections":  []string{"nightly"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := bencode.EncodeBytes(map[string]interface{}{
+		"info":        bencode.RawMessage(info),
+		"collections": []string{"nightly", "builds"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, [][]byte{[]byte(similar)}, tor.Info.Similar)
+	assert.Equal(t, []string{"nightly"}, tor.Info.Collections)
+	assert.Equal(t, []string{"nightly", "builds"}, tor.Collections)
+}
+
+func TestInvalidSimilarAndCollections(t *testing.T) {
+	similar := "01234567890123456789"
+	for _, tc := range []struct {
+		similar, collections interface{}
+		expectedSimilar      [][]byte
+		expectedCollections  []string
+	}{
+		{"not a list", 1, nil, nil},
+		{[]interface{}{1, similar}, []interface{}{[]string{"a"}, "nightly"}, [][]byte{[]byte(similar)}, []string{"nightly"}},
+	} {
+		info, err := bencode.EncodeBytes(map[string]interface{}{
+			"name":         "foo",
+			"piece length": 4,
+			"pieces":       "0123456789012345678901234567890123456789",
+			"length":       8,
+			"similar":      tc.similar,
+			"collections":  tc.collections,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := bencode.EncodeBytes(map[string]interface{}{
+			"info":        bencode.RawMessage(info),
+			"collections": tc.collections,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tor, err := New(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.expectedSimilar, tor.Info.Similar)
+		assert.Equal(t, tc.expectedCollections, tor.Info.Collections)
+		assert.Equal(t, tc.expectedCollections, tor.Collections)
+	}
+}
@@ -0,0 +1,90 @@
+// Package mutableresolver finds the current info hash of a mutable torrent (BEP 46)
+// by getting the mutable item (BEP 44) that is published under a public key from DHT.
+package mutableresolver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha1" // nolint: gosec
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/bencode"
+)
+
+var (
+	errInvalidPublicKey = errors.New("invalid public key")
+	errInvalidSignature = errors.New("invalid signature")
+	errInvalidInfoHash  = errors.New("invalid info hash in mutable item")
+)
+
+// Item is the version of a mutable torrent that is published in DHT.
+type Item struct {
+	InfoHash [20]byte
+	// Sequence number of the item. Newer versions have higher numbers.
+	Seq int64
+}
+
+// value is the "v" field of the mutable item.
+type value struct {
+	InfoHash []byte `bencode:"ih"`
+}
+
+// Target returns the DHT key of the item for publicKey and salt.
+func Target(publicKey, salt []byte) [20]byte {
+	b := make([]byte, 0, len(publicKey)+len(salt))
+	b = append(b, publicKey...)
+	b = append(b, salt...)
+	return sha1.Sum(b) // nolint: gosec
+}
+
+// signedData returns the buffer that is signed by the publisher of the item.
+func signedData(salt []byte, seq int64, v []byte) []byte {
+	var b bytes.Buffer
+	if len(salt) > 0 {
+		fmt.Fprintf(&b, "4:salt%d:", len(salt))
+		b.Write(salt)
+	}
+	fmt.Fprintf(&b, "3:seqi%de1:v", seq)
+	b.Write(v)
+	return b.Bytes()
+}
+
+func verifySignature(publicKey, salt []byte, seq int64, v, sig []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errInvalidPublicKey
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(publicKey, signedData(salt, seq, v), sig) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// Verify checks the signature of the item and decodes the info hash in bencoded value v.
+func Verify(publicKey, salt []byte, seq int64, v, sig []byte) (*Item, error) {
+	err := verifySignature(publicKey, salt, seq, v, sig)
+	if err != nil {
+		return nil, err
+	}
+	var val value
+	err = bencode.DecodeBytes(v, &val)
+	if err != nil {
+		return nil, err
+	}
+	if len(val.InfoHash) != 20 {
+		return nil, errInvalidInfoHash
+	}
+	item := &Item{Seq: seq}
+	copy(item.InfoHash[:], val.InfoHash)
+	return item, nil
+}
+
+// Sign returns the bencoded value and its signature for publishing a new version of the torrent.
+func Sign(privateKey ed25519.PrivateKey, salt []byte, seq int64, infoHash [20]byte) (v, sig []byte, err error) {
+	v, err = bencode.EncodeBytes(value{InfoHash: infoHash[:]})
+	if err != nil {
+		return nil, nil, err
+	}
+	sig = ed25519.Sign(privateKey, signedData(salt, seq, v))
+	return v, sig, nil
+}
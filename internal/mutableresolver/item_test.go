@@ -0,0 +1,57 @@
+package mutableresolver
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from BEP 44.
+func TestVerifySignature(t *testing.T) {
+	publicKey, _ := hex.DecodeString("77ff84905a91936367c01360803104f92432fcd904a43511876df5cdf3e7e548")
+	v := []byte("12:Hello World!")
+	cases := []struct {
+		salt   string
+		sig    string
+		target string
+	}{
+		{"", "305ac8aeb6c9c151fa120f120ea2cfb923564e11552d06a5d856091e5e853cff1260d3f39e4999684aa92eb73ffd136e6f4f3ecbfda0ce53a1608ecd7ae21f01", "4a533d47ec9c7d95b1ad75f576cffc641853b750"},
+		{"foobar", "6834284b6b24c3204eb2fea824d82f88883a3d95e8b4a21b8c0ded553d17d17ddf9a8a7104b1258f30bed3787e6cb896fca78c58f8e03b5f18f14951a87d9a08", "411eba73b6f087ca51a3795d9c8c938d365e32c1"},
+	}
+	for _, c := range cases {
+		sig, _ := hex.DecodeString(c.sig)
+		if err := verifySignature(publicKey, []byte(c.salt), 1, v, sig); err != nil {
+			t.Errorf("salt %q: %s", c.salt, err)
+		}
+		if err := verifySignature(publicKey, []byte(c.salt), 2, v, sig); err != errInvalidSignature {
+			t.Errorf("salt %q: signature must not match other sequence number", c.salt)
+		}
+		target := Target(publicKey, []byte(c.salt))
+		if hex.EncodeToString(target[:]) != c.target {
+			t.Errorf("salt %q: invalid target: %x", c.salt, target)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ih [20]byte
+	copy(ih[:], "01234567890123456789")
+	v, sig, err := Sign(privateKey, []byte("nightly"), 5, ih)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := Verify(publicKey, []byte("nightly"), 5, v, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.InfoHash != ih || item.Seq != 5 {
+		t.Fatalf("invalid item: %+v", item)
+	}
+	if _, err = Verify(publicKey, []byte("other"), 5, v, sig); err != errInvalidSignature {
+		t.Fatal("signature must not match other salt")
+	}
+}
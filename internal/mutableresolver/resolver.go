@@ -0,0 +1,312 @@
+package mutableresolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+const (
+	// Number of closest nodes that must respond before the lookup finishes.
+	k = 8
+	// Number of queries in flight.
+	alpha = 3
+	// Time to wait for a response before querying other nodes.
+	queryTimeout = 2 * time.Second
+	// Limit for the number of nodes learned during a lookup.
+	maxNodes = 500
+)
+
+var errNotFound = errors.New("mutable item not found in DHT")
+
+// Resolver gets mutable items from DHT with BEP 44 "get" queries.
+// It uses its own UDP socket and does not keep a routing table between lookups.
+type Resolver struct {
+	m              sync.Mutex
+	bootstrapNodes []string
+}
+
+// New returns a new Resolver that starts lookups from bootstrapNodes in "host:port" format.
+func New(bootstrapNodes []string) *Resolver {
+	return &Resolver{bootstrapNodes: bootstrapNodes}
+}
+
+// SetBootstrapNodes changes the nodes that are used for starting next lookups.
+func (r *Resolver) SetBootstrapNodes(nodes []string) {
+	r.m.Lock()
+	r.bootstrapNodes = nodes
+	r.m.Unlock()
+}
+
+type query struct {
+	T string    `bencode:"t"`
+	Y string    `bencode:"y"`
+	Q string    `bencode:"q"`
+	A queryArgs `bencode:"a"`
+}
+
+type queryArgs struct {
+	ID     string `bencode:"id"`
+	Target string `bencode:"target"`
+}
+
+type message struct {
+	T string         `bencode:"t"`
+	Y string         `bencode:"y"`
+	R responseValues `bencode:"r"`
+}
+
+type responseValues struct {
+	ID    string             `bencode:"id"`
+	Nodes string             `bencode:"nodes"`
+	K     string             `bencode:"k"`
+	Seq   int64              `bencode:"seq"`
+	Sig   string             `bencode:"sig"`
+	V     bencode.RawMessage `bencode:"v"`
+}
+
+type nodeState int
+
+const (
+	nodeNew nodeState = iota
+	nodeQueried
+	nodeResponded
+	nodeFailed
+)
+
+type node struct {
+	addr     *net.UDPAddr
+	distance [20]byte
+	state    nodeState
+	sentAt   time.Time
+}
+
+// Resolve does an iterative lookup towards the target of publicKey and salt
+// and returns the item with the highest sequence number that has a valid signature.
+// Lookup stops when k closest nodes have responded or ctx is done.
+func (r *Resolver) Resolve(ctx context.Context, publicKey, salt []byte) (*Item, error) {
+	if len(publicKey) != 32 {
+		return nil, errInvalidPublicKey
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	doneC := make(chan struct{})
+	defer close(doneC)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now()) // nolint: errcheck
+		case <-doneC:
+		}
+	}()
+
+	l := &lookup{
+		target:       Target(publicKey, salt),
+		publicKey:    publicKey,
+		salt:         salt,
+		conn:         conn,
+		nodes:        make(map[string]*node),
+		transactions: make(map[string]*node),
+	}
+	_, err = rand.Read(l.id[:])
+	if err != nil {
+		return nil, err
+	}
+	r.m.Lock()
+	bootstrapNodes := r.bootstrapNodes
+	r.m.Unlock()
+	for _, s := range bootstrapNodes {
+		addr, err2 := net.ResolveUDPAddr("udp4", s)
+		if err2 != nil {
+			continue
+		}
+		// Distance of bootstrap nodes is not known until they respond. Keep them at the end of the list.
+		var far [20]byte
+		for i := range far {
+			far[i] = 0xff
+		}
+		l.addNode(addr, far)
+	}
+	return l.run(ctx)
+}
+
+type lookup struct {
+	id        [20]byte
+	target    [20]byte
+	publicKey []byte
+	salt      []byte
+	conn      *net.UDPConn
+
+	nodes        map[string]*node
+	transactions map[string]*node
+	nextTID      uint16
+
+	item *Item
+}
+
+func (l *lookup) addNode(addr *net.UDPAddr, distance [20]byte) {
+	if len(l.nodes) >= maxNodes {
+		return
+	}
+	key := addr.String()
+	if _, ok := l.nodes[key]; ok {
+		return
+	}
+	l.nodes[key] = &node{addr: addr, distance: distance}
+}
+
+// closest returns the nodes sorted by their distance to target, excluding the nodes that did not respond.
+func (l *lookup) closest() []*node {
+	ret := make([]*node, 0, len(l.nodes))
+	for _, n := range l.nodes {
+		if n.state != nodeFailed {
+			ret = append(ret, n)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return bytes.Compare(ret[i].distance[:], ret[j].distance[:]) < 0 })
+	return ret
+}
+
+func (l *lookup) run(ctx context.Context) (*Item, error) {
+	buf := make([]byte, 2048)
+	for ctx.Err() == nil {
+		now := time.Now()
+		var inFlight int
+		for tid, n := range l.transactions {
+			if now.Sub(n.sentAt) > queryTimeout {
+				n.state = nodeFailed
+				delete(l.transactions, tid)
+				continue
+			}
+			inFlight++
+		}
+		nodes := l.closest()
+		if len(nodes) > k {
+			nodes = nodes[:k]
+		}
+		done := true
+		for _, n := range nodes {
+			if n.state != nodeResponded {
+				done = false
+			}
+			if n.state == nodeNew && inFlight < alpha {
+				err := l.send(n)
+				if err != nil {
+					n.state = nodeFailed
+					continue
+				}
+				inFlight++
+			}
+		}
+		if done || inFlight == 0 {
+			break
+		}
+
+		err := l.conn.SetReadDeadline(now.Add(queryTimeout))
+		if err != nil {
+			return nil, err
+		}
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				continue
+			}
+			return nil, err
+		}
+		l.handleMessage(buf[:n], from)
+	}
+	if l.item == nil {
+		return nil, errNotFound
+	}
+	return l.item, nil
+}
+
+func (l *lookup) send(n *node) error {
+	var tid [2]byte
+	binary.BigEndian.PutUint16(tid[:], l.nextTID)
+	l.nextTID++
+	b, err := bencode.EncodeBytes(query{
+		T: string(tid[:]),
+		Y: "q",
+		Q: "get",
+		A: queryArgs{ID: string(l.id[:]), Target: string(l.target[:])},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = l.conn.WriteToUDP(b, n.addr)
+	if err != nil {
+		return err
+	}
+	n.state = nodeQueried
+	n.sentAt = time.Now()
+	l.transactions[string(tid[:])] = n
+	return nil
+}
+
+func (l *lookup) handleMessage(b []byte, from *net.UDPAddr) {
+	var msg message
+	err := bencode.DecodeBytes(b, &msg)
+	if err != nil {
+		return
+	}
+	n, ok := l.transactions[msg.T]
+	if !ok || !n.addr.IP.Equal(from.IP) || n.addr.Port != from.Port {
+		return
+	}
+	delete(l.transactions, msg.T)
+	if msg.Y != "r" || len(msg.R.ID) != 20 {
+		n.state = nodeFailed
+		return
+	}
+	n.state = nodeResponded
+	n.distance = l.distance([]byte(msg.R.ID))
+
+	// Compact node info: 20 bytes ID, 4 bytes IP, 2 bytes port.
+	nodes := []byte(msg.R.Nodes)
+	for len(nodes) >= 26 {
+		addr := &net.UDPAddr{
+			IP:   net.IP(append([]byte(nil), nodes[20:24]...)),
+			Port: int(binary.BigEndian.Uint16(nodes[24:26])),
+		}
+		if addr.Port != 0 {
+			l.addNode(addr, l.distance(nodes[:20]))
+		}
+		nodes = nodes[26:]
+	}
+
+	if len(msg.R.V) == 0 || !bytes.Equal([]byte(msg.R.K), l.publicKey) {
+		return
+	}
+	if l.item != nil && msg.R.Seq <= l.item.Seq {
+		return
+	}
+	item, err := Verify(l.publicKey, l.salt, msg.R.Seq, msg.R.V, []byte(msg.R.Sig))
+	if err != nil {
+		return
+	}
+	l.item = item
+}
+
+func (l *lookup) distance(id []byte) [20]byte {
+	var d [20]byte
+	for i := range d {
+		d[i] = id[i] ^ l.target[i]
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package mutableresolver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+type testNode struct {
+	conn *net.UDPConn
+	id   [20]byte
+}
+
+// startTestNode runs a DHT node that answers "get" queries with the item signed with seq and the nodes in next.
+func startTestNode(t *testing.T, id byte, privateKey ed25519.PrivateKey, seq int64, ih [20]byte, next ...*testNode) *testNode {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &testNode{conn: conn}
+	n.id[0] = id
+	v, sig, err := Sign(privateKey, nil, seq, ih)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []byte
+	for _, nn := range next {
+		addr := nn.conn.LocalAddr().(*net.UDPAddr)
+		nodes = append(nodes, nn.id[:]...)
+		nodes = append(nodes, addr.IP.To4()...)
+		var port [2]byte
+		binary.BigEndian.PutUint16(port[:], uint16(addr.Port))
+		nodes = append(nodes, port[:]...)
+	}
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			l, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var q query
+			if bencode.DecodeBytes(buf[:l], &q) != nil || q.Q != "get" {
+				continue
+			}
+			b, _ := bencode.EncodeBytes(map[string]interface{}{
+				"t": q.T,
+				"y": "r",
+				"r": map[string]interface{}{
+					"id":    string(n.id[:]),
+					"nodes": string(nodes),
+					"k":     string(privateKey.Public().(ed25519.PublicKey)),
+					"seq":   seq,
+					"sig":   string(sig),
+					"v":     bencode.RawMessage(v),
+				},
+			})
+			_, _ = conn.WriteToUDP(b, from)
+		}
+	}()
+	return n
+}
+
+func TestResolve(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ih1, ih2 [20]byte
+	ih1[0] = 1
+	ih2[0] = 2
+	closer := startTestNode(t, 2, privateKey, 2, ih2)
+	defer closer.conn.Close()
+	bootstrap := startTestNode(t, 1, privateKey, 1, ih1, closer)
+	defer bootstrap.conn.Close()
+
+	r := New([]string{bootstrap.conn.LocalAddr().String()})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	item, err := r.Resolve(ctx, publicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Seq != 2 || item.InfoHash != ih2 {
+		t.Fatalf("newest item is not resolved: %+v", item)
+	}
+}
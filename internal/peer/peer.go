@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ProtocolONE/rain/internal/bitfield"
+	"github.com/ProtocolONE/rain/internal/cachedpiece"
 	"github.com/ProtocolONE/rain/internal/logger"
 	"github.com/ProtocolONE/rain/internal/mse"
 	"github.com/ProtocolONE/rain/internal/peerconn"
@@ -27,6 +28,9 @@ type Peer struct {
 	Bitfield    *bitfield.Bitfield
 	AllowedFast pieceset.PieceSet
 
+	// Pieces that the peer can download from us while it is choked.
+	ClientAllowedFast map[uint32]struct{}
+
 	ID                [20]byte
 	ExtensionsEnabled bool
 	FastEnabled       bool
@@ -40,14 +44,30 @@ type Peer struct {
 
 	OptimisticUnchoked bool
 
+	// UploadOnly means peer does not download pieces, advertised in extension handshake (BEP 21).
+	UploadOnly bool
+
 	// Snubbed means peer is sending pieces too slow.
 	Snubbed bool
 
+	// Downloading is true if at least one piece is being downloaded from the peer.
 	Downloading bool
 
+	// RAMRequested is true while a new piece download from the peer is waiting for memory.
+	RAMRequested bool
+
 	downloadSpeed metrics.EWMA
 	uploadSpeed   metrics.EWMA
 
+	// Smoothed round-trip time of block requests. Zero until first sample is taken.
+	rtt time.Duration
+	// Block requests that are sent to the peer and not answered yet.
+	requests map[blockRequest]struct{}
+	// Request that is timed for RTT estimate. It is sent while there are no other requests in flight,
+	// so the sample does not include the time waited behind other blocks in the queue of the peer.
+	rttRequest   blockRequest
+	rttRequestAt time.Time // zero if no request is timed
+
 	// Messages received while we don't have info yet are saved here.
 	Messages []interface{}
 
@@ -55,6 +75,9 @@ type Peer struct {
 
 	PEX *pex
 
+	// Keeps track of regions read for this peer to prefetch next regions from disk.
+	ReadStream *cachedpiece.Stream
+
 	snubTimeout time.Duration
 	snubTimer   *time.Timer
 
@@ -189,6 +212,67 @@ func (p *Peer) DownloadSpeed() uint {
 	return uint(p.downloadSpeed.Rate())
 }
 
+type blockRequest struct {
+	index, begin uint32
+}
+
+// requestSent records a block request. The request is timed if no other request is in flight.
+func (p *Peer) requestSent(index, begin uint32) {
+	r := blockRequest{index, begin}
+	if len(p.requests) == 0 && p.rttRequestAt.IsZero() {
+		p.rttRequest = r
+		p.rttRequestAt = time.Now()
+	}
+	if p.requests == nil {
+		p.requests = make(map[blockRequest]struct{})
+	}
+	p.requests[r] = struct{}{}
+}
+
+// requestDone removes the block request from requests in flight.
+// If the block is received for the timed request, round-trip time estimate is updated.
+func (p *Peer) requestDone(index, begin uint32, received bool) {
+	r := blockRequest{index, begin}
+	delete(p.requests, r)
+	if p.rttRequestAt.IsZero() || r != p.rttRequest {
+		return
+	}
+	if received {
+		p.addRTTSample(time.Since(p.rttRequestAt))
+	}
+	p.rttRequestAt = time.Time{}
+}
+
+func (p *Peer) addRTTSample(sample time.Duration) {
+	if p.rtt == 0 {
+		p.rtt = sample
+		return
+	}
+	// Same smoothing factor with TCP (RFC 6298).
+	p.rtt += (sample - p.rtt) / 8
+}
+
+// BlockReceived must be called when a piece message is received from the peer.
+func (p *Peer) BlockReceived(index, begin uint32) {
+	p.requestDone(index, begin, true)
+}
+
+// RequestRejected must be called when the peer rejects a block request.
+func (p *Peer) RequestRejected(index, begin uint32) {
+	p.requestDone(index, begin, false)
+}
+
+// RequestsDropped must be called when the peer chokes us without fast extension, so it drops all requests.
+func (p *Peer) RequestsDropped() {
+	p.requests = nil
+	p.rttRequestAt = time.Time{}
+}
+
+// RTT returns the estimated round-trip time of block requests.
+func (p *Peer) RTT() time.Duration {
+	return p.rtt
+}
+
 func (p *Peer) UploadSpeed() uint {
 	return uint(p.uploadSpeed.Rate())
 }
@@ -236,11 +320,13 @@ func (p *Peer) RequestMetadataPiece(index uint32) {
 func (p *Peer) RequestPiece(index, begin, length uint32) {
 	msg := peerprotocol.RequestMessage{Index: index, Begin: begin, Length: length}
 	p.SendMessage(msg)
+	p.requestSent(index, begin)
 }
 
 func (p *Peer) CancelPiece(index, begin, length uint32) {
 	msg := peerprotocol.CancelMessage{RequestMessage: peerprotocol.RequestMessage{Index: index, Begin: begin, Length: length}}
 	p.SendMessage(msg)
+	p.requestDone(index, begin, false)
 }
 
 func (p *Peer) EnabledFast() bool {
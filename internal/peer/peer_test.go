@@ -0,0 +1,47 @@
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTT(t *testing.T) {
+	p := &Peer{}
+	assert.Equal(t, time.Duration(0), p.RTT())
+
+	// First request is sent to an empty queue, so it is timed.
+	p.requestSent(0, 0)
+	p.requestSent(0, 16384)
+	time.Sleep(50 * time.Millisecond)
+	p.BlockReceived(0, 0)
+	first := p.RTT()
+	assert.True(t, first >= 50*time.Millisecond)
+
+	// Requests sent while others are in flight wait in the queue of the peer and they are not timed.
+	time.Sleep(50 * time.Millisecond)
+	p.requestSent(1, 0)
+	p.BlockReceived(0, 16384)
+	time.Sleep(50 * time.Millisecond)
+	p.BlockReceived(1, 0)
+	assert.Equal(t, first, p.RTT())
+
+	// Rejected request is not sampled.
+	p.requestSent(2, 0)
+	p.RequestRejected(2, 0)
+	assert.Equal(t, first, p.RTT())
+	assert.True(t, p.rttRequestAt.IsZero())
+
+	// Queue is empty again, so next request is timed.
+	p.requestSent(3, 0)
+	p.BlockReceived(3, 0)
+	assert.True(t, p.RTT() < first)
+
+	// Requests dropped by choke are not waited.
+	p.requestSent(4, 0)
+	p.requestSent(4, 16384)
+	p.RequestsDropped()
+	p.requestSent(5, 0)
+	assert.Equal(t, blockRequest{5, 0}, p.rttRequest)
+}
@@ -70,8 +70,9 @@ func (p *Conn) SendMessage(msg peerprotocol.Message) {
 // SendPiece queues a piece message for sending. Does not block.
 // Piece data is read just before the message is sent.
 // If queued messages greater than `maxRequestsIn` specified in constructor, the last message is dropped.
-func (p *Conn) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt) {
-	p.writer.SendPiece(msg, pi)
+// Pieces in allowed fast set of the peer are not dropped when the peer is choked.
+func (p *Conn) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt, allowedFast bool) {
+	p.writer.SendPiece(msg, pi, allowedFast)
 }
 
 // CancelRequest removes previously queued piece message matching msg.
@@ -208,6 +208,13 @@ func (p *PeerReader) Run() {
 				return
 			}
 			msg = am
+		case peerprotocol.Suggest:
+			var sm peerprotocol.SuggestMessage
+			err = binary.Read(p.r, binary.BigEndian, &sm)
+			if err != nil {
+				return
+			}
+			msg = sm
 		case peerprotocol.Port:
 			var pm peerprotocol.PortMessage
 			err = binary.Read(p.r, binary.BigEndian, &pm)
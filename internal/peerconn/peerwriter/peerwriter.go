@@ -59,8 +59,8 @@ func (p *PeerWriter) SendMessage(msg peerprotocol.Message) {
 	}
 }
 
-func (p *PeerWriter) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt) {
-	m := Piece{Data: pi, RequestMessage: msg}
+func (p *PeerWriter) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt, allowedFast bool) {
+	m := Piece{Data: pi, RequestMessage: msg, AllowedFast: allowedFast}
 	select {
 	case p.queueC <- m:
 	case <-p.doneC:
@@ -134,11 +134,19 @@ func (p *PeerWriter) queueMessage(msg peerprotocol.Message) {
 	p.writeQueue.PushBack(msg)
 }
 
+// cancelQueuedPieceMessages drops queued piece messages when the peer is choked.
+// Pieces in allowed fast set are kept and others are rejected if the peer supports fast extension.
 func (p *PeerWriter) cancelQueuedPieceMessages() {
 	var next *list.Element
 	for e := p.writeQueue.Front(); e != nil; e = next {
 		next = e.Next()
-		if _, ok := e.Value.(Piece); ok {
+		if pi, ok := e.Value.(Piece); ok {
+			if pi.AllowedFast {
+				continue
+			}
+			if p.fastEnabled {
+				p.writeQueue.InsertBefore(peerprotocol.RejectMessage{RequestMessage: pi.RequestMessage}, e)
+			}
 			p.writeQueue.Remove(e)
 			p.currentQueuedRequests--
 		}
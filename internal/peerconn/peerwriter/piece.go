@@ -10,6 +10,8 @@ import (
 type Piece struct {
 	Data io.ReaderAt
 	peerprotocol.RequestMessage
+	// Piece is in the allowed fast set of the peer. It is sent even if the peer is choked.
+	AllowedFast bool
 }
 
 func (p Piece) ID() peerprotocol.MessageID { return peerprotocol.Piece }
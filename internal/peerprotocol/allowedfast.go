@@ -0,0 +1,52 @@
+package peerprotocol
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"encoding/binary"
+	"net"
+)
+
+// AllowedFastSet generates the set of pieces that a peer with ip can download while it is choked,
+// with the canonical algorithm in BEP 6.
+// IPv4 addresses are masked to /24 as in the specification and IPv6 addresses are masked to /64.
+// At most k pieces are returned.
+func AllowedFastSet(ip net.IP, infoHash []byte, numPieces uint32, k int) []uint32 {
+	if numPieces == 0 || k <= 0 {
+		return nil
+	}
+	if uint32(k) > numPieces {
+		k = int(numPieces)
+	}
+	var x []byte
+	if ip4 := ip.To4(); ip4 != nil {
+		x = append(x, ip4[0], ip4[1], ip4[2], 0)
+	} else if ip16 := ip.To16(); ip16 != nil {
+		x = append(x, ip16[:8]...)
+		x = append(x, make([]byte, 8)...)
+	} else {
+		return nil
+	}
+	x = append(x, infoHash...)
+	ret := make([]uint32, 0, k)
+	for len(ret) < k {
+		sum := sha1.Sum(x) // nolint: gosec
+		x = sum[:]
+		for i := 0; i < 5 && len(ret) < k; i++ {
+			y := binary.BigEndian.Uint32(x[i*4 : i*4+4])
+			index := y % numPieces
+			if !containsIndex(ret, index) {
+				ret = append(ret, index)
+			}
+		}
+	}
+	return ret
+}
+
+func containsIndex(a []uint32, index uint32) bool {
+	for _, i := range a {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
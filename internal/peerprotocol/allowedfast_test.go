@@ -0,0 +1,22 @@
+package peerprotocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowedFastSet(t *testing.T) {
+	// Test vectors from BEP 6
+	infoHash := bytes.Repeat([]byte{0xaa}, 20)
+	ip := net.ParseIP("80.4.4.200")
+	assert.Equal(t, []uint32{1059, 431, 808, 1217, 287, 376, 1188}, AllowedFastSet(ip, infoHash, 1313, 7))
+	assert.Equal(t, []uint32{1059, 431, 808, 1217, 287, 376, 1188, 353, 508}, AllowedFastSet(ip, infoHash, 1313, 9))
+
+	assert.Len(t, AllowedFastSet(ip, infoHash, 3, 10), 3)
+	assert.Empty(t, AllowedFastSet(ip, infoHash, 0, 10))
+
+	assert.Equal(t, MessageID(AllowedFast), AllowedFastMessage{}.ID())
+}
@@ -14,11 +14,19 @@ const (
 	ExtensionIDHandshake = iota
 	ExtensionIDMetadata
 	ExtensionIDPEX
+	ExtensionIDDontHave
+	ExtensionIDHolepunch
 )
 
+// ExtensionIDFirstCustom is the first ID that is assigned to extensions registered by the user.
+// IDs below are reserved for the extensions implemented in this package.
+const ExtensionIDFirstCustom = 128
+
 const (
-	ExtensionKeyMetadata = "ut_metadata"
-	ExtensionKeyPEX      = "ut_pex"
+	ExtensionKeyMetadata  = "ut_metadata"
+	ExtensionKeyPEX       = "ut_pex"
+	ExtensionKeyDontHave  = "lt_donthave"
+	ExtensionKeyHolepunch = "ut_holepunch"
 )
 
 const (
@@ -44,6 +52,28 @@ func (m ExtensionMessage) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return
 	}
+	if dm, ok := m.Payload.(ExtensionDontHaveMessage); ok {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], dm.Index)
+		nn, err = w.Write(b[:])
+		n += int64(nn)
+		return
+	}
+	if hm, ok := m.Payload.(ExtensionHolepunchMessage); ok {
+		var b []byte
+		b, err = hm.MarshalBinary()
+		if err != nil {
+			return
+		}
+		nn, err = w.Write(b)
+		n += int64(nn)
+		return
+	}
+	if cm, ok := m.Payload.(ExtensionCustomMessage); ok {
+		nn, err = w.Write(cm.Data)
+		n += int64(nn)
+		return
+	}
 	wc := newWriterCounter(w)
 	err = bencode.NewEncoder(wc).Encode(m.Payload)
 	n += wc.Count()
@@ -71,13 +101,17 @@ func (m *ExtensionMessage) UnmarshalBinary(data []byte) error {
 	case ExtensionIDHandshake:
 		var extMsg ExtensionHandshakeMessage
 		err = dec.Decode(&extMsg)
-		m.Payload = extMsg
+		if err != nil {
+			return err
+		}
 		if extMsg.MetadataSize < 0 {
 			extMsg.MetadataSize = 0
 		}
 		if extMsg.RequestQueue < 0 {
 			extMsg.RequestQueue = 0
 		}
+		extMsg.Extra, err = extraHandshakeKeys(payload)
+		m.Payload = extMsg
 	case ExtensionIDMetadata:
 		var extMsg ExtensionMetadataMessage
 		err = dec.Decode(&extMsg)
@@ -87,8 +121,20 @@ func (m *ExtensionMessage) UnmarshalBinary(data []byte) error {
 		var extMsg ExtensionPEXMessage
 		err = dec.Decode(&extMsg)
 		m.Payload = extMsg
+	case ExtensionIDDontHave:
+		if len(payload) != 4 {
+			return fmt.Errorf("invalid lt_donthave message length: %d", len(payload))
+		}
+		m.Payload = ExtensionDontHaveMessage{Index: binary.BigEndian.Uint32(payload)}
+	case ExtensionIDHolepunch:
+		var extMsg ExtensionHolepunchMessage
+		err = extMsg.UnmarshalBinary(payload)
+		m.Payload = extMsg
 	default:
-		return fmt.Errorf("peer sent invalid extension message id: %d", m.ExtendedMessageID)
+		if m.ExtendedMessageID < ExtensionIDFirstCustom {
+			return fmt.Errorf("peer sent invalid extension message id: %d", m.ExtendedMessageID)
+		}
+		m.Payload = ExtensionCustomMessage{ExtendedMessageID: m.ExtendedMessageID, Data: payload}
 	}
 	return err
 }
@@ -99,13 +145,59 @@ type ExtensionHandshakeMessage struct {
 	YourIP       string           `bencode:"yourip,omitempty"`
 	MetadataSize int              `bencode:"metadata_size,omitempty"`
 	RequestQueue int              `bencode:"reqq"`
+	// Set to 1 if the client does not download the torrent (BEP 21).
+	UploadOnly int `bencode:"upload_only,omitempty"`
+	// Keys in handshake dictionary other than the fields above.
+	// Filled when the message is decoded and added to the dictionary when the message is encoded.
+	Extra map[string]interface{} `bencode:"-"`
+}
+
+// handshakeKeys are the keys of the fields in ExtensionHandshakeMessage.
+var handshakeKeys = []string{"m", "v", "yourip", "metadata_size", "reqq", "upload_only"}
+
+// MarshalBencode encodes the handshake with the keys in Extra.
+// Keys of the fields cannot be overridden with Extra.
+func (m ExtensionHandshakeMessage) MarshalBencode() ([]byte, error) {
+	type handshake ExtensionHandshakeMessage
+	b, err := bencode.EncodeBytes(handshake(m))
+	if err != nil || len(m.Extra) == 0 {
+		return b, err
+	}
+	var d map[string]interface{}
+	err = bencode.DecodeBytes(b, &d)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range m.Extra {
+		if _, ok := d[k]; !ok {
+			d[k] = v
+		}
+	}
+	return bencode.EncodeBytes(d)
+}
+
+func extraHandshakeKeys(payload []byte) (map[string]interface{}, error) {
+	var d map[string]interface{}
+	err := bencode.DecodeBytes(payload, &d)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range handshakeKeys {
+		delete(d, k)
+	}
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return d, nil
 }
 
 func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int) ExtensionHandshakeMessage {
 	return ExtensionHandshakeMessage{
 		M: map[string]uint8{
-			ExtensionKeyMetadata: ExtensionIDMetadata,
-			ExtensionKeyPEX:      ExtensionIDPEX,
+			ExtensionKeyMetadata:  ExtensionIDMetadata,
+			ExtensionKeyPEX:       ExtensionIDPEX,
+			ExtensionKeyDontHave:  ExtensionIDDontHave,
+			ExtensionKeyHolepunch: ExtensionIDHolepunch,
 		},
 		V:            version,
 		YourIP:       string(truncateIP(yourip)),
@@ -121,6 +213,19 @@ type ExtensionMetadataMessage struct {
 	Data      []byte `bencode:"-"`
 }
 
+// ExtensionDontHaveMessage tells that the peer does not have the piece anymore (BEP 54).
+// Unlike other extension messages, it is not bencoded.
+type ExtensionDontHaveMessage struct {
+	Index uint32
+}
+
+// ExtensionCustomMessage is a message of an extension that is registered by the user.
+// Data is not decoded because the format of the message is defined by the extension.
+type ExtensionCustomMessage struct {
+	ExtendedMessageID uint8
+	Data              []byte
+}
+
 type ExtensionPEXMessage struct {
 	Added   string `bencode:"added"`
 	Dropped string `bencode:"dropped"`
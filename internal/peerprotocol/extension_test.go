@@ -0,0 +1,67 @@
+package peerprotocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtensionHandshakeExtra(t *testing.T) {
+	hs := NewExtensionHandshake(100, "rain", net.ParseIP("1.2.3.4"), 250)
+	hs.M["x_test"] = ExtensionIDFirstCustom
+	hs.Extra = map[string]interface{}{"x_key": "value", "reqq": 1}
+
+	var buf bytes.Buffer
+	_, err := ExtensionMessage{ExtendedMessageID: ExtensionIDHandshake, Payload: hs}.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	var m ExtensionMessage
+	assert.NoError(t, m.UnmarshalBinary(buf.Bytes()))
+	hs2 := m.Payload.(ExtensionHandshakeMessage)
+	assert.Equal(t, 250, hs2.RequestQueue)
+	assert.Equal(t, uint8(ExtensionIDFirstCustom), hs2.M["x_test"])
+	assert.Equal(t, map[string]interface{}{"x_key": "value"}, hs2.Extra)
+}
+
+func TestExtensionCustomMessage(t *testing.T) {
+	var buf bytes.Buffer
+	msg := ExtensionMessage{ExtendedMessageID: ExtensionIDFirstCustom + 1, Payload: ExtensionCustomMessage{Data: []byte("raw")}}
+	_, err := msg.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	var m ExtensionMessage
+	assert.NoError(t, m.UnmarshalBinary(buf.Bytes()))
+	assert.Equal(t, ExtensionCustomMessage{ExtendedMessageID: ExtensionIDFirstCustom + 1, Data: []byte("raw")}, m.Payload)
+
+	assert.Error(t, m.UnmarshalBinary([]byte{ExtensionIDFirstCustom - 1}))
+}
+
+func TestExtensionDontHaveMessage(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := ExtensionMessage{ExtendedMessageID: ExtensionIDDontHave, Payload: ExtensionDontHaveMessage{Index: 7}}.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{ExtensionIDDontHave, 0, 0, 0, 7}, buf.Bytes())
+
+	var m ExtensionMessage
+	assert.NoError(t, m.UnmarshalBinary(buf.Bytes()))
+	assert.Equal(t, ExtensionDontHaveMessage{Index: 7}, m.Payload)
+	assert.Error(t, m.UnmarshalBinary([]byte{ExtensionIDDontHave, 0, 7}))
+}
+
+func TestExtensionHandshakeUploadOnly(t *testing.T) {
+	hs := NewExtensionHandshake(0, "rain", net.ParseIP("1.2.3.4"), 250)
+	hs.UploadOnly = 1
+
+	var buf bytes.Buffer
+	_, err := ExtensionMessage{ExtendedMessageID: ExtensionIDHandshake, Payload: hs}.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	var m ExtensionMessage
+	assert.NoError(t, m.UnmarshalBinary(buf.Bytes()))
+	hs2 := m.Payload.(ExtensionHandshakeMessage)
+	assert.Equal(t, 1, hs2.UploadOnly)
+	assert.Equal(t, uint8(ExtensionIDDontHave), hs2.M[ExtensionKeyDontHave])
+	assert.Nil(t, hs2.Extra)
+}
@@ -0,0 +1,98 @@
+package peerprotocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Message types of ut_holepunch extension (BEP 55).
+const (
+	HolepunchRendezvous = iota
+	HolepunchConnect
+	HolepunchError
+)
+
+// Error codes of ut_holepunch extension (BEP 55).
+const (
+	HolepunchNoSuchPeer = iota + 1
+	HolepunchNotConnected
+	HolepunchNoSupport
+	HolepunchNoSelf
+)
+
+const (
+	holepunchAddrIPv4 = 0
+	holepunchAddrIPv6 = 1
+)
+
+var errInvalidHolepunchMessage = errors.New("invalid ut_holepunch message")
+
+// ExtensionHolepunchMessage is used for connecting two peers behind NAT through a peer that is connected to both (BEP 55).
+// Unlike other extension messages, it is not bencoded.
+type ExtensionHolepunchMessage struct {
+	Type    uint8
+	Addr    *net.TCPAddr
+	ErrCode uint32
+}
+
+func (m ExtensionHolepunchMessage) MarshalBinary() ([]byte, error) {
+	var addrType uint8
+	ip := m.Addr.IP.To4()
+	if ip == nil {
+		addrType = holepunchAddrIPv6
+		ip = m.Addr.IP.To16()
+		if ip == nil {
+			return nil, errInvalidHolepunchMessage
+		}
+	}
+	b := make([]byte, 2+len(ip)+2+4)
+	b[0] = m.Type
+	b[1] = addrType
+	n := 2 + copy(b[2:], ip)
+	binary.BigEndian.PutUint16(b[n:n+2], uint16(m.Addr.Port))
+	binary.BigEndian.PutUint32(b[n+2:n+6], m.ErrCode)
+	return b, nil
+}
+
+func (m *ExtensionHolepunchMessage) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 {
+		return errInvalidHolepunchMessage
+	}
+	var ipLen int
+	switch b[1] {
+	case holepunchAddrIPv4:
+		ipLen = net.IPv4len
+	case holepunchAddrIPv6:
+		ipLen = net.IPv6len
+	default:
+		return errInvalidHolepunchMessage
+	}
+	if len(b) != 2+ipLen+2+4 {
+		return errInvalidHolepunchMessage
+	}
+	m.Type = b[0]
+	m.Addr = &net.TCPAddr{
+		IP:   append(net.IP(nil), b[2:2+ipLen]...),
+		Port: int(binary.BigEndian.Uint16(b[2+ipLen : 2+ipLen+2])),
+	}
+	m.ErrCode = binary.BigEndian.Uint32(b[2+ipLen+2:])
+	return nil
+}
+
+// HolepunchErrorString returns the description of an error code in ut_holepunch error message.
+func HolepunchErrorString(code uint32) string {
+	switch code {
+	case HolepunchNoSuchPeer:
+		return "target endpoint is invalid"
+	case HolepunchNotConnected:
+		return "relaying peer is not connected to the target peer"
+	case HolepunchNoSupport:
+		return "target peer does not support holepunch extension"
+	case HolepunchNoSelf:
+		return "target endpoint belongs to the relaying peer"
+	default:
+		return fmt.Sprintf("unknown error code: %d", code)
+	}
+}
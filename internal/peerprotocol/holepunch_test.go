@@ -0,0 +1,37 @@
+package peerprotocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolepunchMessage(t *testing.T) {
+	msg := ExtensionHolepunchMessage{
+		Type:    HolepunchError,
+		Addr:    &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 6881},
+		ErrCode: HolepunchNotConnected,
+	}
+	var buf bytes.Buffer
+	_, err := ExtensionMessage{ExtendedMessageID: ExtensionIDHolepunch, Payload: msg}.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{ExtensionIDHolepunch, 2, 0, 1, 2, 3, 4, 0x1a, 0xe1, 0, 0, 0, 2}, buf.Bytes())
+
+	var m ExtensionMessage
+	assert.NoError(t, m.UnmarshalBinary(buf.Bytes()))
+	msg2 := m.Payload.(ExtensionHolepunchMessage)
+	assert.Equal(t, msg.Type, msg2.Type)
+	assert.Equal(t, msg.ErrCode, msg2.ErrCode)
+	assert.Equal(t, "1.2.3.4:6881", msg2.Addr.String())
+
+	msg.Addr = &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}
+	b, err := msg.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Len(t, b, 2+16+2+4)
+	assert.NoError(t, msg2.UnmarshalBinary(b))
+	assert.Equal(t, "[2001:db8::1]:6881", msg2.Addr.String())
+
+	assert.Error(t, msg2.UnmarshalBinary([]byte{0, 0, 1, 2}))
+}
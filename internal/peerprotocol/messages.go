@@ -80,6 +80,7 @@ func (m emptyMessage) Read(b []byte) (int, error) {
 }
 
 type AllowedFastMessage struct{ HaveMessage }
+type SuggestMessage struct{ HaveMessage }
 
 type ChokeMessage struct{ emptyMessage }
 type UnchokeMessage struct{ emptyMessage }
@@ -98,3 +99,5 @@ func (m HaveAllMessage) ID() MessageID       { return HaveAll }
 func (m HaveNoneMessage) ID() MessageID      { return HaveNone }
 func (m RejectMessage) ID() MessageID        { return Reject }
 func (m CancelMessage) ID() MessageID        { return Cancel }
+func (m AllowedFastMessage) ID() MessageID   { return AllowedFast }
+func (m SuggestMessage) ID() MessageID       { return Suggest }
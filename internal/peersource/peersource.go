@@ -8,6 +8,7 @@ const (
 	PEX
 	Manual
 	Incoming
+	Holepunch
 )
 
 func (s Source) String() string {
@@ -22,6 +23,8 @@ func (s Source) String() string {
 		return "manual"
 	case Incoming:
 		return "incoming"
+	case Holepunch:
+		return "holepunch"
 	default:
 		panic("unhandled source")
 	}
@@ -2,6 +2,8 @@ package piececache
 
 import (
 	"container/heap"
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,6 +15,7 @@ type Cache struct {
 	size, maxSize int64
 	ttl           time.Duration
 	items         map[string]*item
+	groups        map[string]*GroupStats
 	accessList    accessList
 	m             sync.RWMutex
 	sem           *semaphore.Semaphore
@@ -21,22 +24,34 @@ type Cache struct {
 	numTotal    metrics.EWMA
 	numLoad     metrics.EWMA
 	loadedBytes metrics.EWMA
+	numPrefetch metrics.EWMA
 
 	closeC chan struct{}
 }
 
 type Loader func() ([]byte, error)
 
+// MultiLoader loads the values of keys[begin:end] passed to Prefetch in a single operation.
+type MultiLoader func(begin, end int) ([][]byte, error)
+
+// GroupStats contains the number and size of cached items that belong to the same group.
+type GroupStats struct {
+	Items int
+	Size  int64
+}
+
 func New(maxSize int64, ttl time.Duration, parallelReads uint) *Cache {
 	c := &Cache{
 		maxSize:     maxSize,
 		ttl:         ttl,
 		items:       make(map[string]*item),
+		groups:      make(map[string]*GroupStats),
 		sem:         semaphore.New(int(parallelReads)),
 		numCached:   metrics.NewEWMA1(),
 		numTotal:    metrics.NewEWMA1(),
 		numLoad:     metrics.NewEWMA1(),
 		loadedBytes: metrics.NewEWMA1(),
+		numPrefetch: metrics.NewEWMA1(),
 		closeC:      make(chan struct{}),
 	}
 	go c.tick()
@@ -53,6 +68,7 @@ func (c *Cache) tick() {
 			c.numTotal.Tick()
 			c.numLoad.Tick()
 			c.loadedBytes.Tick()
+			c.numPrefetch.Tick()
 		case <-c.closeC:
 			return
 		}
@@ -66,6 +82,7 @@ func (c *Cache) Close() {
 func (c *Cache) Clear() {
 	c.m.Lock()
 	c.items = make(map[string]*item)
+	c.groups = make(map[string]*GroupStats)
 	for _, i := range c.accessList {
 		i.timer.Stop()
 	}
@@ -88,6 +105,10 @@ func (c *Cache) LoadedBytesPerSecond() int {
 	return int(c.loadedBytes.Rate())
 }
 
+func (c *Cache) PrefetchesPerSecond() int {
+	return int(c.numPrefetch.Rate())
+}
+
 func (c *Cache) LoadsActive() int {
 	return (c.sem.Len())
 }
@@ -110,12 +131,67 @@ func (c *Cache) Utilization() int {
 	return int((100 * c.numCached.Rate()) / total)
 }
 
+// Groups returns the stats of cached items for each group.
+func (c *Cache) Groups() map[string]GroupStats {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	ret := make(map[string]GroupStats, len(c.groups))
+	for name, g := range c.groups {
+		ret[name] = *g
+	}
+	return ret
+}
+
+// Keys returns the keys of the cached items in group, most recently accessed first.
+func (c *Cache) Keys(group string) []string {
+	c.m.RLock()
+	items := make([]*item, 0, len(c.accessList))
+	for _, i := range c.accessList {
+		if i.group == group {
+			items = append(items, i)
+		}
+	}
+	sort.Slice(items, func(a, b int) bool { return items[a].lastAccessed.After(items[b].lastAccessed) })
+	c.m.RUnlock()
+	keys := make([]string, len(items))
+	for n, i := range items {
+		keys[n] = i.key
+	}
+	return keys
+}
+
+// RemoveGroup removes the items in group from the cache.
+// Values that are being loaded are returned to the callers waiting for them but they are not cached.
+func (c *Cache) RemoveGroup(group string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var items []*item
+	for _, i := range c.accessList {
+		if i.group == group {
+			items = append(items, i)
+		}
+	}
+	for _, i := range items {
+		c.removeItem(i)
+	}
+	for key, i := range c.items {
+		if i.group == group {
+			delete(c.items, key)
+		}
+	}
+}
+
 func (c *Cache) Get(key string, loader Loader) ([]byte, error) {
-	i := c.getItem(key)
+	return c.GetGroup("", key, loader)
+}
+
+// GetGroup is same as Get but the loaded value is accounted in the stats of group.
+func (c *Cache) GetGroup(group, key string, loader Loader) ([]byte, error) {
+	i := c.getItem(group, key)
 	return c.getValue(i, loader)
 }
 
-func (c *Cache) getItem(key string) *item {
+func (c *Cache) getItem(group, key string) *item {
 	c.m.Lock()
 	defer c.m.Unlock()
 
@@ -125,12 +201,82 @@ func (c *Cache) getItem(key string) *item {
 	if ok {
 		c.numCached.Update(1)
 	} else {
-		i = &item{key: key}
+		i = &item{key: key, group: group}
 		c.items[key] = i
 	}
 	return i
 }
 
+// Prefetch loads the values of keys in background.
+// Keys at the beginning that are already in the cache are skipped.
+// Remaining keys up to the next cached key are loaded with a single call to loader,
+// so concurrent requests for adjacent keys wait for the same read operation.
+func (c *Cache) Prefetch(group string, keys []string, loader MultiLoader) {
+	begin, items := c.newItems(group, keys)
+	if len(items) == 0 {
+		return
+	}
+	c.numPrefetch.Update(1)
+	go c.loadItems(items, func() ([][]byte, error) {
+		return loader(begin, begin+len(items))
+	})
+}
+
+// newItems returns locked new items for the first run of keys that are not in the cache.
+func (c *Cache) newItems(group string, keys []string) (begin int, items []*item) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for begin < len(keys) {
+		if _, ok := c.items[keys[begin]]; !ok {
+			break
+		}
+		begin++
+	}
+	for _, key := range keys[begin:] {
+		if _, ok := c.items[key]; ok {
+			break
+		}
+		i := &item{key: key, group: group}
+		// Lock before adding to the map so Get calls wait until it is loaded.
+		i.Lock()
+		c.items[key] = i
+		items = append(items, i)
+	}
+	return
+}
+
+func (c *Cache) loadItems(items []*item, loader func() ([][]byte, error)) {
+	c.sem.Wait()
+	values, err := loader()
+	c.sem.Signal()
+	if err == nil && len(values) != len(items) {
+		err = errors.New("invalid number of values loaded")
+	}
+	if err != nil {
+		// Items are left not loaded, so callers waiting for them try their own loader.
+		c.m.Lock()
+		for _, i := range items {
+			if c.items[i.key] == i {
+				delete(c.items, i.key)
+			}
+		}
+		c.m.Unlock()
+		for _, i := range items {
+			i.Unlock()
+		}
+		return
+	}
+	for n, i := range items {
+		i.value = values[n]
+		c.numLoad.Update(1)
+		c.loadedBytes.Update(int64(len(i.value)))
+		i.loaded = true
+		_, _ = c.handleNewItem(i)
+		i.Unlock()
+	}
+}
+
 func (c *Cache) getValue(i *item, loader Loader) ([]byte, error) {
 	i.Lock()
 	defer i.Unlock()
@@ -157,6 +303,11 @@ func (c *Cache) handleNewItem(i *item) ([]byte, error) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	// Item may be removed by RemoveGroup while it is being loaded.
+	if c.items[i.key] != i {
+		return i.value, i.err
+	}
+
 	if i.err != nil {
 		delete(c.items, i.key)
 		return nil, i.err
@@ -171,6 +322,13 @@ func (c *Cache) handleNewItem(i *item) ([]byte, error) {
 	c.makeRoom(i)
 
 	c.size += int64(len(i.value))
+	g, ok := c.groups[i.group]
+	if !ok {
+		g = new(GroupStats)
+		c.groups[i.group] = g
+	}
+	g.Items++
+	g.Size += int64(len(i.value))
 
 	i.lastAccessed = time.Now()
 	heap.Push(&c.accessList, i)
@@ -208,4 +366,11 @@ func (c *Cache) removeItem(i *item) {
 	delete(c.items, i.key)
 	heap.Remove(&c.accessList, i.index)
 	c.size -= int64(len(i.value))
+	if g, ok := c.groups[i.group]; ok {
+		g.Items--
+		g.Size -= int64(len(i.value))
+		if g.Items == 0 {
+			delete(c.groups, i.group)
+		}
+	}
 }
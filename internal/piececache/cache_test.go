@@ -256,3 +256,143 @@ func TestClear(t *testing.T) {
 
 	time.Sleep(ttl + 10*time.Millisecond)
 }
+
+func TestPrefetch(t *testing.T) {
+	c := New(100, time.Minute, 1)
+
+	_, err := c.GetGroup("t1", "a", func() ([]byte, error) { return []byte("1"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loadedC := make(chan []int, 1)
+	c.Prefetch("t1", []string{"a", "b", "c"}, func(begin, end int) ([][]byte, error) {
+		loadedC <- []int{begin, end}
+		return [][]byte{[]byte("22"), []byte("333")}, nil
+	})
+
+	// Get must wait for the prefetch to complete instead of loading again.
+	val, err := c.GetGroup("t1", "c", func() ([]byte, error) {
+		t.Fatal("must not load")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "333" {
+		t.FailNow()
+	}
+	loaded := <-loadedC
+	if loaded[0] != 1 || loaded[1] != 3 {
+		t.Fatalf("unexpected range: %v", loaded)
+	}
+	g := c.Groups()["t1"]
+	if g.Items != 3 || g.Size != 6 {
+		t.Fatalf("unexpected group stats: %#v", g)
+	}
+}
+
+func TestPrefetchError(t *testing.T) {
+	c := New(100, time.Minute, 1)
+
+	releaseC := make(chan struct{})
+	c.Prefetch("t1", []string{"a", "b"}, func(begin, end int) ([][]byte, error) {
+		<-releaseC
+		return nil, errors.New("read error")
+	})
+
+	// Get waits for the prefetch and loads the value itself after the prefetch fails.
+	valC := make(chan []byte, 1)
+	go func() {
+		val, err := c.GetGroup("t1", "b", func() ([]byte, error) { return []byte("22"), nil })
+		if err != nil {
+			t.Error(err)
+		}
+		valC <- val
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(releaseC)
+	if val := <-valC; string(val) != "22" {
+		t.Fatalf("unexpected value: %q", val)
+	}
+
+	val, err := c.GetGroup("t1", "a", func() ([]byte, error) { return []byte("1"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "1" {
+		t.Fatalf("unexpected value: %q", val)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := New(100, time.Minute, 1)
+	defer c.Close()
+
+	loader := func() ([]byte, error) { return []byte("x"), nil }
+	for _, key := range []string{"a", "b", "c"} {
+		group := "g1"
+		if key == "b" {
+			group = "g2"
+		}
+		_, err := c.GetGroup(group, key, loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	keys := c.Keys("g1")
+	if len(keys) != 2 || keys[0] != "c" || keys[1] != "a" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if len(c.Keys("g3")) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestRemoveGroup(t *testing.T) {
+	c := New(100, time.Minute, 1)
+	defer c.Close()
+
+	loader := func() ([]byte, error) { return []byte("x"), nil }
+	for _, key := range []string{"a", "b"} {
+		_, err := c.GetGroup("g1", key, loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := c.GetGroup("g2", "c", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Item that is loading while the group is removed must not be cached.
+	startC := make(chan struct{})
+	continueC := make(chan struct{})
+	c.Prefetch("g1", []string{"d"}, func(begin, end int) ([][]byte, error) {
+		close(startC)
+		<-continueC
+		return [][]byte{[]byte("old")}, nil
+	})
+	<-startC
+
+	c.RemoveGroup("g1")
+	close(continueC)
+
+	if _, ok := c.Groups()["g1"]; ok {
+		t.Fatal("group is not removed")
+	}
+	if g := c.Groups()["g2"]; g.Items != 1 {
+		t.Fatalf("other group is changed: %#v", g)
+	}
+	val, err := c.GetGroup("g1", "d", func() ([]byte, error) { return []byte("new"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "new" {
+		t.Fatalf("removed value is returned: %s", val)
+	}
+	if c.Len() != 2 || c.Size() != 4 {
+		t.Fatalf("unexpected cache state: %d items %d bytes", c.Len(), c.Size())
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 type item struct {
 	key          string
+	group        string
 	value        []byte
 	loaded       bool
 	err          error
@@ -22,6 +22,7 @@ type PieceDownloader struct {
 	remaining []int
 	pending   map[int]struct{} // in-flight requests
 	done      map[int]struct{} // downloaded requests
+	sources   []interface{}    // senders of downloaded blocks
 }
 
 type Peer interface {
@@ -43,6 +44,7 @@ func New(pi *piece.Piece, pe Peer, allowedFast bool, buf bufferpool.Buffer) *Pie
 		remaining:   remaining,
 		pending:     make(map[int]struct{}),
 		done:        make(map[int]struct{}),
+		sources:     make([]interface{}, pi.NumBlocks()),
 	}
 }
 
@@ -70,9 +72,37 @@ func (d *PieceDownloader) GotBlock(block piece.Block, data []byte) error {
 	copy(d.Buffer.Data[block.Begin:block.Begin+block.Length], data)
 	delete(d.pending, block.Index)
 	d.done[block.Index] = struct{}{}
+	d.sources[block.Index] = d.Peer
 	return err
 }
 
+// MergeBlock copies the block received by another download of the same piece from source.
+// Pending request for the block is cancelled. Returns false if the block is already downloaded.
+func (d *PieceDownloader) MergeBlock(block piece.Block, data []byte, source interface{}) bool {
+	if _, ok := d.done[block.Index]; ok {
+		return false
+	}
+	if _, ok := d.pending[block.Index]; ok {
+		d.Peer.CancelPiece(d.Piece.Index, block.Begin, block.Length)
+		delete(d.pending, block.Index)
+	}
+	for i, idx := range d.remaining {
+		if idx == block.Index {
+			d.remaining = append(d.remaining[:i:i], d.remaining[i+1:]...)
+			break
+		}
+	}
+	copy(d.Buffer.Data[block.Begin:block.Begin+block.Length], data)
+	d.done[block.Index] = struct{}{}
+	d.sources[block.Index] = source
+	return true
+}
+
+// BlockSources returns the senders of the blocks of the piece in block order.
+func (d *PieceDownloader) BlockSources() []interface{} {
+	return append([]interface{}(nil), d.sources...)
+}
+
 func (d *PieceDownloader) Rejected(block piece.Block) {
 	delete(d.pending, block.Index)
 	d.remaining = append(d.remaining, block.Index)
@@ -106,6 +136,11 @@ func (d *PieceDownloader) RequestBlocks(queueLength int) {
 	}
 }
 
+// Pending returns the number of requested blocks that are not received yet.
+func (d *PieceDownloader) Pending() int {
+	return len(d.pending)
+}
+
 func (d *PieceDownloader) Done() bool {
 	return len(d.done) == d.Piece.NumBlocks()
 }
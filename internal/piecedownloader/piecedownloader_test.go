@@ -144,3 +144,29 @@ func TestPieceDownloader(t *testing.T) {
 	assert.Equal(t, 11, len(d.done))
 	assert.True(t, d.Done())
 }
+
+func TestMergeBlock(t *testing.T) {
+	bp := bufferpool.New(3 * blockSize)
+	pi := &piece.Piece{
+		Index:  0,
+		Length: 3 * blockSize,
+	}
+	pe1, pe2 := &TestPeer{}, &TestPeer{}
+	d := New(pi, pe1, false, bp.Get(3*blockSize))
+	d.RequestBlocks(1)
+	assert.Nil(t, d.GotBlock(piece.Block{Index: 0, Begin: 0, Length: blockSize}, make([]byte, blockSize)))
+	d.RequestBlocks(1)
+
+	// Pending block is cancelled.
+	assert.True(t, d.MergeBlock(piece.Block{Index: 1, Begin: blockSize, Length: blockSize}, make([]byte, blockSize), pe2))
+	assert.Equal(t, []Message{{Index: 0, Begin: blockSize, Length: blockSize}}, pe1.canceled)
+	assert.Equal(t, 0, d.Pending())
+	assert.False(t, d.MergeBlock(piece.Block{Index: 0, Begin: 0, Length: blockSize}, make([]byte, blockSize), pe2))
+
+	// Remaining block is not requested.
+	assert.True(t, d.MergeBlock(piece.Block{Index: 2, Begin: 2 * blockSize, Length: blockSize}, make([]byte, blockSize), pe2))
+	d.RequestBlocks(1)
+	assert.Len(t, pe1.requested, 2)
+	assert.True(t, d.Done())
+	assert.Equal(t, []interface{}{pe1, pe2, pe2}, d.BlockSources())
+}
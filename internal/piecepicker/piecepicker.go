@@ -20,6 +20,7 @@ These are the things to consider when selecting a piece for downloading:
   * Peer is choking us
   * Piece is marked as allowed-fast
   * Piece is requested from another peers
+  * Piece is already requested from the same peer
   * Piece is reserved for downloading by a webseed source
   * Is endgame mode activated (all pieces are requested)
   * Are there stalled peers (snubbed or choked in the middle of download)
@@ -67,6 +68,11 @@ func (p *myPiece) AvailableForWebseed(duplicate bool) bool {
 	return true
 }
 
+// SetMaxDuplicateDownload changes the number of peers that a piece can be downloaded from in endgame mode.
+func (p *PiecePicker) SetMaxDuplicateDownload(n int) {
+	p.maxDuplicateDownload = n
+}
+
 func New(pieces []piece.Piece, maxDuplicateDownload int, webseedSources []*webseedsource.WebseedSource) *PiecePicker {
 	ps := make([]myPiece, len(pieces))
 	for i := range pieces {
@@ -123,6 +129,11 @@ func (p *PiecePicker) Available() uint32 {
 	return p.available
 }
 
+// Availability returns the number of connected peers that have the piece at index i.
+func (p *PiecePicker) Availability(i uint32) int {
+	return p.pieces[i].Having.Len()
+}
+
 func (p *PiecePicker) RequestedPeers(i uint32) []*peer.Peer {
 	return p.pieces[i].Requested.Peers
 }
@@ -136,6 +147,12 @@ func (p *PiecePicker) HandleHave(pe *peer.Peer, i uint32) {
 	p.addHavingPeer(i, pe)
 }
 
+// HandleDontHave is called when the peer tells that it does not have the piece anymore (BEP 54).
+func (p *PiecePicker) HandleDontHave(pe *peer.Peer, i uint32) {
+	pe.Bitfield.Clear(i)
+	p.removeHavingPeer(int(i), pe)
+}
+
 func (p *PiecePicker) HandleAllowedFast(pe *peer.Peer, i uint32) {
 	pe.AllowedFast.Add(p.pieces[i].Piece)
 }
@@ -198,10 +215,6 @@ func (p *PiecePicker) PickFor(pe *peer.Peer) (pp *piece.Piece, allowedFast bool)
 }
 
 func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
-	// Peer is allowed to download only one piece at a time
-	if pe.Downloading {
-		return nil, false
-	}
 	if p.downloadingWebseed() {
 		if pe.PeerChoking {
 			return nil, false
@@ -291,7 +304,7 @@ func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 		if mp.Done || mp.Writing {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) && !mp.Requested.Has(pe) {
 			return mp
 		}
 	}
@@ -311,7 +324,7 @@ func (p *PiecePicker) pickStalled(pe *peer.Peer) *myPiece {
 		if mp.RunningDownloads() > 0 {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) && !mp.Requested.Has(pe) {
 			return mp
 		}
 	}
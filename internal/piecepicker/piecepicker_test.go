@@ -77,3 +77,44 @@ func newPeer(i int) *peer.Peer {
 		Bitfield: bitfield.New(numPieces),
 	}
 }
+
+func TestPickMultiplePiecesForPeer(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pe := newPeer(0)
+	pp := New(pieces, 2, nil)
+	pp.HandleHave(pe, 1)
+	pp.HandleHave(pe, 2)
+
+	first := pp.pickFor(pe)
+	second := pp.pickFor(pe)
+	assert.NotNil(t, first)
+	assert.NotNil(t, second)
+	assert.NotEqual(t, first, second)
+
+	// Pieces that are already downloading from the peer must not be picked again.
+	assert.Nil(t, pp.pickFor(pe))
+
+	pp.HandleCancelDownload(pe, first.Index)
+	assert.Equal(t, first, pp.pickFor(pe))
+}
+
+func TestDontHave(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pe := newPeer(0)
+	pp := New(pieces, 2, nil)
+	pp.HandleHave(pe, 1)
+	assert.Equal(t, 1, pp.Availability(1))
+	assert.Equal(t, uint32(1), pp.Available())
+
+	pp.HandleDontHave(pe, 1)
+	assert.False(t, pe.Bitfield.Test(1))
+	assert.Equal(t, 0, pp.Availability(1))
+	assert.Equal(t, uint32(0), pp.Available())
+	assert.Nil(t, pp.pickFor(pe))
+}
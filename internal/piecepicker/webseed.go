@@ -142,7 +142,7 @@ func (p *PiecePicker) pickLastPieceOfSmallestGap(pe *peer.Peer) *myPiece {
 	for _, gap := range gaps {
 		for i := gap.End - 1; i >= gap.Begin; i-- {
 			mp := &p.pieces[i]
-			if !mp.Having.Has(pe) {
+			if !mp.Having.Has(pe) || mp.Requested.Has(pe) {
 				continue
 			}
 			if pe.PeerChoking && !pe.AllowedFast.Has(mp.Piece) {
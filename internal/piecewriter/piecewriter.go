@@ -1,36 +1,75 @@
 package piecewriter
 
 import (
-	"crypto/sha1" // nolint: gosec
+	"errors"
+	"hash"
 
 	"github.com/ProtocolONE/rain/internal/bufferpool"
+	"github.com/ProtocolONE/rain/internal/hasher"
 	"github.com/ProtocolONE/rain/internal/piece"
+	"github.com/ProtocolONE/rain/internal/smartban"
 )
 
+var errPoolClosed = errors.New("hasher pool is closed")
+
 type PieceWriter struct {
 	Piece  *piece.Piece
 	Source interface{}
 	Buffer bufferpool.Buffer
 
-	HashOK bool
-	Error  error
+	// Sources of blocks in piece. All blocks are from Source unless the piece is assembled from multiple sources.
+	BlockSources []interface{}
+	// Set to calculate BlockChecksums while checking the hash of the piece.
+	HashBlocks bool
+
+	HashOK         bool
+	BlockChecksums []smartban.Checksum
+	Error          error
 }
 
 func New(p *piece.Piece, source interface{}, buf bufferpool.Buffer) *PieceWriter {
+	sources := make([]interface{}, p.NumBlocks())
+	for i := range sources {
+		sources[i] = source
+	}
 	return &PieceWriter{
-		Piece:  p,
-		Source: source,
-		Buffer: buf,
+		Piece:        p,
+		Source:       source,
+		Buffer:       buf,
+		BlockSources: sources,
+	}
+}
+
+// MultiSource returns true if blocks of the piece are received from more than one source.
+func (w *PieceWriter) MultiSource() bool {
+	for _, src := range w.BlockSources {
+		if src != w.BlockSources[0] {
+			return true
+		}
 	}
+	return false
 }
 
-func (w *PieceWriter) Run(resultC chan *PieceWriter, closeC chan struct{}) {
-	w.HashOK = w.Piece.VerifyHash(w.Buffer.Data, sha1.New()) // nolint: gosec
-	if w.HashOK {
+// Run checks the hash of the piece and writes it to disk if the hash is correct.
+// The result is sent to resultC. If closeC is closed before the result is sent,
+// the buffer is released because there is no one to handle the result.
+func (w *PieceWriter) Run(pool *hasher.Pool, resultC chan *PieceWriter, closeC chan struct{}) {
+	ran := pool.Do(func(h hash.Hash) {
+		w.HashOK = w.Piece.VerifyHash(w.Buffer.Data, h)
+		if w.HashBlocks || (!w.HashOK && w.MultiSource()) {
+			w.BlockChecksums = smartban.Checksums(w.Buffer.Data, h)
+		}
+	}, closeC)
+	if !ran {
+		// Pool is closed after all torrents are closed, so this should only happen on close.
+		// Otherwise the result is sent with an error, so the torrent stops instead of waiting for it.
+		w.Error = errPoolClosed
+	} else if w.HashOK {
 		_, w.Error = w.Piece.Data.Write(w.Buffer.Data)
 	}
 	select {
 	case resultC <- w:
 	case <-closeC:
+		w.Buffer.Release()
 	}
 }
@@ -0,0 +1,27 @@
+package piecewriter
+
+import (
+	"testing"
+
+	"github.com/ProtocolONE/rain/internal/bufferpool"
+	"github.com/ProtocolONE/rain/internal/hasher"
+	"github.com/ProtocolONE/rain/internal/piece"
+)
+
+func TestRunPoolClosed(t *testing.T) {
+	pool := hasher.New(1)
+	pool.Close()
+
+	p := &piece.Piece{Index: 0, Length: piece.BlockSize}
+	w := New(p, nil, bufferpool.New(piece.BlockSize).Get(piece.BlockSize))
+	resultC := make(chan *PieceWriter, 1)
+	w.Run(pool, resultC, make(chan struct{}))
+
+	res := <-resultC
+	if res.Error != errPoolClosed {
+		t.Fatalf("unexpected error: %v", res.Error)
+	}
+	if res.HashOK {
+		t.Fatal("hash must not be checked")
+	}
+}
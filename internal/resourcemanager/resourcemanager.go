@@ -23,8 +23,9 @@ type request struct {
 }
 
 type Stats struct {
-	Used  int64
-	Count int
+	Used    int64
+	Count   int
+	Waiting int
 }
 
 func New(limit int64) *ResourceManager {
@@ -115,6 +116,9 @@ func (m *ResourceManager) run() {
 				Used:  m.limit - m.available,
 				Count: len(m.requests),
 			}
+			for _, reqs := range m.requests {
+				stats.Waiting += len(reqs)
+			}
 			select {
 			case ch <- stats:
 			case <-m.closeC:
@@ -20,6 +20,9 @@ func TestResourceManager(t *testing.T) {
 	if ok {
 		t.FailNow()
 	}
+	if stats := m.Stats(); stats.Used != 2 || stats.Waiting != 1 {
+		t.Fatal(stats)
+	}
 	m.Release(1)
 	select {
 	case data := <-notifyC:
@@ -25,6 +25,14 @@ var Keys = struct {
 	BytesUploaded   []byte
 	BytesWasted     []byte
 	SeededFor       []byte
+	PublicKey       []byte
+	Salt            []byte
+	Seq             []byte
+	Replaces        []byte
+	Labels          []byte
+	Collections     []byte
+	DownloadLimit   []byte
+	UploadLimit     []byte
 }{
 	InfoHash:        []byte("info_hash"),
 	Port:            []byte("port"),
@@ -40,6 +48,14 @@ var Keys = struct {
 	BytesUploaded:   []byte("bytes_uploaded"),
 	BytesWasted:     []byte("bytes_wasted"),
 	SeededFor:       []byte("seeded_for"),
+	PublicKey:       []byte("public_key"),
+	Salt:            []byte("salt"),
+	Seq:             []byte("seq"),
+	Replaces:        []byte("replaces"),
+	Labels:          []byte("labels"),
+	Collections:     []byte("collections"),
+	DownloadLimit:   []byte("download_limit"),
+	UploadLimit:     []byte("upload_limit"),
 }
 
 type Resumer struct {
@@ -75,6 +91,14 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	if err != nil {
 		return err
 	}
+	labels, err := json.Marshal(spec.Labels)
+	if err != nil {
+		return err
+	}
+	collections, err := json.Marshal(spec.Collections)
+	if err != nil {
+		return err
+	}
 	return r.db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.Bucket(r.bucket).CreateBucketIfNotExists([]byte(torrentID))
 		if err != nil {
@@ -93,6 +117,84 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.BytesDownloaded, []byte(strconv.FormatInt(spec.BytesDownloaded, 10)))
 		_ = b.Put(Keys.BytesUploaded, []byte(strconv.FormatInt(spec.BytesUploaded, 10)))
 		_ = b.Put(Keys.SeededFor, []byte(strconv.FormatInt(spec.BytesWasted, 10)))
+		putMutable(b, spec.PublicKey, spec.Salt, spec.Seq)
+		if spec.Replaces != "" {
+			_ = b.Put(Keys.Replaces, []byte(spec.Replaces))
+		}
+		_ = b.Put(Keys.Labels, labels)
+		_ = b.Put(Keys.Collections, collections)
+		putSpeedLimits(b, spec.DownloadLimit, spec.UploadLimit)
+		return nil
+	})
+}
+
+func putSpeedLimits(b *bolt.Bucket, download, upload int64) {
+	_ = b.Put(Keys.DownloadLimit, []byte(strconv.FormatInt(download, 10)))
+	_ = b.Put(Keys.UploadLimit, []byte(strconv.FormatInt(upload, 10)))
+}
+
+func putMutable(b *bolt.Bucket, publicKey, salt []byte, seq int64) {
+	if len(publicKey) == 0 {
+		_ = b.Delete(Keys.PublicKey)
+		_ = b.Delete(Keys.Salt)
+		_ = b.Delete(Keys.Seq)
+		return
+	}
+	_ = b.Put(Keys.PublicKey, publicKey)
+	_ = b.Put(Keys.Salt, salt)
+	_ = b.Put(Keys.Seq, []byte(strconv.FormatInt(seq, 10)))
+}
+
+// WriteMutable saves the public key, salt and sequence number of a mutable torrent.
+// Keys are deleted if publicKey is empty.
+func (r *Resumer) WriteMutable(torrentID string, publicKey, salt []byte, seq int64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		putMutable(b, publicKey, salt, seq)
+		return nil
+	})
+}
+
+// WriteReplaces saves the ID of the previous version of a mutable torrent. The key is deleted if replaces is empty.
+func (r *Resumer) WriteReplaces(torrentID string, replaces string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		if replaces == "" {
+			return b.Delete(Keys.Replaces)
+		}
+		return b.Put(Keys.Replaces, []byte(replaces))
+	})
+}
+
+// WriteLabels saves the labels of the torrent.
+func (r *Resumer) WriteLabels(torrentID string, labels []string) error {
+	value, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Labels, value)
+	})
+}
+
+// WriteSpeedLimits saves the download and upload speed limits of the torrent in bytes per second.
+func (r *Resumer) WriteSpeedLimits(torrentID string, download, upload int64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		putSpeedLimits(b, download, upload)
 		return nil
 	})
 }
@@ -244,6 +346,55 @@ func (r *Resumer) Read(torrentID string) (*Spec, error) {
 			}
 		}
 
+		value = b.Get(Keys.PublicKey)
+		if value != nil {
+			spec.PublicKey = make([]byte, len(value))
+			copy(spec.PublicKey, value)
+			value = b.Get(Keys.Salt)
+			spec.Salt = make([]byte, len(value))
+			copy(spec.Salt, value)
+			value = b.Get(Keys.Seq)
+			spec.Seq, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Replaces)
+		spec.Replaces = string(value)
+
+		value = b.Get(Keys.Labels)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Labels)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Collections)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Collections)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.DownloadLimit)
+		if value != nil {
+			spec.DownloadLimit, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.UploadLimit)
+		if value != nil {
+			spec.UploadLimit, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	return spec, err
@@ -17,4 +17,16 @@ type Spec struct {
 	BytesUploaded   int64
 	BytesWasted     int64
 	SeededFor       time.Duration
+	// Public key, salt and sequence number of the version of a mutable torrent (BEP 46).
+	PublicKey []byte
+	Salt      []byte
+	Seq       int64
+	// ID of the torrent that is the previous version of this mutable torrent.
+	Replaces string
+	Labels   []string
+	// Collections of the torrent (BEP 38), including the ones outside of the info dictionary.
+	Collections []string
+	// Speed limits in bytes per second. Zero means unlimited.
+	DownloadLimit int64
+	UploadLimit   int64
 }
@@ -6,6 +6,10 @@ type Torrent struct {
 	InfoHash string
 	Port     int
 	AddedAt  Time
+	Labels   []string
+	// Speed limits in bytes per second. Zero means unlimited.
+	DownloadLimit int64
+	UploadLimit   int64
 }
 
 type Peer struct {
@@ -25,6 +29,10 @@ type Peer struct {
 	EncryptedStream    bool
 	DownloadSpeed      uint
 	UploadSpeed        uint
+	RequestQueue       int
+	PendingRequests    int
+	// Round-trip time in milliseconds.
+	RTT uint
 }
 
 type Webseed struct {
@@ -33,6 +41,21 @@ type Webseed struct {
 	DownloadSpeed uint
 }
 
+type File struct {
+	Path      string
+	Length    int64
+	Completed int64
+}
+
+type Event struct {
+	Type      string
+	Time      Time
+	TorrentID string
+	Error     *string
+	Tracker   string
+	Piece     uint32
+}
+
 type Tracker struct {
 	URL      string
 	Status   string
@@ -49,15 +72,28 @@ type SessionStats struct {
 	PieceCacheItems               int
 	PieceCacheSize                int64
 	PieceCacheUtilization         int
+	PieceCacheTorrents            []PieceCacheTorrent
 	ReadsPerSecond                int
 	ReadsActive                   int
 	ReadsPending                  int
 	ReadBytesPerSecond            int
+	PrefetchesPerSecond           int
+	WriteCacheFiles               int
+	WriteCacheSize                int64
+	WriteCacheUtilization         int
+	WritesPerSecond               int
+	WriteBytesPerSecond           int
 	ActivePieceBytes              int64
 	TorrentsPendingRAM            int
 	Uptime                        int
 }
 
+type PieceCacheTorrent struct {
+	ID    string
+	Items int
+	Size  int64
+}
+
 type Stats struct {
 	Status string
 	Error  *string
@@ -112,7 +148,9 @@ type Stats struct {
 		Download uint
 		Upload   uint
 	}
-	ETA *uint
+	ETA           *uint
+	HashFailures  int64
+	TrackerErrors int64
 }
 
 type ListTorrentsRequest struct {
@@ -124,6 +162,8 @@ type ListTorrentsResponse struct {
 
 type AddTorrentRequest struct {
 	Torrent string
+	// Directory on server to search for the files of the torrent that are already downloaded.
+	FindExistingDataIn string
 }
 
 type AddTorrentResponse struct {
@@ -184,6 +224,26 @@ type GetTorrentWebseedsResponse struct {
 	Webseeds []Webseed
 }
 
+type GetTorrentFilesRequest struct {
+	ID string
+}
+
+type GetTorrentFilesResponse struct {
+	Files []File
+}
+
+type GetTorrentPiecesRequest struct {
+	ID string
+}
+
+type GetTorrentPiecesResponse struct {
+	NumPieces uint32
+	// Base64 encoded bitfield of downloaded pieces.
+	Have string
+	// Number of connected peers that have each piece.
+	Availability []int
+}
+
 type StartTorrentRequest struct {
 	ID string
 }
@@ -225,3 +285,161 @@ type StopAllTorrentsRequest struct {
 
 type StopAllTorrentsResponse struct {
 }
+
+type VerifyTorrentRequest struct {
+	ID string
+}
+
+type VerifyTorrentResponse struct {
+	Result VerifyResult
+}
+
+type VerifyResult struct {
+	Have  uint32
+	Found []uint32
+	Lost  []uint32
+}
+
+// TorrentFilter selects torrents in bulk requests. Empty fields match all torrents.
+type TorrentFilter struct {
+	// IDs of torrents.
+	IDs []string
+	// Status names as in Stats.Status. Matching is case-insensitive.
+	Status []string
+	// Glob pattern for the name of the torrent.
+	Name string
+	// Host name of one of the trackers of the torrent.
+	TrackerHost string
+	// One of the labels of the torrent.
+	Label string
+}
+
+type TorrentWithStats struct {
+	Torrent
+	// Selected fields of Stats.
+	Stats map[string]interface{}
+}
+
+type ListTorrentsWithStatsRequest struct {
+	Filter TorrentFilter
+	// Names of Stats fields to return. All fields are returned if empty.
+	Fields []string
+}
+
+type ListTorrentsWithStatsResponse struct {
+	Torrents []TorrentWithStats
+}
+
+type BulkResult struct {
+	ID    string
+	Error *string
+}
+
+type StartTorrentsRequest struct {
+	Filter TorrentFilter
+}
+
+type StartTorrentsResponse struct {
+	Results []BulkResult
+}
+
+type StopTorrentsRequest struct {
+	Filter TorrentFilter
+}
+
+type StopTorrentsResponse struct {
+	Results []BulkResult
+}
+
+type RemoveTorrentsRequest struct {
+	Filter TorrentFilter
+}
+
+type RemoveTorrentsResponse struct {
+	Results []BulkResult
+}
+
+type VerifyTorrentsRequest struct {
+	Filter TorrentFilter
+}
+
+type VerifyTorrentsResponse struct {
+	Results []VerifyTorrentsResult
+}
+
+type VerifyTorrentsResult struct {
+	ID     string
+	Error  *string
+	Result *VerifyResult
+}
+
+type SetTorrentLabelsRequest struct {
+	Filter TorrentFilter
+	Labels []string
+}
+
+type SetTorrentLabelsResponse struct {
+	Results []BulkResult
+}
+
+type SetTorrentLimitsRequest struct {
+	Filter TorrentFilter
+	// Speed limits in bytes per second. Zero means unlimited.
+	DownloadLimit int64
+	UploadLimit   int64
+}
+
+type SetTorrentLimitsResponse struct {
+	Results []BulkResult
+}
+
+type GetConfigRequest struct {
+}
+
+type GetConfigResponse struct {
+	// Durations are formatted as strings like "1m30s".
+	Config map[string]interface{}
+	// Names of fields that can be changed with SetConfig.
+	Reloadable []string
+}
+
+type SetConfigRequest struct {
+	// Only the given fields are changed.
+	// Durations can be given as strings like "1m30s" or number of nanoseconds.
+	Config map[string]interface{}
+}
+
+type SetConfigResponse struct {
+}
+
+type Ban struct {
+	IP        string
+	Reason    string
+	CreatedAt Time
+	// Nil if the ban never expires.
+	ExpiresAt *Time
+}
+
+type ListBansRequest struct {
+}
+
+type ListBansResponse struct {
+	Bans []Ban
+}
+
+type AddBanRequest struct {
+	IP     string
+	Reason string
+	// Duration of the ban in seconds. 0 means permanent.
+	Duration uint
+}
+
+type AddBanResponse struct {
+}
+
+type RemoveBanRequest struct {
+	IP string
+}
+
+type RemoveBanResponse struct {
+}
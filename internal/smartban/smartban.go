@@ -0,0 +1,112 @@
+// Package smartban finds out which sources sent the corrupt blocks of a piece that is assembled from multiple sources.
+package smartban
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"hash"
+
+	"github.com/ProtocolONE/rain/internal/piece"
+)
+
+// Checksum of a block in piece.
+type Checksum [sha1.Size]byte
+
+// Checksums calculates checksums of the blocks in piece data with h.
+func Checksums(data []byte, h hash.Hash) []Checksum {
+	sums := make([]Checksum, 0, (len(data)+piece.BlockSize-1)/piece.BlockSize)
+	for begin := 0; begin < len(data); begin += piece.BlockSize {
+		end := begin + piece.BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		h.Reset()
+		_, _ = h.Write(data[begin:end])
+		var sum Checksum
+		h.Sum(sum[:0])
+		sums = append(sums, sum)
+	}
+	return sums
+}
+
+type block struct {
+	sum    Checksum
+	source interface{}
+}
+
+// SmartBan keeps the checksums of blocks in pieces that failed hash check until the piece is downloaded again.
+// Blocks that differ from the good copy of the piece point out the sources that sent corrupt data.
+type SmartBan struct {
+	pieces map[uint32]map[int][]block
+}
+
+func New() *SmartBan {
+	return &SmartBan{
+		pieces: make(map[uint32]map[int][]block),
+	}
+}
+
+// Has returns true if there are blocks recorded for the piece.
+// Checksums of the piece must be calculated when it is downloaded again.
+func (s *SmartBan) Has(index uint32) bool {
+	_, ok := s.pieces[index]
+	return ok
+}
+
+// PieceFailed records the checksum and the source of each block of a piece that failed hash check.
+// sources must be in the same order with sums.
+// Same data from the same source is recorded once.
+func (s *SmartBan) PieceFailed(index uint32, sums []Checksum, sources []interface{}) {
+	blocks, ok := s.pieces[index]
+	if !ok {
+		blocks = make(map[int][]block)
+		s.pieces[index] = blocks
+	}
+	for i, sum := range sums {
+		b := block{sum: sum, source: sources[i]}
+		if !containsBlock(blocks[i], b) {
+			blocks[i] = append(blocks[i], b)
+		}
+	}
+}
+
+// PiecePassed compares the checksums of a piece that passed hash check with the recorded blocks of that piece.
+// Returns the sources that sent different data. Recorded blocks of the piece are forgotten.
+func (s *SmartBan) PiecePassed(index uint32, sums []Checksum) []interface{} {
+	blocks, ok := s.pieces[index]
+	if !ok {
+		return nil
+	}
+	delete(s.pieces, index)
+	var ret []interface{}
+	for i, sum := range sums {
+		for _, b := range blocks[i] {
+			if b.sum != sum && !containsSource(ret, b.source) {
+				ret = append(ret, b.source)
+			}
+		}
+	}
+	return ret
+}
+
+// Reset forgets all recorded blocks.
+func (s *SmartBan) Reset() {
+	s.pieces = make(map[uint32]map[int][]block)
+}
+
+func containsBlock(blocks []block, b block) bool {
+	for _, b2 := range blocks {
+		if b2 == b {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSource(sources []interface{}, src interface{}) bool {
+	for _, src2 := range sources {
+		if src2 == src {
+			return true
+		}
+	}
+	return false
+}
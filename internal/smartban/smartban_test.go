@@ -0,0 +1,38 @@
+package smartban
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"testing"
+
+	"github.com/ProtocolONE/rain/internal/piece"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksums(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 2*piece.BlockSize+1)
+	sums := Checksums(data, sha1.New()) // nolint: gosec
+	assert.Len(t, sums, 3)
+	assert.Equal(t, sums[0], sums[1])
+	assert.Equal(t, Checksum(sha1.Sum([]byte{1})), sums[2]) // nolint: gosec
+}
+
+func TestSmartBan(t *testing.T) {
+	good := bytes.Repeat([]byte{1}, 3*piece.BlockSize)
+	bad := append([]byte(nil), good...)
+	bad[piece.BlockSize] = 2
+	h := sha1.New() // nolint: gosec
+
+	s := New()
+	assert.False(t, s.Has(0))
+	assert.Nil(t, s.PiecePassed(0, Checksums(good, h)))
+
+	s.PieceFailed(0, Checksums(bad, h), []interface{}{"a", "b", "c"})
+	assert.True(t, s.Has(0))
+	assert.Equal(t, []interface{}{"b"}, s.PiecePassed(0, Checksums(good, h)))
+	assert.False(t, s.Has(0))
+
+	s.PieceFailed(1, Checksums(bad, h), []interface{}{"a", "b", "c"})
+	s.Reset()
+	assert.False(t, s.Has(1))
+}
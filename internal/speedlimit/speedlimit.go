@@ -0,0 +1,121 @@
+// Package speedlimit limits the transfer speed of a group of connections.
+package speedlimit
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("connection is closed")
+
+// Limiter is a token bucket that is shared by the connections of a torrent.
+// Up to one second of transfer can be done at once after the connections are idle.
+type Limiter struct {
+	m      sync.Mutex
+	limit  int64 // bytes per second, zero means unlimited
+	tokens float64
+	last   time.Time
+}
+
+// New returns a new Limiter. Zero limit means unlimited.
+func New(limit int64) *Limiter {
+	l := &Limiter{}
+	l.SetLimit(limit)
+	return l
+}
+
+// Limit returns the limit in bytes per second.
+func (l *Limiter) Limit() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.limit
+}
+
+// SetLimit changes the limit in bytes per second. Zero limit means unlimited.
+func (l *Limiter) SetLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.limit = limit
+	l.tokens = float64(limit)
+	l.last = time.Now()
+}
+
+// reserve takes n bytes from the bucket and returns the duration to wait before transferring them.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.limit == 0 {
+		return 0
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.limit)
+	if l.tokens > float64(l.limit) {
+		l.tokens = float64(l.limit)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.limit) * float64(time.Second))
+}
+
+// Conn is a net.Conn that limits the speed of reads and writes.
+type Conn struct {
+	net.Conn
+	read, write *Limiter
+	closeOnce   sync.Once
+	closeC      chan struct{}
+}
+
+// NewConn returns a new Conn that waits for read after reading and waits for write before writing.
+func NewConn(conn net.Conn, read, write *Limiter) *Conn {
+	return &Conn{
+		Conn:   conn,
+		read:   read,
+		write:  write,
+		closeC: make(chan struct{}),
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && !c.wait(c.read, n) && err == nil {
+		err = errClosed
+	}
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if !c.wait(c.write, len(b)) {
+		return 0, errClosed
+	}
+	return c.Conn.Write(b)
+}
+
+// Close closes the underlying connection and stops waiting for the limiters.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.closeC) })
+	return c.Conn.Close()
+}
+
+// wait returns false if the connection is closed while waiting.
+func (c *Conn) wait(l *Limiter, n int) bool {
+	d := l.reserve(n)
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.closeC:
+		return false
+	}
+}
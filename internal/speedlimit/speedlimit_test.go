@@ -0,0 +1,58 @@
+package speedlimit
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(0)
+	if d := l.reserve(1 << 20); d != 0 {
+		t.Fatalf("unlimited limiter waits %s", d)
+	}
+	l.SetLimit(1000)
+	if d := l.reserve(1000); d != 0 {
+		t.Fatalf("limiter waits %s for burst", d)
+	}
+	if d := l.reserve(500); d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Fatalf("unexpected wait: %s", d)
+	}
+}
+
+func TestConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	write := New(1000)
+	c := NewConn(c1, New(0), write)
+	go func() { _, _ = io.Copy(ioutil.Discard, c2) }()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := c.Write(make([]byte, 500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("write is not limited: %s", d)
+	}
+
+	// Waiting write returns when the connection is closed.
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Write(make([]byte, 10000))
+		errC <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	select {
+	case err := <-errC:
+		if err == nil {
+			t.Fatal("write must fail after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write is not interrupted by close")
+	}
+}
@@ -1,15 +1,127 @@
 package filestorage
 
-import "os"
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
 
+// File is a file of a torrent on disk.
+// Files may be hard links to the data of other torrents or to existing files given by the user.
+// Such a file is replaced with a private copy before it is changed, so writes never change the data of other paths.
 type File struct {
-	*os.File
+	name string
+
+	m sync.RWMutex
+	f *os.File
+}
+
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.f.ReadAt(b, off)
+}
+
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	err := f.unshare()
+	if err != nil {
+		return 0, err
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.f.WriteAt(b, off)
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
-	n, err = f.File.Write(b)
+	err = f.unshare()
+	if err != nil {
+		return
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	n, err = f.f.Write(b)
 	if err != nil {
 		return
 	}
-	return n, f.File.Sync()
+	return n, f.f.Sync()
+}
+
+func (f *File) truncate(size int64) error {
+	err := f.unshare()
+	if err != nil {
+		return err
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.f.Truncate(size)
+}
+
+func (f *File) Sync() error {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.f.Sync()
+}
+
+func (f *File) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.f.Close()
+}
+
+// unshare replaces the file with a private copy if its data is shared with another path by a hard link.
+func (f *File) unshare() error {
+	f.m.RLock()
+	fi, err := f.f.Stat()
+	f.m.RUnlock()
+	if err != nil {
+		return err
+	}
+	if linkCount(fi) <= 1 {
+		return nil
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	// Another write may have replaced the file while waiting for the lock.
+	fi, err = f.f.Stat()
+	if err != nil {
+		return err
+	}
+	if linkCount(fi) <= 1 {
+		return nil
+	}
+	of, err := copyToTemp(f.f, f.name, fi)
+	if err != nil {
+		return err
+	}
+	// Rename replaces the link atomically. Other paths keep the original data.
+	err = os.Rename(of.Name(), f.name)
+	if err != nil {
+		_ = of.Close()
+		_ = os.Remove(of.Name())
+		return err
+	}
+	_ = f.f.Close()
+	f.f = of
+	return nil
+}
+
+// copyToTemp copies the data of src into a new file in the same directory with name.
+func copyToTemp(src *os.File, name string, fi os.FileInfo) (*os.File, error) {
+	of, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(of, io.NewSectionReader(src, 0, fi.Size()))
+	if err == nil {
+		// Copy must be writable even if the shared file is read-only.
+		err = of.Chmod(fi.Mode().Perm() | 0600)
+	}
+	if err != nil {
+		_ = of.Close()
+		_ = os.Remove(of.Name())
+		return nil, err
+	}
+	return of, nil
 }
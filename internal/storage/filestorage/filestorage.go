@@ -55,21 +55,26 @@ func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool
 		if err != nil {
 			return
 		}
-		f = File{of}
+		f = &File{name: name, f: of}
 		err = of.Truncate(size)
 		return
 	}
+	if os.IsPermission(err) {
+		// Read-only files can be linked from other paths. They are copied before they are changed.
+		of, err = os.Open(name) // nolint: gosec
+	}
 	if err != nil {
 		return
 	}
-	f = File{of}
+	file := &File{name: name, f: of}
+	f = file
 	exists = true
 	fi, err := of.Stat()
 	if err != nil {
 		return
 	}
 	if fi.Size() != size {
-		err = of.Truncate(size)
+		err = file.truncate(size)
 	}
 	return
 }
@@ -0,0 +1,72 @@
+package filestorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteLinkedFile(t *testing.T) {
+	if !DetectsLinks {
+		t.Skip("hard links cannot be detected on this platform")
+	}
+	dir, err := ioutil.TempDir("", "rain-filestorage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	err = ioutil.WriteFile(source, []byte("abcd"), 0440)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "dest"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Link(source, filepath.Join(dir, "dest", "file"))
+	if err != nil {
+		t.Skip("cannot create hard link:", err)
+	}
+
+	sto, err := New(filepath.Join(dir, "dest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, exists, err := sto.Open("file", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !exists {
+		t.Fatal("linked file must exist")
+	}
+	_, err = f.WriteAt([]byte("x"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	_, err = f.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "axcd" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+	b, err = ioutil.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcd" {
+		t.Fatalf("linked file is changed: %q", b)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "dest", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "axcd" {
+		t.Fatalf("unexpected data on disk: %q", b)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package filestorage
+
+import (
+	"os"
+	"syscall"
+)
+
+// DetectsLinks is true if files that share their data with other paths by hard links are detected,
+// so they can be replaced with a private copy before they are changed.
+const DetectsLinks = true
+
+func linkCount(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 0
+}
@@ -45,6 +45,12 @@ func New(numUnchoked, numOptimisticUnchoked int) *Unchoker {
 	}
 }
 
+// SetLimits changes the number of peers unchoked in following rounds.
+func (u *Unchoker) SetLimits(numUnchoked, numOptimisticUnchoked int) {
+	u.numUnchoked = numUnchoked
+	u.numOptimisticUnchoked = numOptimisticUnchoked
+}
+
 func (u *Unchoker) HandleDisconnect(pe Peer) {
 	delete(u.peersUnchoked, pe)
 	delete(u.peersUnchokedOptimistic, pe)
@@ -1,12 +1,17 @@
 package verifier
 
 import (
-	"crypto/sha1" // nolint: gosec
+	"errors"
+	"hash"
+	"sync"
 
 	"github.com/ProtocolONE/rain/internal/bitfield"
+	"github.com/ProtocolONE/rain/internal/hasher"
 	"github.com/ProtocolONE/rain/internal/piece"
 )
 
+var errCancelled = errors.New("verification cancelled")
+
 type Verifier struct {
 	Bitfield *bitfield.Bitfield
 	Error    error
@@ -19,6 +24,12 @@ type Progress struct {
 	Checked uint32
 }
 
+type result struct {
+	index uint32
+	ok    bool
+	err   error
+}
+
 func New() *Verifier {
 	return &Verifier{
 		closeC: make(chan struct{}),
@@ -31,7 +42,9 @@ func (v *Verifier) Close() {
 	<-v.doneC
 }
 
-func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC chan *Verifier) {
+// Run checks the hashes of pieces in parallel with the workers in pool.
+// Progress is reported in piece order.
+func (v *Verifier) Run(pieces []piece.Piece, pool *hasher.Pool, progressC chan Progress, resultC chan *Verifier) {
 	defer close(v.doneC)
 
 	defer func() {
@@ -42,25 +55,79 @@ func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC ch
 	}()
 
 	v.Bitfield = bitfield.New(uint32(len(pieces)))
-	buf := make([]byte, pieces[0].Length)
-	hash := sha1.New() // nolint: gosec
-	var numOK uint32
-	for _, p := range pieces {
-		buf = buf[:p.Length]
-		_, v.Error = p.Data.ReadAt(buf, 0)
-		if v.Error != nil {
-			return
-		}
-		ok := p.VerifyHash(buf, hash)
-		if ok {
-			v.Bitfield.Set(p.Index)
-			numOK++
-		}
+
+	// Keep at most 2 pieces per worker in memory so workers do not wait while results are being collected.
+	window := 2 * pool.Workers()
+	if window > len(pieces) {
+		window = len(pieces)
+	}
+	bufC := make(chan []byte, window)
+	for i := 0; i < window; i++ {
+		bufC <- make([]byte, pieces[0].Length)
+	}
+	resultsC := make(chan result, window)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	submit := func(p *piece.Piece) {
+		buf := <-bufC
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := result{index: p.Index}
+			ran := pool.Do(func(h hash.Hash) {
+				b := buf[:p.Length]
+				_, r.err = p.Data.ReadAt(b, 0)
+				if r.err == nil {
+					r.ok = p.VerifyHash(b, h)
+				}
+			}, v.closeC)
+			if !ran {
+				r.err = errCancelled
+			}
+			bufC <- buf
+			resultsC <- r
+		}()
+	}
+
+	var next int // next piece to submit
+	for ; next < window; next++ {
+		submit(&pieces[next])
+	}
+
+	pending := make(map[uint32]result, window)
+	var checked uint32
+	for checked < uint32(len(pieces)) {
 		select {
-		case progressC <- Progress{Checked: p.Index + 1}:
+		case r := <-resultsC:
+			pending[r.index] = r
 		case <-v.closeC:
 			return
 		}
-		hash.Reset()
+		for {
+			r, ok := pending[checked]
+			if !ok {
+				break
+			}
+			delete(pending, checked)
+			if r.err != nil {
+				v.Error = r.err
+				return
+			}
+			if r.ok {
+				v.Bitfield.Set(r.index)
+			}
+			checked++
+			if next < len(pieces) {
+				submit(&pieces[next])
+				next++
+			}
+			select {
+			case progressC <- Progress{Checked: checked}:
+			case <-v.closeC:
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,78 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"testing"
+
+	"github.com/ProtocolONE/rain/internal/filesection"
+	"github.com/ProtocolONE/rain/internal/hasher"
+	"github.com/ProtocolONE/rain/internal/piece"
+)
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (f memFile) WriteAt(b []byte, off int64) (int, error) {
+	panic("not implemented")
+}
+
+func TestVerifier(t *testing.T) {
+	const pieceLength = 4
+	data := []byte("aaaabbbbccccddddee")
+	f := memFile{bytes.NewReader(data)}
+
+	var pieces []piece.Piece
+	for i := 0; i*pieceLength < len(data); i++ {
+		begin := i * pieceLength
+		end := begin + pieceLength
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha1.Sum(data[begin:end]) // nolint: gosec
+		// Corrupt the hash of the second piece.
+		if i == 1 {
+			sum[0]++
+		}
+		pieces = append(pieces, piece.Piece{
+			Index:  uint32(i),
+			Length: uint32(end - begin),
+			Data:   filesection.Piece{{File: f, Offset: int64(begin), Length: int64(end - begin)}},
+			Hash:   sum[:],
+		})
+	}
+
+	pool := hasher.New(2)
+	defer pool.Close()
+
+	v := New()
+	progressC := make(chan Progress)
+	resultC := make(chan *Verifier)
+	go v.Run(pieces, pool, progressC, resultC)
+
+	var checked []uint32
+	for {
+		select {
+		case p := <-progressC:
+			checked = append(checked, p.Checked)
+			continue
+		case <-resultC:
+		}
+		break
+	}
+	if v.Error != nil {
+		t.Fatal(v.Error)
+	}
+	for i, c := range checked {
+		if c != uint32(i+1) {
+			t.Fatalf("progress is not in order: %v", checked)
+		}
+	}
+	if len(checked) != len(pieces) {
+		t.Fatalf("unexpected number of progress reports: %d", len(checked))
+	}
+	if v.Bitfield.Hex() != "b8" {
+		t.Fatalf("unexpected bitfield: %s", v.Bitfield.Hex())
+	}
+}
@@ -0,0 +1,388 @@
+"use strict";
+
+// The page is served under /ui/ and the REST API is at /api/ of the same server.
+const apiBase = new URL("../api/", location.href);
+const refreshInterval = 2000;
+const statsFields = ["Status", "Error", "Bytes", "Speed", "Peers", "ETA", "Pieces"];
+
+const state = {
+  torrents: [],
+  selected: null, // ID of selected torrent
+  sortKey: "AddedAt",
+  sortDesc: true,
+  tab: "general",
+};
+
+async function api(method, path, body) {
+  const opts = { method: method, headers: {} };
+  if (method !== "GET" && method !== "DELETE") {
+    // Server accepts only JSON requests for changing the session.
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body === undefined ? {} : body);
+  }
+  const resp = await fetch(new URL(path, apiBase), opts);
+  const data = await resp.json();
+  if (!resp.ok) {
+    throw new Error(data.Error || resp.statusText);
+  }
+  return data;
+}
+
+function showError(err) {
+  const el = document.getElementById("error");
+  if (err) {
+    el.textContent = err.message || String(err);
+    el.hidden = false;
+  } else {
+    el.hidden = true;
+  }
+}
+
+// Formatting helpers
+
+function formatBytes(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+}
+
+function formatSpeed(n) {
+  return n ? formatBytes(n) + "/s" : "";
+}
+
+function formatDuration(s) {
+  if (s === null || s === undefined) {
+    return "";
+  }
+  const d = Math.floor(s / 86400);
+  const h = Math.floor((s % 86400) / 3600);
+  const m = Math.floor((s % 3600) / 60);
+  if (d > 0) {
+    return d + "d " + h + "h";
+  }
+  if (h > 0) {
+    return h + "h " + m + "m";
+  }
+  return m + "m " + (s % 60) + "s";
+}
+
+function progress(t) {
+  const total = t.Stats.Pieces.Total;
+  return total ? t.Stats.Pieces.Have / total : 0;
+}
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  for (const k in attrs || {}) {
+    if (k === "class") {
+      e.className = attrs[k];
+    } else {
+      e.setAttribute(k, attrs[k]);
+    }
+  }
+  for (const c of children) {
+    e.append(c instanceof Node ? c : String(c));
+  }
+  return e;
+}
+
+function progressBar(value) {
+  const p = el("progress", { max: 1 });
+  p.value = value;
+  return el("span", {}, p, " " + (value * 100).toFixed(1) + "%");
+}
+
+function table(columns, rows) {
+  const head = el("tr", {}, ...columns.map((c) => el("th", {}, c[0])));
+  const body = rows.map((r) => el("tr", {}, ...columns.map((c) => el("td", {}, c[1](r)))));
+  return el("table", {}, el("thead", {}, head), el("tbody", {}, ...body));
+}
+
+// Torrent list
+
+const sortValues = {
+  Name: (t) => t.Name.toLowerCase(),
+  Status: (t) => t.Stats.Status,
+  Size: (t) => t.Stats.Bytes.Total,
+  Progress: progress,
+  Download: (t) => t.Stats.Speed.Download,
+  Upload: (t) => t.Stats.Speed.Upload,
+  Peers: (t) => t.Stats.Peers.Total,
+  ETA: (t) => (t.Stats.ETA === null ? Infinity : t.Stats.ETA),
+  AddedAt: (t) => t.AddedAt,
+};
+
+function visibleTorrents() {
+  const name = document.getElementById("filter").value.toLowerCase();
+  const status = document.getElementById("status-filter").value;
+  const value = sortValues[state.sortKey];
+  return state.torrents
+    .filter((t) => t.Name.toLowerCase().includes(name) && (!status || t.Stats.Status === status))
+    .sort((a, b) => {
+      const va = value(a);
+      const vb = value(b);
+      const c = va < vb ? -1 : va > vb ? 1 : 0;
+      return state.sortDesc ? -c : c;
+    });
+}
+
+function renderTorrents() {
+  for (const th of document.querySelectorAll("#torrents th")) {
+    th.classList.toggle("asc", th.dataset.sort === state.sortKey && !state.sortDesc);
+    th.classList.toggle("desc", th.dataset.sort === state.sortKey && state.sortDesc);
+  }
+  const rows = visibleTorrents().map((t) => {
+    const tr = el(
+      "tr",
+      { "data-id": t.ID },
+      el("td", { class: "name", title: t.Name }, t.Name),
+      el("td", { title: t.Stats.Error || "" }, t.Stats.Error ? "Error" : t.Stats.Status),
+      el("td", {}, formatBytes(t.Stats.Bytes.Total)),
+      el("td", {}, progressBar(progress(t))),
+      el("td", {}, formatSpeed(t.Stats.Speed.Download)),
+      el("td", {}, formatSpeed(t.Stats.Speed.Upload)),
+      el("td", {}, t.Stats.Peers.Total),
+      el("td", {}, formatDuration(t.Stats.ETA)),
+      el("td", {}, new Date(t.AddedAt).toLocaleString())
+    );
+    if (t.ID === state.selected) {
+      tr.classList.add("selected");
+    }
+    if (t.Stats.Error) {
+      tr.classList.add("error");
+    }
+    tr.addEventListener("click", () => select(t.ID));
+    return tr;
+  });
+  document.querySelector("#torrents tbody").replaceChildren(...rows);
+  for (const id of ["start", "stop", "verify", "remove"]) {
+    document.getElementById(id).disabled = state.selected === null;
+  }
+}
+
+async function refresh() {
+  try {
+    const [list, session] = await Promise.all([
+      api("POST", "torrents/search", { Fields: statsFields }),
+      api("GET", "session/stats"),
+    ]);
+    state.torrents = list.Torrents;
+    if (!state.torrents.some((t) => t.ID === state.selected)) {
+      state.selected = null;
+    }
+    const s = session.Stats;
+    document.getElementById("session").textContent =
+      s.Torrents + " torrents, up " + formatDuration(s.Uptime);
+    renderTorrents();
+    await renderDetails();
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// Details of selected torrent
+
+const tabs = {
+  async general(id) {
+    const s = (await api("GET", "torrents/" + id + "/stats")).Stats;
+    const t = state.torrents.find((t) => t.ID === id);
+    const rows = [
+      ["Name", s.Name],
+      ["ID", id],
+      ["Info hash", t ? t.InfoHash : ""],
+      ["Status", s.Status],
+      ["Error", s.Error || ""],
+      ["Progress", progressBar(s.Pieces.Total ? s.Pieces.Have / s.Pieces.Total : 0)],
+      ["Size", formatBytes(s.Bytes.Total)],
+      ["Pieces", s.Pieces.Have + " / " + s.Pieces.Total + " (" + formatBytes(s.PieceLength) + " each)"],
+      ["Downloaded", formatBytes(s.Bytes.Downloaded)],
+      ["Uploaded", formatBytes(s.Bytes.Uploaded)],
+      ["Wasted", formatBytes(s.Bytes.Wasted)],
+      ["Speed", "↓ " + formatSpeed(s.Speed.Download) + " ↑ " + formatSpeed(s.Speed.Upload)],
+      ["ETA", formatDuration(s.ETA)],
+      ["Seeded for", formatDuration(s.SeededFor)],
+      ["Peers", s.Peers.Total + " (" + s.Peers.Incoming + " incoming, " + s.Peers.Outgoing + " outgoing)"],
+      ["Addresses", s.Addresses.Total + " (tracker " + s.Addresses.Tracker + ", DHT " + s.Addresses.DHT + ", PEX " + s.Addresses.PEX + ")"],
+      ["Private", s.Private ? "yes" : "no"],
+      ["Port", t ? t.Port : ""],
+    ];
+    return el("table", {}, ...rows.map((r) => el("tr", {}, el("th", {}, r[0]), el("td", {}, r[1]))));
+  },
+  async trackers(id) {
+    const trackers = (await api("GET", "torrents/" + id + "/trackers")).Trackers;
+    return table(
+      [
+        ["URL", (t) => t.URL],
+        ["Status", (t) => t.Status],
+        ["Seeders", (t) => t.Seeders],
+        ["Leechers", (t) => t.Leechers],
+        ["Error", (t) => t.Error || ""],
+      ],
+      trackers
+    );
+  },
+  async peers(id) {
+    const peers = (await api("GET", "torrents/" + id + "/peers")).Peers;
+    const flags = (p) =>
+      (p.Downloading ? "D" : "") +
+      (p.ClientInterested ? "i" : "") +
+      (p.PeerInterested ? "I" : "") +
+      (p.ClientChoking ? "c" : "") +
+      (p.PeerChoking ? "C" : "") +
+      (p.OptimisticUnchoked ? "O" : "") +
+      (p.Snubbed ? "S" : "") +
+      (p.EncryptedStream ? "E" : p.EncryptedHandshake ? "e" : "");
+    return table(
+      [
+        ["Address", (p) => p.Addr],
+        ["Client", (p) => p.Client],
+        ["Source", (p) => p.Source],
+        ["Flags", flags],
+        ["Down", (p) => formatSpeed(p.DownloadSpeed)],
+        ["Up", (p) => formatSpeed(p.UploadSpeed)],
+        ["Queue", (p) => p.PendingRequests + "/" + p.RequestQueue],
+        ["RTT", (p) => (p.RTT ? p.RTT + " ms" : "")],
+        ["Connected", (p) => new Date(p.ConnectedAt).toLocaleString()],
+      ],
+      peers
+    );
+  },
+  async webseeds(id) {
+    const webseeds = (await api("GET", "torrents/" + id + "/webseeds")).Webseeds;
+    return table(
+      [
+        ["URL", (w) => w.URL],
+        ["Speed", (w) => formatSpeed(w.DownloadSpeed)],
+        ["Error", (w) => w.Error || ""],
+      ],
+      webseeds
+    );
+  },
+  async files(id) {
+    const files = (await api("GET", "torrents/" + id + "/files")).Files;
+    return table(
+      [
+        ["Path", (f) => f.Path],
+        ["Size", (f) => formatBytes(f.Length)],
+        ["Progress", (f) => progressBar(f.Length ? f.Completed / f.Length : 1)],
+      ],
+      files
+    );
+  },
+};
+
+async function renderDetails() {
+  const details = document.getElementById("details");
+  details.hidden = state.selected === null;
+  if (state.selected === null) {
+    return;
+  }
+  for (const b of details.querySelectorAll("nav button")) {
+    b.classList.toggle("active", b.dataset.tab === state.tab);
+  }
+  const content = await tabs[state.tab](state.selected);
+  document.getElementById("tab").replaceChildren(content);
+}
+
+function select(id) {
+  state.selected = id;
+  renderTorrents();
+  renderDetails().catch(showError);
+}
+
+// Actions
+
+async function action(fn) {
+  try {
+    await fn();
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+  await refresh();
+}
+
+function readBase64(file) {
+  return new Promise((resolve, reject) => {
+    const r = new FileReader();
+    // Result is a data URL. Only the part after the comma is base64 encoded content.
+    r.onload = () => resolve(r.result.slice(r.result.indexOf(",") + 1));
+    r.onerror = () => reject(r.error);
+    r.readAsDataURL(file);
+  });
+}
+
+document.getElementById("add-magnet").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const input = document.getElementById("magnet");
+  const uri = input.value.trim();
+  if (!uri) {
+    return;
+  }
+  action(async () => {
+    const resp = await api("POST", "torrents/uri", { URI: uri });
+    input.value = "";
+    state.selected = resp.Torrent.ID;
+  });
+});
+
+document.getElementById("upload").addEventListener("change", (e) => {
+  const files = Array.from(e.target.files);
+  e.target.value = "";
+  action(async () => {
+    for (const f of files) {
+      const resp = await api("POST", "torrents", { Torrent: await readBase64(f) });
+      state.selected = resp.Torrent.ID;
+    }
+  });
+});
+
+document.getElementById("start").addEventListener("click", () =>
+  action(() => api("POST", "torrents/" + state.selected + "/start", {}))
+);
+
+document.getElementById("stop").addEventListener("click", () =>
+  action(() => api("POST", "torrents/" + state.selected + "/stop", {}))
+);
+
+document.getElementById("verify").addEventListener("click", () =>
+  action(() => api("POST", "torrents/" + state.selected + "/verify", {}))
+);
+
+document.getElementById("remove").addEventListener("click", () => {
+  const t = state.torrents.find((t) => t.ID === state.selected);
+  if (!t || !confirm("Remove " + t.Name + " and its data?")) {
+    return;
+  }
+  action(() => api("DELETE", "torrents/" + state.selected));
+});
+
+for (const th of document.querySelectorAll("#torrents th")) {
+  th.addEventListener("click", () => {
+    if (state.sortKey === th.dataset.sort) {
+      state.sortDesc = !state.sortDesc;
+    } else {
+      state.sortKey = th.dataset.sort;
+      state.sortDesc = false;
+    }
+    renderTorrents();
+  });
+}
+
+for (const b of document.querySelectorAll("#details nav button")) {
+  b.addEventListener("click", () => {
+    state.tab = b.dataset.tab;
+    renderDetails().catch(showError);
+  });
+}
+
+document.getElementById("filter").addEventListener("input", renderTorrents);
+document.getElementById("status-filter").addEventListener("change", renderTorrents);
+
+refresh();
+setInterval(refresh, refreshInterval);
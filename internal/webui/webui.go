@@ -0,0 +1,22 @@
+// Package webui contains the browser interface that is served by the RPC server.
+// The interface is a single page that talks to the REST API of the server.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler returns a handler that serves the files of web interface.
+// prefix is stripped from the request paths before looking up the files.
+func Handler(prefix string) http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(prefix, http.FileServer(http.FS(sub)))
+}
@@ -0,0 +1,441 @@
+// Package writecache implements a session-wide cache for coalescing piece writes before they are written to disk.
+package writecache
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/storage"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Cache keeps written bytes in memory and writes them to the underlying files in large contiguous chunks.
+// Dirty data is flushed when the cache is full, periodically at flush interval and when a file is closed.
+// Data of a file that cannot be written is kept in memory until the file is closed, because its pieces are already marked as downloaded.
+type Cache struct {
+	maxSize  int64
+	interval time.Duration
+	fsync    bool
+
+	m    sync.Mutex
+	size int64
+	// Files that have dirty data, mapped to the time of their oldest unflushed write.
+	files map[*File]time.Time
+	// Files that have dirty data that cannot be written. They are not flushed again.
+	failed map[*File]struct{}
+	// Number of files that have failed to write.
+	numErrors int
+
+	numRead      metrics.EWMA
+	numHit       metrics.EWMA
+	numFlush     metrics.EWMA
+	flushedBytes metrics.EWMA
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// New returns a new Cache that holds at most maxSize bytes of dirty data.
+// Dirty data is not flushed periodically if interval is not positive.
+// If fsync is true, files are synced to disk after each flush.
+func New(maxSize int64, interval time.Duration, fsync bool) *Cache {
+	c := &Cache{
+		maxSize:      maxSize,
+		interval:     interval,
+		fsync:        fsync,
+		files:        make(map[*File]time.Time),
+		failed:       make(map[*File]struct{}),
+		numRead:      metrics.NewEWMA1(),
+		numHit:       metrics.NewEWMA1(),
+		numFlush:     metrics.NewEWMA1(),
+		flushedBytes: metrics.NewEWMA1(),
+		closeC:       make(chan struct{}),
+		doneC:        make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+func (c *Cache) run() {
+	defer close(c.doneC)
+
+	var flushC <-chan time.Time
+	if c.interval > 0 {
+		flushTicker := time.NewTicker(c.interval)
+		defer flushTicker.Stop()
+		flushC = flushTicker.C
+	}
+
+	rateTicker := time.NewTicker(5 * time.Second)
+	defer rateTicker.Stop()
+
+	for {
+		select {
+		case <-flushC:
+			c.flushOlderThan(time.Now().Add(-c.interval))
+		case <-rateTicker.C:
+			c.numRead.Tick()
+			c.numHit.Tick()
+			c.numFlush.Tick()
+			c.flushedBytes.Tick()
+		case <-c.closeC:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush goroutine.
+// Files must be closed before closing the Cache in order to write remaining dirty data.
+func (c *Cache) Close() {
+	close(c.closeC)
+	<-c.doneC
+}
+
+// Wrap returns a File that writes to f through the cache.
+// onError is called once when the dirty data of the file cannot be written.
+// It is called with the lock of the file held, so it must not block or call methods of the file.
+func (c *Cache) Wrap(f storage.File, onError func(error)) *File {
+	return &File{
+		cache:   c,
+		file:    f,
+		onError: onError,
+	}
+}
+
+// Len returns the number of files that have dirty data in the cache.
+func (c *Cache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.files)
+}
+
+// Size returns the number of dirty bytes waiting to be written to disk.
+func (c *Cache) Size() int64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.size
+}
+
+// Utilization returns the percentage of reads that are served from dirty data in the cache.
+func (c *Cache) Utilization() int {
+	total := c.numRead.Rate()
+	if total == 0 {
+		return 0
+	}
+	return int((100 * c.numHit.Rate()) / total)
+}
+
+// FlushesPerSecond returns the rate of write operations issued to the underlying files.
+func (c *Cache) FlushesPerSecond() int {
+	return int(c.numFlush.Rate())
+}
+
+// FlushedBytesPerSecond returns the rate of bytes written to the underlying files.
+func (c *Cache) FlushedBytesPerSecond() int {
+	return int(c.flushedBytes.Rate())
+}
+
+// Errors returns the number of files that have failed to write their dirty data since the cache is created.
+func (c *Cache) Errors() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.numErrors
+}
+
+// Flush writes all dirty data in the cache to disk.
+func (c *Cache) Flush() error {
+	var err error
+	for _, f := range c.dirtyFiles() {
+		if ferr := f.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func (c *Cache) dirtyFiles() []*File {
+	c.m.Lock()
+	defer c.m.Unlock()
+	files := make([]*File, 0, len(c.files))
+	for f := range c.files {
+		files = append(files, f)
+	}
+	return files
+}
+
+func (c *Cache) flushOlderThan(t time.Time) {
+	for _, f := range c.filesDirtyBefore(t) {
+		// Write errors are saved in the file and returned from its next WriteAt, Flush or Close call.
+		_ = f.Flush()
+	}
+}
+
+func (c *Cache) filesDirtyBefore(t time.Time) []*File {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var files []*File
+	for f, since := range c.files {
+		if _, ok := c.failed[f]; ok {
+			continue
+		}
+		if since.Before(t) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// makeRoom flushes files with the oldest dirty data until the cache size is under the limit.
+// Write errors are saved in the file that cannot be written, so the caller only gets the error of its own file.
+// Files that cannot be written are skipped, so the cache may stay over the limit until they are closed.
+func (c *Cache) makeRoom() {
+	for {
+		f := c.oldestOverLimit()
+		if f == nil {
+			return
+		}
+		f.m.Lock()
+		_ = f.flush()
+		f.m.Unlock()
+	}
+}
+
+func (c *Cache) oldestOverLimit() *File {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.size <= c.maxSize {
+		return nil
+	}
+	var oldest *File
+	var oldestSince time.Time
+	for f, since := range c.files {
+		if _, ok := c.failed[f]; ok {
+			continue
+		}
+		if oldest == nil || since.Before(oldestSince) {
+			oldest, oldestSince = f, since
+		}
+	}
+	return oldest
+}
+
+// update must be called with f.m held.
+func (c *Cache) update(f *File, delta int64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.size += delta
+	if len(f.extents) == 0 {
+		delete(c.files, f)
+		delete(c.failed, f)
+		return
+	}
+	if _, ok := c.files[f]; !ok {
+		c.files[f] = time.Now()
+	}
+	if f.err != nil {
+		c.failed[f] = struct{}{}
+	}
+}
+
+// File is a storage.File that buffers writes in Cache.
+// Reads return the dirty data in the cache if it is not written to disk yet.
+type File struct {
+	cache *Cache
+	file  storage.File
+
+	m       sync.Mutex
+	extents []extent // sorted by offset, never overlapping or adjacent
+	err     error
+	onError func(error)
+}
+
+var _ storage.File = (*File)(nil)
+
+type extent struct {
+	off  int64
+	data []byte
+}
+
+func (e *extent) end() int64 {
+	return e.off + int64(len(e.data))
+}
+
+// WriteAt saves b into the cache.
+// Adjacent and overlapping writes are merged into a single extent.
+// If the cache is full, the oldest dirty files are written to disk before returning.
+// An error is returned only if the data of f cannot be written.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	f.m.Lock()
+	if f.err != nil {
+		f.m.Unlock()
+		return 0, f.err
+	}
+	delta := f.insert(b, off)
+	f.cache.update(f, delta)
+	f.m.Unlock()
+
+	f.cache.makeRoom()
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	return len(b), nil
+}
+
+func (f *File) insert(b []byte, off int64) (delta int64) {
+	end := off + int64(len(b))
+	i := sort.Search(len(f.extents), func(i int) bool { return f.extents[i].end() >= off })
+	j := i
+	for j < len(f.extents) && f.extents[j].off <= end {
+		j++
+	}
+	switch {
+	case i == j:
+		// Not touching any extent. Insert a new one.
+		data := make([]byte, len(b))
+		copy(data, b)
+		f.extents = append(f.extents, extent{})
+		copy(f.extents[i+1:], f.extents[i:])
+		f.extents[i] = extent{off: off, data: data}
+		return int64(len(b))
+	case j == i+1 && f.extents[i].end() == off:
+		// Sequential write right after an extent. Grow it in place.
+		f.extents[i].data = append(f.extents[i].data, b...)
+		return int64(len(b))
+	}
+	// Merge all touching extents with the new data.
+	start := off
+	if f.extents[i].off < start {
+		start = f.extents[i].off
+	}
+	stop := end
+	if f.extents[j-1].end() > stop {
+		stop = f.extents[j-1].end()
+	}
+	data := make([]byte, stop-start)
+	var old int64
+	for _, e := range f.extents[i:j] {
+		copy(data[e.off-start:], e.data)
+		old += int64(len(e.data))
+	}
+	copy(data[off-start:], b)
+	f.extents[i] = extent{off: start, data: data}
+	f.extents = append(f.extents[:i+1], f.extents[j:]...)
+	return int64(len(data)) - old
+}
+
+// ReadAt reads from the underlying file and overlays dirty data in the cache.
+// After a write error, reads fail because the data on disk may not match the pieces that are marked as downloaded.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	f.cache.numRead.Update(1)
+	end := off + int64(len(b))
+	i := sort.Search(len(f.extents), func(i int) bool { return f.extents[i].end() > off })
+	if i < len(f.extents) && f.extents[i].off <= off && f.extents[i].end() >= end {
+		// Served completely from the cache.
+		f.cache.numHit.Update(1)
+		e := f.extents[i]
+		return copy(b, e.data[off-e.off:]), nil
+	}
+	n, err := f.file.ReadAt(b, off)
+	for ; i < len(f.extents) && f.extents[i].off < end; i++ {
+		e := f.extents[i]
+		if e.off >= off {
+			copy(b[e.off-off:], e.data)
+		} else {
+			copy(b, e.data[off-e.off:])
+		}
+	}
+	return n, err
+}
+
+// Flush writes the dirty data of f to disk.
+func (f *File) Flush() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.flush()
+}
+
+func (f *File) flush() error {
+	if f.err != nil {
+		return f.err
+	}
+	if len(f.extents) == 0 {
+		return nil
+	}
+	var size int64
+	for len(f.extents) > 0 {
+		e := f.extents[0]
+		_, err := f.file.WriteAt(e.data, e.off)
+		if err != nil {
+			f.setError(err)
+			break
+		}
+		size += int64(len(e.data))
+		f.extents = f.extents[1:]
+		f.cache.numFlush.Update(1)
+		f.cache.flushedBytes.Update(int64(len(e.data)))
+	}
+	if len(f.extents) == 0 {
+		f.extents = nil
+	}
+	f.cache.update(f, -size)
+	if f.err == nil && f.cache.fsync {
+		if s, ok := f.file.(syncer); ok {
+			if err := s.Sync(); err != nil {
+				f.setError(err)
+			}
+		}
+	}
+	return f.err
+}
+
+// setError saves the first write error of f and reports it. Must be called with f.m held.
+func (f *File) setError(err error) {
+	f.err = err
+	f.cache.m.Lock()
+	f.cache.numErrors++
+	f.cache.m.Unlock()
+	f.cache.update(f, 0)
+	if f.onError != nil {
+		f.onError(err)
+	}
+}
+
+// drop discards the dirty data of f. Must be called with f.m held.
+func (f *File) drop() {
+	if len(f.extents) == 0 {
+		return
+	}
+	var size int64
+	for _, e := range f.extents {
+		size += int64(len(e.data))
+	}
+	f.extents = nil
+	f.cache.update(f, -size)
+}
+
+type syncer interface {
+	Sync() error
+}
+
+// Close writes the dirty data to disk and closes the underlying file.
+func (f *File) Close() error {
+	f.m.Lock()
+	err := f.flush()
+	// Data that cannot be written is lost after the file is closed.
+	f.drop()
+	f.m.Unlock()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,222 @@
+package writecache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+type memFile struct {
+	data   []byte
+	writes int
+	closed bool
+	err    error
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	return copy(b, f.data[off:]), nil
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.writes++
+	return copy(f.data[off:], b), nil
+}
+
+func (f *memFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestCoalesce(t *testing.T) {
+	c := New(100, time.Minute, false)
+	defer c.Close()
+
+	mf := &memFile{data: make([]byte, 10)}
+	f := c.Wrap(mf, nil)
+
+	if _, err := f.WriteAt([]byte("ab"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("cd"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("gh"), 6); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.extents) != 2 {
+		t.Fatalf("unexpected number of extents: %d", len(f.extents))
+	}
+	if c.Size() != 6 {
+		t.Fatalf("unexpected cache size: %d", c.Size())
+	}
+
+	// Fill the gap between extents.
+	if _, err := f.WriteAt([]byte("ef"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.extents) != 1 {
+		t.Fatalf("unexpected number of extents: %d", len(f.extents))
+	}
+	if c.Size() != 8 {
+		t.Fatalf("unexpected cache size: %d", c.Size())
+	}
+
+	// Overwrite existing data.
+	if _, err := f.WriteAt([]byte("XY"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 8 {
+		t.Fatalf("unexpected cache size: %d", c.Size())
+	}
+
+	// Nothing must be written yet but reads must return the cached data.
+	if mf.writes != 0 {
+		t.Fatal("file is written before flush")
+	}
+	b := make([]byte, 10)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("abcXYfgh\x00\x00")) {
+		t.Fatalf("unexpected data: %q", b)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mf.writes != 1 {
+		t.Fatalf("unexpected number of writes: %d", mf.writes)
+	}
+	if !mf.closed {
+		t.Fatal("file is not closed")
+	}
+	if !bytes.Equal(mf.data, []byte("abcXYfgh\x00\x00")) {
+		t.Fatalf("unexpected data: %q", mf.data)
+	}
+	if c.Size() != 0 || c.Len() != 0 {
+		t.FailNow()
+	}
+}
+
+func TestMakeRoom(t *testing.T) {
+	c := New(4, time.Minute, false)
+	defer c.Close()
+
+	mf1 := &memFile{data: make([]byte, 4)}
+	f1 := c.Wrap(mf1, nil)
+	mf2 := &memFile{data: make([]byte, 4)}
+	f2 := c.Wrap(mf2, nil)
+
+	if _, err := f1.WriteAt([]byte("abc"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f2.WriteAt([]byte("de"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// Oldest file must be flushed to make room.
+	if mf1.writes != 1 || mf2.writes != 0 {
+		t.Fatalf("unexpected writes: %d %d", mf1.writes, mf2.writes)
+	}
+	if c.Size() != 2 || c.Len() != 1 {
+		t.FailNow()
+	}
+}
+
+func TestMakeRoomError(t *testing.T) {
+	c := New(4, time.Minute, false)
+	defer c.Close()
+
+	errDisk := errors.New("disk error")
+	mf1 := &memFile{data: make([]byte, 4), err: errDisk}
+	var reported []error
+	f1 := c.Wrap(mf1, func(err error) { reported = append(reported, err) })
+	mf2 := &memFile{data: make([]byte, 4)}
+	f2 := c.Wrap(mf2, nil)
+
+	if _, err := f1.WriteAt([]byte("abc"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	// Error of the other file must not be returned.
+	if _, err := f2.WriteAt([]byte("de"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// Data that cannot be written is kept, because its pieces are marked as downloaded.
+	// Other file is flushed to make room instead.
+	if c.Size() != 3 || c.Len() != 1 || mf2.writes != 1 {
+		t.Fatalf("unexpected cache size: %d", c.Size())
+	}
+	if len(reported) != 1 || reported[0] != errDisk {
+		t.Fatalf("unexpected reported errors: %v", reported)
+	}
+	if err := f1.Flush(); err != errDisk {
+		t.Fatal(err)
+	}
+	if _, err := f1.WriteAt([]byte("abc"), 0); err != errDisk {
+		t.Fatal(err)
+	}
+	// Stale data on disk must not be read.
+	if _, err := f1.ReadAt(make([]byte, 3), 0); err != errDisk {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("error is reported more than once: %v", reported)
+	}
+	if _, err := f2.WriteAt([]byte("fg"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if mf2.writes != 2 {
+		t.Fatalf("unexpected writes: %d", mf2.writes)
+	}
+	if err := f1.Close(); err != errDisk {
+		t.Fatal(err)
+	}
+	if c.Size() != 0 || c.Len() != 0 {
+		t.Fatalf("unexpected cache size after close: %d", c.Size())
+	}
+}
+
+func TestNoFlushInterval(t *testing.T) {
+	c := New(100, 0, false)
+	defer c.Close()
+
+	mf := &memFile{data: make([]byte, 4)}
+	f := c.Wrap(mf, nil)
+	if _, err := f.WriteAt([]byte("abcd"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mf.writes != 1 {
+		t.Fatalf("unexpected number of writes: %d", mf.writes)
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	const interval = 100 * time.Millisecond
+
+	c := New(100, interval, false)
+	defer c.Close()
+
+	mf := &memFile{data: make([]byte, 4)}
+	f := c.Wrap(mf, nil)
+	if _, err := f.WriteAt([]byte("abcd"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(3 * interval)
+	f.m.Lock()
+	writes := mf.writes
+	f.m.Unlock()
+	if writes != 1 {
+		t.Fatalf("unexpected number of writes: %d", writes)
+	}
+	if c.Size() != 0 {
+		t.FailNow()
+	}
+}
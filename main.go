@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -24,11 +26,17 @@ import (
 	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli"
 	"github.com/zeebo/bencode"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v2"
 )
 
 var (
 	app = cli.NewApp()
+	// filterFlag selects multiple torrents for client commands.
+	filterFlag = cli.StringSliceFlag{
+		Name:  "filter, f",
+		Usage: "select torrents matching `KEY=VALUE`, may be repeated. Keys: id, status, name (glob), tracker (host), label",
+	}
 	clt *rainrpc.Client
 	log = logger.New("rain")
 )
@@ -87,51 +95,98 @@ func main() {
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "url",
-					Usage: "URL of RPC server",
+					Usage: "URL of RPC server, may contain credentials for basic auth",
 					Value: "http://127.0.0.1:" + strconv.Itoa(torrent.DefaultConfig.RPCPort),
 				},
+				cli.StringFlag{
+					Name:   "token",
+					Usage:  "bearer `TOKEN` for authenticating to RPC server",
+					EnvVar: "RAIN_RPC_TOKEN",
+				},
+				cli.StringFlag{
+					Name:  "cacert",
+					Usage: "verify server certificate with CA certificate in `FILE`",
+				},
+				cli.BoolFlag{
+					Name:  "insecure",
+					Usage: "do not verify server certificate",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "output `FORMAT`: pretty, json, yaml, table or template",
+					Value: outputPretty,
+				},
+				cli.StringFlag{
+					Name:  "template",
+					Usage: "Go text/template `TEXT` for template output, e.g. '{{range .}}{{println .ID .Name}}{{end}}'",
+				},
+				cli.DurationFlag{
+					Name:  "watch, w",
+					Usage: "repeat read-only commands at `INTERVAL`, e.g. 2s",
+				},
 			},
 			Before: handleBeforeClient,
 			Subcommands: []cli.Command{
 				{
 					Name:   "version",
 					Usage:  "server version",
-					Action: handleVersion,
+					Action: watch(handleVersion),
 				},
 				{
-					Name:   "list",
-					Usage:  "list torrents",
-					Action: handleList,
+					Name:  "list",
+					Usage: "list torrents",
+					Flags: []cli.Flag{
+						filterFlag,
+						cli.StringFlag{
+							Name:  "fields",
+							Usage: "comma separated stats `FIELDS` to include, e.g. Status,Bytes",
+						},
+					},
+					Action: watch(handleList),
 				},
 				{
-					Name:   "add",
-					Usage:  "add torrent or magnet",
+					Name:  "add",
+					Usage: "add torrent or magnet",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "existing-data",
+							Usage: "search `DIR` on server for already downloaded files of the torrent",
+						},
+					},
 					Action: handleAdd,
 				},
 				{
-					Name:   "remove",
-					Usage:  "remove torrent",
+					Name:  "remove",
+					Usage: "remove torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+					},
 					Action: handleRemove,
 				},
 				{
 					Name:   "stats",
 					Usage:  "get stats of torrent",
-					Action: handleStats,
+					Action: watch(handleStats),
 				},
 				{
 					Name:   "session-stats",
 					Usage:  "get stats of session",
-					Action: handleSessionStats,
+					Action: watch(handleSessionStats),
 				},
 				{
 					Name:   "trackers",
 					Usage:  "get trackers of torrent",
-					Action: handleTrackers,
+					Action: watch(handleTrackers),
 				},
 				{
 					Name:   "peers",
 					Usage:  "get peers of torrent",
-					Action: handlePeers,
+					Action: watch(handlePeers),
+				},
+				{
+					Name:   "files",
+					Usage:  "get files of torrent",
+					Action: watch(handleFiles),
 				},
 				{
 					Name:   "add-peer",
@@ -144,15 +199,57 @@ func main() {
 					Action: handleAddTracker,
 				},
 				{
-					Name:   "start",
-					Usage:  "start torrent",
+					Name:  "start",
+					Usage: "start torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+					},
 					Action: handleStart,
 				},
 				{
-					Name:   "stop",
-					Usage:  "stop torrent",
+					Name:  "stop",
+					Usage: "stop torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+					},
 					Action: handleStop,
 				},
+				{
+					Name:  "verify",
+					Usage: "verify files of torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+					},
+					Action: handleVerify,
+				},
+				{
+					Name:  "set-labels",
+					Usage: "set labels of torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+						cli.StringSliceFlag{
+							Name:  "label, l",
+							Usage: "set `LABEL`, may be repeated. Labels are removed if not given",
+						},
+					},
+					Action: handleSetLabels,
+				},
+				{
+					Name:  "set-limits",
+					Usage: "set speed limits of torrent",
+					Flags: []cli.Flag{
+						filterFlag,
+						cli.Int64Flag{
+							Name:  "download",
+							Usage: "download limit in `BYTES` per second, 0 is unlimited",
+						},
+						cli.Int64Flag{
+							Name:  "upload",
+							Usage: "upload limit in `BYTES` per second, 0 is unlimited",
+						},
+					},
+					Action: handleSetLimits,
+				},
 				{
 					Name:   "start-all",
 					Usage:  "start all torrents",
@@ -164,12 +261,76 @@ func main() {
 					Action: handleStopAll,
 				},
 				{
-					Name:   "console",
-					Usage:  "show client console",
+					Name:   "config",
+					Usage:  "print session config",
+					Action: watch(handleGetConfig),
+				},
+				{
+					Name:      "set-config",
+					Usage:     "change reloadable fields of session config",
+					ArgsUsage: "FIELD=VALUE...",
+					Action:    handleSetConfig,
+				},
+				{
+					Name:   "bans",
+					Usage:  "list banned peer IPs",
+					Action: watch(handleListBans),
+				},
+				{
+					Name:      "ban",
+					Usage:     "ban peer IP",
+					ArgsUsage: "IP",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "reason",
+							Usage: "reason of the ban",
+						},
+						cli.DurationFlag{
+							Name:  "duration",
+							Usage: "lift the ban after `DURATION`, e.g. 24h (default: permanent)",
+						},
+					},
+					Action: handleAddBan,
+				},
+				{
+					Name:      "unban",
+					Usage:     "remove ban of peer IP",
+					ArgsUsage: "IP",
+					Action:    handleRemoveBan,
+				},
+				{
+					Name:  "events",
+					Usage: "print events as they happen",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "torrent",
+							Usage: "only print events of torrent with `ID`",
+						},
+					},
+					Action: handleEvents,
+				},
+				{
+					Name:  "console",
+					Usage: "show client console",
+					Description: "Keys:\n" +
+						"   j/k, g/G       move selection, go to top/bottom\n" +
+						"   s/S, R         start/stop, remove torrent\n" +
+						"   a              add torrent from file path, magnet link or URL\n" +
+						"   p, t           add peer, add tracker to torrent\n" +
+						"   o, O           change sort column, reverse sort order\n" +
+						"   /              filter torrents by name or KEY=VALUE (id, status, name, tracker)\n" +
+						"   ctrl+g/t/p/w   show general/trackers/peers/webseeds tab\n" +
+						"   ctrl+f, ctrl+o show files, piece map tab\n" +
+						"   q              quit",
 					Action: handleConsole,
 				},
 			},
 		},
+		{
+			Name:   "hash-password",
+			Usage:  "read password from stdin and print its hash for rpcusers config",
+			Action: handleHashPassword,
+		},
 		{
 			Name:   "boltbrowser",
 			Hidden: true,
@@ -193,6 +354,23 @@ func main() {
 	}
 }
 
+func handleHashPassword(c *cli.Context) error {
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	password := strings.TrimRight(string(b), "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
 func handleBoltBrowser(c *cli.Context) error {
 	db, err := bolt.Open(c.Args().Get(0), 0600, nil)
 	if err != nil {
@@ -245,32 +423,10 @@ func handleAfterCommand(c *cli.Context) error {
 }
 
 func handleServer(c *cli.Context) error {
-	cfg := torrent.DefaultConfig
-
 	configPath := c.String("config")
-	if configPath != "" {
-		cp, err := homedir.Expand(configPath)
-		if err != nil {
-			return err
-		}
-		b, err := ioutil.ReadFile(cp) // nolint: gosec
-		switch {
-		case os.IsNotExist(err):
-			log.Noticef("config file not found at %q, using default config", cp)
-		case err != nil:
-			return err
-		default:
-			err = yaml.Unmarshal(b, &cfg)
-			if err != nil {
-				return err
-			}
-			log.Infoln("config loaded from:", cp)
-			b, err = yaml.Marshal(&cfg)
-			if err != nil {
-				return err
-			}
-			log.Debug("\n" + string(b))
-		}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
 	}
 
 	ses, err := torrent.NewSession(cfg)
@@ -278,9 +434,23 @@ func handleServer(c *cli.Context) error {
 		return err
 	}
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	s := <-ch
-	log.Noticef("received %s, stopping server", s)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range ch {
+		if s != syscall.SIGHUP {
+			log.Noticef("received %s, stopping server", s)
+			break
+		}
+		log.Noticef("received %s, reloading config", s)
+		cfg, err = loadConfig(configPath)
+		if err != nil {
+			log.Errorln("cannot reload config:", err)
+			continue
+		}
+		err = ses.UpdateConfig(cfg)
+		if err != nil {
+			log.Warningln(err)
+		}
+	}
 
 	memprofile := c.GlobalString("memprofile")
 	if memprofile != "" {
@@ -301,9 +471,48 @@ func handleServer(c *cli.Context) error {
 	return ses.Close()
 }
 
+// loadConfig returns the default config overridden by the values in YAML file at configPath.
+func loadConfig(configPath string) (torrent.Config, error) {
+	cfg := torrent.DefaultConfig
+	if configPath == "" {
+		return cfg, nil
+	}
+	cp, err := homedir.Expand(configPath)
+	if err != nil {
+		return cfg, err
+	}
+	b, err := ioutil.ReadFile(cp) // nolint: gosec
+	switch {
+	case os.IsNotExist(err):
+		log.Noticef("config file not found at %q, using default config", cp)
+	case err != nil:
+		return cfg, err
+	default:
+		err = yaml.Unmarshal(b, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+		log.Infoln("config loaded from:", cp)
+		b, err = yaml.Marshal(&cfg)
+		if err != nil {
+			return cfg, err
+		}
+		log.Debug("\n" + string(b))
+	}
+	return cfg, nil
+}
+
 func handleBeforeClient(c *cli.Context) error {
-	clt = rainrpc.NewClient(c.String("url"))
-	return nil
+	err := setOutput(c)
+	if err != nil {
+		return err
+	}
+	clt, err = rainrpc.NewClientWithOptions(c.String("url"), &rainrpc.ClientOptions{
+		Token:              c.String("token"),
+		CAFile:             c.String("cacert"),
+		InsecureSkipVerify: c.Bool("insecure"),
+	})
+	return err
 }
 
 func handleVersion(c *cli.Context) error {
@@ -311,56 +520,91 @@ func handleVersion(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	_, _ = os.Stdout.WriteString(version)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(version)
+}
+
+func parseFilter(c *cli.Context) (f rainrpc.TorrentFilter, ok bool, err error) {
+	terms := c.StringSlice("filter")
+	for _, term := range terms {
+		i := strings.IndexByte(term, '=')
+		if i < 0 {
+			return f, false, fmt.Errorf("invalid filter: %q", term)
+		}
+		key, value := term[:i], term[i+1:]
+		switch key {
+		case "id":
+			f.IDs = append(f.IDs, value)
+		case "status":
+			f.Status = append(f.Status, value)
+		case "name":
+			f.Name = value
+		case "tracker":
+			f.TrackerHost = value
+		case "label":
+			f.Label = value
+		default:
+			return f, false, fmt.Errorf("unknown filter key: %q", key)
+		}
+	}
+	return f, len(terms) > 0, nil
 }
 
 func handleList(c *cli.Context) error {
-	resp, err := clt.ListTorrents()
+	filter, ok, err := parseFilter(c)
 	if err != nil {
 		return err
 	}
-	b, err := prettyjson.Marshal(resp)
+	if ok || c.String("fields") != "" {
+		var fields []string
+		if c.String("fields") != "" {
+			fields = strings.Split(c.String("fields"), ",")
+		}
+		resp, err := clt.ListTorrentsWithStats(filter, fields)
+		if err != nil {
+			return err
+		}
+		return printOutput(resp)
+	}
+	resp, err := clt.ListTorrents()
 	if err != nil {
 		return err
 	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(resp)
 }
 
 func handleAdd(c *cli.Context) error {
-	var b []byte
-	var marshalErr error
 	arg := c.Args().Get(0)
 	if strings.HasPrefix(arg, "magnet:") || strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
 		resp, err := clt.AddURI(arg)
 		if err != nil {
 			return err
 		}
-		b, marshalErr = prettyjson.Marshal(resp)
-	} else {
-		f, err := os.Open(arg) // nolint: gosec
-		if err != nil {
-			return err
-		}
-		resp, err := clt.AddTorrent(f)
-		_ = f.Close()
-		if err != nil {
-			return err
-		}
-		b, marshalErr = prettyjson.Marshal(resp)
+		return printOutput(resp)
 	}
-	if marshalErr != nil {
-		return marshalErr
+	f, err := os.Open(arg) // nolint: gosec
+	if err != nil {
+		return err
 	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	resp, err := clt.AddTorrentWithOptions(f, &rainrpc.AddTorrentOptions{FindExistingDataIn: c.String("existing-data")})
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
 }
 
 func handleRemove(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if ok {
+		resp, err := clt.RemoveTorrents(filter)
+		if err != nil {
+			return err
+		}
+		return printOutput(resp)
+	}
 	id := c.Args().Get(0)
 	return clt.RemoveTorrent(id)
 }
@@ -371,13 +615,7 @@ func handleStats(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	b, err := prettyjson.Marshal(resp)
-	if err != nil {
-		return err
-	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(resp)
 }
 
 func handleSessionStats(c *cli.Context) error {
@@ -385,13 +623,7 @@ func handleSessionStats(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	b, err := prettyjson.Marshal(resp)
-	if err != nil {
-		return err
-	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(resp)
 }
 
 func handleTrackers(c *cli.Context) error {
@@ -400,13 +632,7 @@ func handleTrackers(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	b, err := prettyjson.Marshal(resp)
-	if err != nil {
-		return err
-	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(resp)
 }
 
 func handlePeers(c *cli.Context) error {
@@ -415,13 +641,16 @@ func handlePeers(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	b, err := prettyjson.Marshal(resp)
+	return printOutput(resp)
+}
+
+func handleFiles(c *cli.Context) error {
+	id := c.Args().Get(0)
+	resp, err := clt.GetTorrentFiles(id)
 	if err != nil {
 		return err
 	}
-	_, _ = os.Stdout.Write(b)
-	_, _ = os.Stdout.WriteString("\n")
-	return nil
+	return printOutput(resp)
 }
 
 func handleAddPeer(c *cli.Context) error {
@@ -437,15 +666,112 @@ func handleAddTracker(c *cli.Context) error {
 }
 
 func handleStart(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if ok {
+		resp, err := clt.StartTorrents(filter)
+		if err != nil {
+			return err
+		}
+		return printOutput(resp)
+	}
 	id := c.Args().Get(0)
 	return clt.StartTorrent(id)
 }
 
 func handleStop(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if ok {
+		resp, err := clt.StopTorrents(filter)
+		if err != nil {
+			return err
+		}
+		return printOutput(resp)
+	}
 	id := c.Args().Get(0)
 	return clt.StopTorrent(id)
 }
 
+func handleVerify(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if ok {
+		resp, err := clt.VerifyTorrents(filter)
+		if err != nil {
+			return err
+		}
+		return printOutput(resp)
+	}
+	id := c.Args().Get(0)
+	resp, err := clt.VerifyTorrent(id)
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
+}
+
+func handleSetLabels(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		filter.IDs = []string{c.Args().Get(0)}
+	}
+	resp, err := clt.SetTorrentLabels(filter, c.StringSlice("label"))
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
+}
+
+func handleSetLimits(c *cli.Context) error {
+	filter, ok, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		filter.IDs = []string{c.Args().Get(0)}
+	}
+	resp, err := clt.SetTorrentLimits(filter, c.Int64("download"), c.Int64("upload"))
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
+}
+
+func handleEvents(c *cli.Context) error {
+	sub, err := clt.Subscribe(c.String("torrent"))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	for e := range sub.C {
+		// Print one event per line unless another format is requested.
+		if outputFormat == outputPretty {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, _ = os.Stdout.Write(b)
+			_, _ = os.Stdout.WriteString("\n")
+			continue
+		}
+		err = printOutput(e)
+		if err != nil {
+			return err
+		}
+	}
+	return sub.Err
+}
+
 func handleStartAll(c *cli.Context) error {
 	return clt.StartAllTorrents()
 }
@@ -454,6 +780,50 @@ func handleStopAll(c *cli.Context) error {
 	return clt.StopAllTorrents()
 }
 
+func handleGetConfig(c *cli.Context) error {
+	resp, err := clt.GetConfig()
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
+}
+
+func handleSetConfig(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New("no field is given")
+	}
+	values := make(map[string]interface{}, c.NArg())
+	for _, arg := range c.Args() {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid argument: %q, must be in FIELD=VALUE format", arg)
+		}
+		// Values that are not valid JSON like durations ("1m30s") are sent as string.
+		var v interface{}
+		if json.Unmarshal([]byte(kv[1]), &v) != nil {
+			v = kv[1]
+		}
+		values[kv[0]] = v
+	}
+	return clt.SetConfig(values)
+}
+
+func handleListBans(c *cli.Context) error {
+	resp, err := clt.ListBans()
+	if err != nil {
+		return err
+	}
+	return printOutput(resp)
+}
+
+func handleAddBan(c *cli.Context) error {
+	return clt.AddBan(c.Args().Get(0), c.String("reason"), c.Duration("duration"))
+}
+
+func handleRemoveBan(c *cli.Context) error {
+	return clt.RemoveBan(c.Args().Get(0))
+}
+
 func handleConsole(c *cli.Context) error {
 	con := console.New(clt)
 	return con.Run()
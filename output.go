@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats for --output flag of client command.
+const (
+	outputPretty   = "pretty"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputTable    = "table"
+	outputTemplate = "template"
+)
+
+var (
+	outputFormat   = outputPretty
+	outputTmpl     *template.Template
+	watchInterval  time.Duration
+	outputFormats  = []string{outputPretty, outputJSON, outputYAML, outputTable, outputTemplate}
+	errNoTemplate  = errors.New("--template must be given for template output")
+	errBadInterval = errors.New("--watch interval must be positive")
+)
+
+// setOutput validates and saves the output flags of client command.
+func setOutput(c *cli.Context) error {
+	outputFormat = c.String("output")
+	switch outputFormat {
+	case outputPretty, outputJSON, outputYAML, outputTable:
+	case outputTemplate:
+		if c.String("template") == "" {
+			return errNoTemplate
+		}
+		var err error
+		outputTmpl, err = template.New("output").Parse(c.String("template"))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format: %q, must be one of: %s", outputFormat, strings.Join(outputFormats, ", "))
+	}
+	if c.IsSet("watch") && c.Duration("watch") <= 0 {
+		return errBadInterval
+	}
+	watchInterval = c.Duration("watch")
+	return nil
+}
+
+// printOutput writes v to stdout in the format that is selected with --output flag.
+func printOutput(v interface{}) error {
+	var b []byte
+	var err error
+	switch outputFormat {
+	case outputJSON:
+		b, err = json.MarshalIndent(v, "", "  ")
+	case outputYAML:
+		var gv interface{}
+		gv, err = toGeneric(v)
+		if err != nil {
+			return err
+		}
+		b, err = yaml.Marshal(gv)
+		b = bytes.TrimSuffix(b, []byte("\n"))
+	case outputTable:
+		b = formatTable(v)
+	case outputTemplate:
+		return outputTmpl.Execute(os.Stdout, v)
+	default:
+		if s, ok := v.(string); ok {
+			b = []byte(s)
+		} else {
+			b, err = prettyjson.Marshal(v)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
+// watch returns an action that runs fn at the interval given with --watch flag until an error occurs.
+// Screen is cleared before each run if output is meant to be read by humans.
+func watch(fn func(c *cli.Context) error) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if watchInterval == 0 {
+			return fn(c)
+		}
+		for {
+			if outputFormat == outputPretty || outputFormat == outputTable {
+				_, _ = os.Stdout.WriteString("\033[H\033[2J")
+			}
+			err := fn(c)
+			if err != nil {
+				return err
+			}
+			time.Sleep(watchInterval)
+		}
+	}
+}
+
+// toGeneric converts v to maps, slices and basic types with the same structure as its JSON encoding.
+// Integers are kept as int64 so that they are not formatted as floats.
+func toGeneric(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var gv interface{}
+	err = dec.Decode(&gv)
+	if err != nil {
+		return nil, err
+	}
+	return convertNumbers(gv), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = convertNumbers(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = convertNumbers(val)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+type tableField struct {
+	key, value string
+}
+
+// formatTable formats slices as a table with a row for each element and a column for each field.
+// Other values are formatted as a table of keys and values.
+// Nested fields are flattened into columns with dotted names.
+func formatTable(v interface{}) []byte {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	// Responses that only wrap a list are printed as the list itself.
+	if rv.Kind() == reflect.Struct && rv.NumField() == 1 && rv.Type().Field(0).PkgPath == "" && rv.Field(0).Kind() == reflect.Slice {
+		rv = rv.Field(0)
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		rows := make([][]tableField, rv.Len())
+		var columns []string
+		seen := make(map[string]bool)
+		for i := range rows {
+			flattenTable("", rv.Index(i), &rows[i])
+			for _, f := range rows[i] {
+				if !seen[f.key] {
+					seen[f.key] = true
+					columns = append(columns, f.key)
+				}
+			}
+		}
+		if len(columns) == 1 && columns[0] == "" {
+			// Elements are not structs. Print one per line.
+			for _, row := range rows {
+				fmt.Fprintln(w, row[0].value)
+			}
+			break
+		}
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, row := range rows {
+			values := make(map[string]string, len(row))
+			for _, f := range row {
+				values[f.key] = f.value
+			}
+			line := make([]string, len(columns))
+			for i, col := range columns {
+				line[i] = values[col]
+			}
+			fmt.Fprintln(w, strings.Join(line, "\t"))
+		}
+	default:
+		var fields []tableField
+		flattenTable("", rv, &fields)
+		for _, f := range fields {
+			if f.key == "" {
+				fmt.Fprintln(w, f.value)
+			} else {
+				fmt.Fprintf(w, "%s:\t%s\n", f.key, f.value)
+			}
+		}
+	}
+	_ = w.Flush()
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+func flattenTable(prefix string, v reflect.Value, out *[]tableField) {
+	name := strings.TrimSuffix(prefix, ".")
+	if !v.IsValid() {
+		*out = append(*out, tableField{name, ""})
+		return
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			*out = append(*out, tableField{name, ""})
+			return
+		}
+		flattenTable(prefix, v.Elem(), out)
+		return
+	}
+	if t, ok := v.Interface().(interface{ MarshalText() ([]byte, error) }); ok {
+		b, _ := t.MarshalText()
+		*out = append(*out, tableField{name, string(b)})
+		return
+	}
+	if v.Type().Implements(stringerType) {
+		*out = append(*out, tableField{name, v.Interface().(fmt.Stringer).String()})
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Anonymous {
+				flattenTable(prefix, v.Field(i), out)
+			} else {
+				flattenTable(prefix+f.Name+".", v.Field(i), out)
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			flattenTable(prefix+fmt.Sprint(k)+".", v.MapIndex(k), out)
+		}
+	case reflect.Slice, reflect.Array:
+		b, _ := json.Marshal(v.Interface())
+		*out = append(*out, tableField{name, string(b)})
+	default:
+		*out = append(*out, tableField{name, fmt.Sprint(v.Interface())})
+	}
+}
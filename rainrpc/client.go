@@ -2,9 +2,15 @@
 package rainrpc
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/ProtocolONE/rain/internal/rpctypes"
 	"github.com/powerman/rpc-codec/jsonrpc2"
@@ -12,10 +18,76 @@ import (
 
 type Client struct {
 	client *jsonrpc2.Client
+	addr   string
+	doer   jsonrpc2.Doer
 }
 
+// ClientOptions contains options for connecting to the RPC server.
+type ClientOptions struct {
+	// Token is sent in "Authorization: Bearer <token>" header.
+	Token string
+	// Username and Password are sent with HTTP basic authentication.
+	// If not set, credentials in the user info part of the server URL are used.
+	Username string
+	Password string
+	// CAFile is the PEM encoded certificate file for verifying the server certificate.
+	// System roots are used if empty.
+	CAFile string
+	// Do not verify the server certificate.
+	InsecureSkipVerify bool
+}
+
+// NewClient returns a new Client for the RPC server at addr.
 func NewClient(addr string) *Client {
-	return &Client{client: jsonrpc2.NewHTTPClient(addr)}
+	// Error is returned only when reading the CA file in options.
+	c, _ := NewClientWithOptions(addr, nil)
+	return c
+}
+
+// NewClientWithOptions returns a new Client for the RPC server at addr with authentication and TLS options.
+// opt may be nil.
+func NewClientWithOptions(addr string, opt *ClientOptions) (*Client, error) {
+	if opt == nil {
+		opt = &ClientOptions{}
+	}
+	username, password := opt.Username, opt.Password
+	if u, err := url.Parse(addr); err == nil && u.User != nil {
+		if username == "" {
+			username = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		u.User = nil
+		addr = u.String()
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: opt.InsecureSkipVerify} // nolint: gosec
+	if opt.CAFile != "" {
+		pem, err := ioutil.ReadFile(opt.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in CA file")
+		}
+	}
+	httpClient := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}}
+	doer := jsonrpc2.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case opt.Token != "":
+			req.Header.Set("Authorization", "Bearer "+opt.Token)
+		case username != "":
+			req.SetBasicAuth(username, password)
+		}
+		return httpClient.Do(req)
+	})
+	return &Client{
+		client: jsonrpc2.NewCustomHTTPClient(addr, doer),
+		addr:   addr,
+		doer:   doer,
+	}, nil
 }
 
 func (c *Client) Close() error {
@@ -32,12 +104,27 @@ func (c *Client) ListTorrents() ([]rpctypes.Torrent, error) {
 	return reply.Torrents, c.client.Call("Session.ListTorrents", nil, &reply)
 }
 
+// AddTorrentOptions contains options for adding a new torrent.
+type AddTorrentOptions struct {
+	// Directory on the server to search for the files of the torrent that are already downloaded.
+	FindExistingDataIn string
+}
+
+// AddTorrent adds the torrent file in f to the session.
 func (c *Client) AddTorrent(f io.Reader) (*rpctypes.Torrent, error) {
+	return c.AddTorrentWithOptions(f, nil)
+}
+
+// AddTorrentWithOptions is same as AddTorrent but accepts options for adding the torrent. opt may be nil.
+func (c *Client) AddTorrentWithOptions(f io.Reader, opt *AddTorrentOptions) (*rpctypes.Torrent, error) {
 	b, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, err
 	}
 	args := rpctypes.AddTorrentRequest{Torrent: base64.StdEncoding.EncodeToString(b)}
+	if opt != nil {
+		args.FindExistingDataIn = opt.FindExistingDataIn
+	}
 	var reply rpctypes.AddTorrentResponse
 	return &reply.Torrent, c.client.Call("Session.AddTorrent", args, &reply)
 }
@@ -66,6 +153,41 @@ func (c *Client) GetSessionStats() (*rpctypes.SessionStats, error) {
 	return &reply.Stats, c.client.Call("Session.GetSessionStats", args, &reply)
 }
 
+// GetConfig returns the config of the session and the names of the fields that can be changed with SetConfig.
+func (c *Client) GetConfig() (*rpctypes.GetConfigResponse, error) {
+	args := rpctypes.GetConfigRequest{}
+	var reply rpctypes.GetConfigResponse
+	return &reply, c.client.Call("Session.GetConfig", args, &reply)
+}
+
+// SetConfig changes the given fields of the session config.
+func (c *Client) SetConfig(values map[string]interface{}) error {
+	args := rpctypes.SetConfigRequest{Config: values}
+	var reply rpctypes.SetConfigResponse
+	return c.client.Call("Session.SetConfig", args, &reply)
+}
+
+// ListBans returns the banned peer IPs.
+func (c *Client) ListBans() ([]rpctypes.Ban, error) {
+	args := rpctypes.ListBansRequest{}
+	var reply rpctypes.ListBansResponse
+	return reply.Bans, c.client.Call("Session.ListBans", args, &reply)
+}
+
+// AddBan bans the peer IP for duration. Zero duration makes a permanent ban.
+func (c *Client) AddBan(ip, reason string, duration time.Duration) error {
+	args := rpctypes.AddBanRequest{IP: ip, Reason: reason, Duration: uint(duration / time.Second)}
+	var reply rpctypes.AddBanResponse
+	return c.client.Call("Session.AddBan", args, &reply)
+}
+
+// RemoveBan lifts the ban of the peer IP.
+func (c *Client) RemoveBan(ip string) error {
+	args := rpctypes.RemoveBanRequest{IP: ip}
+	var reply rpctypes.RemoveBanResponse
+	return c.client.Call("Session.RemoveBan", args, &reply)
+}
+
 func (c *Client) GetTorrentTrackers(id string) ([]rpctypes.Tracker, error) {
 	args := rpctypes.GetTorrentTrackersRequest{ID: id}
 	var reply rpctypes.GetTorrentTrackersResponse
@@ -84,6 +206,18 @@ func (c *Client) GetTorrentWebseeds(id string) ([]rpctypes.Webseed, error) {
 	return reply.Webseeds, c.client.Call("Session.GetTorrentWebseeds", args, &reply)
 }
 
+func (c *Client) GetTorrentPieces(id string) (*rpctypes.GetTorrentPiecesResponse, error) {
+	args := rpctypes.GetTorrentPiecesRequest{ID: id}
+	var reply rpctypes.GetTorrentPiecesResponse
+	return &reply, c.client.Call("Session.GetTorrentPieces", args, &reply)
+}
+
+func (c *Client) GetTorrentFiles(id string) ([]rpctypes.File, error) {
+	args := rpctypes.GetTorrentFilesRequest{ID: id}
+	var reply rpctypes.GetTorrentFilesResponse
+	return reply.Files, c.client.Call("Session.GetTorrentFiles", args, &reply)
+}
+
 func (c *Client) StartTorrent(id string) error {
 	args := rpctypes.StartTorrentRequest{ID: id}
 	var reply rpctypes.StartTorrentResponse
@@ -119,3 +253,56 @@ func (c *Client) AddTracker(id string, uri string) error {
 	var reply rpctypes.AddTrackerResponse
 	return c.client.Call("Session.AddTracker", args, &reply)
 }
+
+func (c *Client) VerifyTorrent(id string) (*rpctypes.VerifyResult, error) {
+	args := rpctypes.VerifyTorrentRequest{ID: id}
+	var reply rpctypes.VerifyTorrentResponse
+	return &reply.Result, c.client.Call("Session.VerifyTorrent", args, &reply)
+}
+
+// TorrentFilter selects torrents in bulk operations. Empty fields match all torrents.
+type TorrentFilter = rpctypes.TorrentFilter
+
+// ListTorrentsWithStats returns the torrents matching filter with the named fields of their stats.
+// All stats fields are returned if fields is empty.
+func (c *Client) ListTorrentsWithStats(filter TorrentFilter, fields []string) ([]rpctypes.TorrentWithStats, error) {
+	args := rpctypes.ListTorrentsWithStatsRequest{Filter: filter, Fields: fields}
+	var reply rpctypes.ListTorrentsWithStatsResponse
+	return reply.Torrents, c.client.Call("Session.ListTorrentsWithStats", args, &reply)
+}
+
+func (c *Client) StartTorrents(filter TorrentFilter) ([]rpctypes.BulkResult, error) {
+	args := rpctypes.StartTorrentsRequest{Filter: filter}
+	var reply rpctypes.StartTorrentsResponse
+	return reply.Results, c.client.Call("Session.StartTorrents", args, &reply)
+}
+
+func (c *Client) StopTorrents(filter TorrentFilter) ([]rpctypes.BulkResult, error) {
+	args := rpctypes.StopTorrentsRequest{Filter: filter}
+	var reply rpctypes.StopTorrentsResponse
+	return reply.Results, c.client.Call("Session.StopTorrents", args, &reply)
+}
+
+func (c *Client) RemoveTorrents(filter TorrentFilter) ([]rpctypes.BulkResult, error) {
+	args := rpctypes.RemoveTorrentsRequest{Filter: filter}
+	var reply rpctypes.RemoveTorrentsResponse
+	return reply.Results, c.client.Call("Session.RemoveTorrents", args, &reply)
+}
+
+func (c *Client) SetTorrentLabels(filter TorrentFilter, labels []string) ([]rpctypes.BulkResult, error) {
+	args := rpctypes.SetTorrentLabelsRequest{Filter: filter, Labels: labels}
+	var reply rpctypes.SetTorrentLabelsResponse
+	return reply.Results, c.client.Call("Session.SetTorrentLabels", args, &reply)
+}
+
+func (c *Client) SetTorrentLimits(filter TorrentFilter, download, upload int64) ([]rpctypes.BulkResult, error) {
+	args := rpctypes.SetTorrentLimitsRequest{Filter: filter, DownloadLimit: download, UploadLimit: upload}
+	var reply rpctypes.SetTorrentLimitsResponse
+	return reply.Results, c.client.Call("Session.SetTorrentLimits", args, &reply)
+}
+
+func (c *Client) VerifyTorrents(filter TorrentFilter) ([]rpctypes.VerifyTorrentsResult, error) {
+	args := rpctypes.VerifyTorrentsRequest{Filter: filter}
+	var reply rpctypes.VerifyTorrentsResponse
+	return reply.Results, c.client.Call("Session.VerifyTorrents", args, &reply)
+}
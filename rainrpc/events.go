@@ -0,0 +1,96 @@
+package rainrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+)
+
+// Subscription receives events streamed from the server.
+type Subscription struct {
+	// C is closed when the stream ends or the Subscription is closed.
+	C <-chan rpctypes.Event
+	// Err is the error that ended the stream. It must be read after C is closed.
+	Err error
+
+	body   io.ReadCloser
+	closeC chan struct{}
+}
+
+// Subscribe starts receiving events from the server.
+// If torrentID is not empty, only the events of that torrent are received.
+func (c *Client) Subscribe(torrentID string) (*Subscription, error) {
+	u, err := url.Parse(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/events"
+	if torrentID != "" {
+		q := u.Query()
+		q.Set("torrent", torrentID)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	eventC := make(chan rpctypes.Event)
+	s := &Subscription{
+		C:      eventC,
+		body:   resp.Body,
+		closeC: make(chan struct{}),
+	}
+	go s.run(eventC)
+	return s, nil
+}
+
+// Close stops receiving events.
+func (s *Subscription) Close() error {
+	close(s.closeC)
+	return s.body.Close()
+}
+
+func (s *Subscription) run(eventC chan rpctypes.Event) {
+	defer close(eventC)
+	scanner := bufio.NewScanner(s.body)
+	scanner.Buffer(nil, 1<<20)
+	prefix := []byte("data: ")
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, prefix) {
+			continue
+		}
+		var e rpctypes.Event
+		err := json.Unmarshal(line[len(prefix):], &e)
+		if err != nil {
+			s.Err = err
+			return
+		}
+		select {
+		case eventC <- e:
+		case <-s.closeC:
+			return
+		}
+	}
+	select {
+	case <-s.closeC:
+	default:
+		s.Err = scanner.Err()
+	}
+}
@@ -9,6 +9,7 @@ var (
 )
 
 // Config for Session.
+// Fields listed in ReloadableConfigFields can be changed with Session.UpdateConfig while the session is running.
 type Config struct {
 	// Database file to save resume data.
 	Database string
@@ -18,6 +19,8 @@ type Config struct {
 	PortBegin, PortEnd uint16
 	// Enable peer exchange protocol.
 	PEXEnabled bool
+	// Enable connecting to peers behind NAT through other peers with ut_holepunch extension (BEP 55).
+	HolepunchEnabled bool
 	// Resume data (bitfield & stats) are saved to disk at interval to keep IO lower.
 	ResumeWriteInterval time.Duration
 	// Peer id is prefixed with this string. See BEP 20. Remaining bytes of peer id will be randomized.
@@ -49,8 +52,21 @@ type Config struct {
 	RPCPort int
 	// Time to wait for ongoing requests before shutting down RPC HTTP server.
 	RPCShutdownTimeout time.Duration
+	// If set, RPC requests must have this token in "Authorization: Bearer <token>" header.
+	RPCToken string
+	// Users that are allowed to make RPC requests with HTTP basic authentication.
+	// Keys are user names and values are bcrypt hashes of passwords.
+	RPCUsers map[string]string
+	// Certificate and key files for serving RPC over TLS. TLS is enabled when both are set.
+	RPCTLSCertFile string
+	RPCTLSKeyFile  string
+	// Serve Transmission compatible RPC at "/transmission/rpc" path of RPC server.
+	RPCTransmissionEnabled bool
+	// Serve web interface at "/ui/" path of RPC server. Enable it only together with RPC authentication.
+	RPCWebUIEnabled bool
 
 	// Enable DHT node.
+	// Cannot be changed with Session.UpdateConfig, because support for DHT is told to peers in handshakes.
 	DHTEnabled bool
 	// DHT node will listen on this IP.
 	DHTHost string
@@ -62,6 +78,12 @@ type Config struct {
 	DHTMinAnnounceInterval time.Duration
 	// Known routers to bootstrap local DHT node.
 	DHTBootstrapNodes []string
+	// Interval for checking DHT for new versions of mutable torrents (BEP 46). Set to 0 to disable.
+	MutableTorrentUpdateInterval time.Duration
+	// Time to wait for resolving the info hash of a mutable torrent from DHT.
+	MutableTorrentResolveTimeout time.Duration
+	// Remove the previous version of a mutable torrent and its data when the new version is completed.
+	MutableTorrentRemoveOld bool
 
 	// Number of peer addresses to request in announce request.
 	TrackerNumWant int
@@ -90,11 +112,28 @@ type Config struct {
 	// `rreq` value from extended handshake cannot exceed this limit.
 	MaxRequestsOut int
 	// Number of bloks requested from peer if it does not send `rreq` value in extended handshake.
+	// Used until download speed of the peer is measured if RequestQueueTime is not zero.
 	DefaultRequestsOut int
+	// Number of blocks requested from a peer is adjusted to keep this much time of data in flight,
+	// based on measured download speed and round-trip time of the peer. Set to 0 for fixed number of requests.
+	RequestQueueTime time.Duration
 	// Time to wait for a requested block to be received before marking peer as snubbed
 	RequestTimeout time.Duration
+	// Peers sending corrupt pieces are banned for this duration. 0 means permanent.
+	// Bans are shared by all torrents and kept in session database.
+	CorruptPieceBanDuration time.Duration
 	// Max number of running downloads on piece in endgame mode, snubbed and choed peers don't count
 	EndgameMaxDuplicateDownloads int
+	// Max number of pieces downloaded from a single peer at the same time.
+	// Actual number depends on the request queue length and download speed of the peer.
+	MaxPieceDownloadsPerPeer int
+	// Number of pieces that peers supporting fast extension can download while they are choked. Set to 0 to disable.
+	AllowedFastSetSize int
+	// Number of pieces in read cache that are suggested to peers supporting fast extension when they connect. Set to 0 to disable.
+	SuggestPieces int
+	// Number of goroutines calculating piece hashes in parallel, shared by all torrents.
+	// Used when verifying existing files and checking downloaded pieces. 0 means number of CPUs.
+	ParallelHashChecks int
 	// Max number of outgoing connections to dial
 	MaxPeerDial int
 	// Max number of incoming connections to accept
@@ -120,6 +159,17 @@ type Config struct {
 	PieceCacheTTL time.Duration
 	// Number of read operations to do in parallel.
 	ParallelReads uint
+	// Max number of PieceReadSize regions to prefetch when a peer is requesting pieces sequentially.
+	// Set to 0 to disable read-ahead.
+	PieceReadAhead int
+
+	// Number of bytes of downloaded pieces kept in memory before writing to disk.
+	// Adjacent pieces in a file are coalesced into a single write. Set to 0 to disable write cache.
+	WriteCacheSize int64
+	// Dirty data in write cache is written to disk after this duration. Set to 0 to write only when the cache is full or files are closed.
+	WriteCacheFlushInterval time.Duration
+	// Call fsync on files after writing dirty data from write cache.
+	WriteCacheFsync bool
 
 	// When the client want to connect a peer, first it tries to do encrypted handshake.
 	// If it does not work, it connects to same peer again and does unencrypted handshake.
@@ -144,6 +194,7 @@ var DefaultConfig = Config{
 	PortBegin:                              50000,
 	PortEnd:                                60000,
 	PEXEnabled:                             true,
+	HolepunchEnabled:                       true,
 	ResumeWriteInterval:                    30 * time.Second,
 	PrivatePeerIDPrefix:                    "-RN" + Version + "-",
 	PrivateExtensionHandshakeClientVersion: "Rain " + Version,
@@ -159,6 +210,7 @@ var DefaultConfig = Config{
 	RPCHost:            "127.0.0.1",
 	RPCPort:            7246,
 	RPCShutdownTimeout: 5 * time.Second,
+	RPCWebUIEnabled:    false,
 
 	// Tracker
 	TrackerNumWant:              200,
@@ -181,6 +233,8 @@ var DefaultConfig = Config{
 		"dht.libtorrent.org:25401",
 		"dht.aelitis.com:6881",
 	},
+	MutableTorrentUpdateInterval: time.Hour,
+	MutableTorrentResolveTimeout: 30 * time.Second,
 
 	// Peer
 	UnchokedPeers:                3,
@@ -188,8 +242,14 @@ var DefaultConfig = Config{
 	MaxRequestsIn:                250,
 	MaxRequestsOut:               250,
 	DefaultRequestsOut:           50,
+	RequestQueueTime:             3 * time.Second,
 	RequestTimeout:               20 * time.Second,
 	EndgameMaxDuplicateDownloads: 20,
+	CorruptPieceBanDuration:      24 * time.Hour,
+	MaxPieceDownloadsPerPeer:     8,
+	AllowedFastSetSize:           10,
+	SuggestPieces:                10,
+	ParallelHashChecks:           0,
 	MaxPeerDial:                  80,
 	MaxPeerAccept:                20,
 	MaxActivePieceBytes:          1024 * 1024 * 1024,
@@ -204,6 +264,12 @@ var DefaultConfig = Config{
 	PieceCacheSize: 256 * 1024 * 1024,
 	PieceCacheTTL:  5 * time.Minute,
 	ParallelReads:  1,
+	PieceReadAhead: 8,
+
+	// Write cache
+	WriteCacheSize:          64 * 1024 * 1024,
+	WriteCacheFlushInterval: 10 * time.Second,
+	WriteCacheFsync:         false,
 
 	// Webseed settings
 	WebseedDialTimeout:             10 * time.Second,
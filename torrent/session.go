@@ -8,14 +8,17 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/ProtocolONE/rain/internal/banlist"
 	"github.com/ProtocolONE/rain/internal/bitfield"
 	"github.com/ProtocolONE/rain/internal/blocklist"
+	"github.com/ProtocolONE/rain/internal/hasher"
 	"github.com/ProtocolONE/rain/internal/logger"
+	"github.com/ProtocolONE/rain/internal/mutableresolver"
 	"github.com/ProtocolONE/rain/internal/piececache"
 	"github.com/ProtocolONE/rain/internal/resolver"
 	"github.com/ProtocolONE/rain/internal/resourcemanager"
@@ -23,6 +26,7 @@ import (
 	"github.com/ProtocolONE/rain/internal/storage/filestorage"
 	"github.com/ProtocolONE/rain/internal/tracker"
 	"github.com/ProtocolONE/rain/internal/trackermanager"
+	"github.com/ProtocolONE/rain/internal/writecache"
 	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 )
@@ -32,24 +36,36 @@ var (
 	torrentsBucket        = []byte("torrents")
 	blocklistKey          = []byte("blocklist")
 	blocklistTimestampKey = []byte("blocklist-timestamp")
+	bansBucket            = []byte("bans")
 )
 
 // Session contains torrents, DHT node, caches and other data structures shared by multiple torrents.
 type Session struct {
+	mConfig        sync.RWMutex
 	config         Config
 	db             *bolt.DB
 	resumer        *boltdbresumer.Resumer
 	log            logger.Logger
 	extensions     [8]byte
-	dht            *dht.DHT
 	rpc            *rpcServer
 	trackerManager *trackermanager.TrackerManager
 	ram            *resourcemanager.ResourceManager
 	pieceCache     *piececache.Cache
+	writeCache     *writecache.Cache
+	hashPool       *hasher.Pool
+	events         *eventBus
 	webseedClient  http.Client
 	createdAt      time.Time
 	closeC         chan struct{}
 
+	// DHT node is replaced when its address or bootstrap nodes are changed with UpdateConfig.
+	mDHT     sync.RWMutex
+	dht      *dht.DHT
+	dhtStopC chan struct{}
+
+	// Serializes UpdateConfig calls, so restarts of DHT node and blocklist reloader are done in order.
+	mUpdateConfig sync.Mutex
+
 	mPeerRequests   sync.Mutex
 	dhtPeerRequests map[*torrent]struct{}
 
@@ -63,6 +79,17 @@ type Session struct {
 	mBlocklist         sync.RWMutex
 	blocklist          *blocklist.Blocklist
 	blocklistTimestamp time.Time
+	// Closed to stop the goroutine reloading blocklist when BlocklistURL is changed.
+	blocklistReloaderStopC chan struct{}
+
+	bans *banlist.BanList
+
+	mCustomExtensions sync.RWMutex
+	customExtensions  []*customExtension
+
+	mutableResolver  *mutableresolver.Resolver
+	mMutableTorrents sync.Mutex
+	mutableTorrents  map[string]*mutableTorrent
 }
 
 // NewSession creates a new Session for downloading and seeding torrents.
@@ -102,6 +129,10 @@ func NewSession(cfg Config) (*Session, error) {
 		if err2 != nil {
 			return err2
 		}
+		_, err2 = tx.CreateBucketIfNotExists(bansBucket)
+		if err2 != nil {
+			return err2
+		}
 		b, err2 := tx.CreateBucketIfNotExists(torrentsBucket)
 		if err2 != nil {
 			return err2
@@ -120,16 +151,7 @@ func NewSession(cfg Config) (*Session, error) {
 	}
 	var dhtNode *dht.DHT
 	if cfg.DHTEnabled {
-		dhtConfig := dht.NewConfig()
-		dhtConfig.Address = cfg.DHTHost
-		dhtConfig.Port = int(cfg.DHTPort)
-		dhtConfig.DHTRouters = strings.Join(cfg.DHTBootstrapNodes, ",")
-		dhtConfig.SaveRoutingTable = false
-		dhtNode, err = dht.New(dhtConfig)
-		if err != nil {
-			return nil, err
-		}
-		err = dhtNode.Start()
+		dhtNode, err = startDHTNode(cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -144,6 +166,7 @@ func NewSession(cfg Config) (*Session, error) {
 		db:                 db,
 		resumer:            res,
 		blocklist:          bl,
+		bans:               banlist.New(),
 		trackerManager:     trackermanager.New(bl, cfg.DNSResolveTimeout),
 		log:                l,
 		torrents:           make(map[string]*Torrent),
@@ -154,6 +177,9 @@ func NewSession(cfg Config) (*Session, error) {
 		ram:                resourcemanager.New(cfg.MaxActivePieceBytes),
 		createdAt:          time.Now(),
 		closeC:             make(chan struct{}),
+		events:             newEventBus(),
+		mutableResolver:    mutableresolver.New(cfg.DHTBootstrapNodes),
+		mutableTorrents:    make(map[string]*mutableTorrent),
 		webseedClient: http.Client{
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -172,6 +198,14 @@ func NewSession(cfg Config) (*Session, error) {
 			},
 		},
 	}
+	hashWorkers := cfg.ParallelHashChecks
+	if hashWorkers <= 0 {
+		hashWorkers = runtime.NumCPU()
+	}
+	c.hashPool = hasher.New(hashWorkers)
+	if cfg.WriteCacheSize > 0 {
+		c.writeCache = writecache.New(cfg.WriteCacheSize, cfg.WriteCacheFlushInterval, cfg.WriteCacheFsync)
+	}
 	ext, err := bitfield.NewBytes(c.extensions[:], 64)
 	if err != nil {
 		panic(err)
@@ -185,9 +219,14 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = c.loadBans()
+	if err != nil {
+		return nil, err
+	}
 	if cfg.DHTEnabled {
 		c.dhtPeerRequests = make(map[*torrent]struct{})
-		go c.processDHTResults()
+		c.dhtStopC = make(chan struct{})
+		go c.processDHTResults(dhtNode, c.dhtStopC)
 	}
 	c.loadExistingTorrents(ids)
 	if c.config.RPCEnabled {
@@ -198,6 +237,9 @@ func NewSession(cfg Config) (*Session, error) {
 		}
 	}
 	go c.updateStatsLoop()
+	if cfg.MutableTorrentUpdateInterval > 0 {
+		go c.updateMutableTorrentsLoop()
+	}
 	return c, nil
 }
 
@@ -230,9 +272,12 @@ func (s *Session) getTrackerUserAgent(private bool) string {
 func (s *Session) Close() error {
 	close(s.closeC)
 
-	if s.config.DHTEnabled {
+	s.mDHT.Lock()
+	if s.dht != nil {
 		s.dht.Stop()
+		s.dht = nil
 	}
+	s.mDHT.Unlock()
 
 	s.updateStats()
 
@@ -249,6 +294,9 @@ func (s *Session) Close() error {
 	s.torrents = nil
 	s.mTorrents.Unlock()
 
+	// Close subscriptions so that event stream handlers return before shutting down RPC server.
+	s.events.close()
+
 	if s.rpc != nil {
 		err := s.rpc.Stop(s.config.RPCShutdownTimeout)
 		if err != nil {
@@ -258,6 +306,10 @@ func (s *Session) Close() error {
 
 	s.ram.Close()
 	s.pieceCache.Close()
+	s.hashPool.Close()
+	if s.writeCache != nil {
+		s.writeCache.Close()
+	}
 	return s.db.Close()
 }
 
@@ -294,9 +346,23 @@ func (s *Session) GetTorrent(id string) *Torrent {
 }
 
 func (s *Session) RemoveTorrent(id string) error {
+	return s.removeTorrent(id, false)
+}
+
+// RemoveTorrentKeepData removes the torrent from the session without deleting the downloaded files.
+func (s *Session) RemoveTorrentKeepData(id string) error {
+	return s.removeTorrent(id, true)
+}
+
+func (s *Session) removeTorrent(id string, keepData bool) error {
 	t, err := s.removeTorrentFromClient(id)
 	if t != nil {
-		go s.stopAndRemoveData(t)
+		s.publishEvent(Event{Type: EventRemoved, TorrentID: id})
+		if keepData {
+			go s.stopTorrent(t)
+		} else {
+			go s.stopAndRemoveData(t)
+		}
 	}
 	return err
 }
@@ -310,14 +376,19 @@ func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	}
 	delete(s.torrents, id)
 	delete(s.torrentsByInfoHash, dht.InfoHash(t.torrent.InfoHash()))
+	s.removeMutableTorrent(id)
 	return t, s.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(torrentsBucket).DeleteBucket([]byte(id))
 	})
 }
 
-func (s *Session) stopAndRemoveData(t *Torrent) {
+func (s *Session) stopTorrent(t *Torrent) {
 	t.torrent.Close()
 	s.releasePort(t.torrent.port)
+}
+
+func (s *Session) stopAndRemoveData(t *Torrent) {
+	s.stopTorrent(t)
 	dest := t.torrent.storage.(*filestorage.FileStorage).Dest()
 	err := os.RemoveAll(dest)
 	if err != nil {
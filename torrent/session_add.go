@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -17,24 +18,50 @@ import (
 	"github.com/ProtocolONE/rain/internal/storage/filestorage"
 	"github.com/ProtocolONE/rain/internal/webseedsource"
 	"github.com/gofrs/uuid"
+	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 )
 
+// AddTorrentOptions contains options for adding a new torrent.
+type AddTorrentOptions struct {
+	// Directory to search for the files of the torrent that are already downloaded.
+	// Files are matched by their relative paths or by their sizes, and the hashes of the pieces in the file are checked.
+	// Matched files are linked into the storage of the torrent and verified before starting the download.
+	// Search is done in background when the torrent is started for the first time.
+	FindExistingDataIn string
+	// Do not start the torrent after adding it.
+	Stopped bool
+}
+
+// AddTorrent adds a new torrent from the torrent file in r and starts it.
 func (s *Session) AddTorrent(r io.Reader) (*Torrent, error) {
-	t, err := s.addTorrentStopped(r)
+	return s.AddTorrentWithOptions(r, nil)
+}
+
+// AddTorrentWithOptions is same as AddTorrent but accepts options for adding the torrent.
+// opt may be nil.
+func (s *Session) AddTorrentWithOptions(r io.Reader, opt *AddTorrentOptions) (*Torrent, error) {
+	t, err := s.addTorrentStopped(r, opt)
 	if err != nil {
 		return nil, err
 	}
+	if opt != nil && opt.Stopped {
+		return t, nil
+	}
 	return t, t.Start()
 }
 
-func (s *Session) addTorrentStopped(r io.Reader) (*Torrent, error) {
+func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torrent, error) {
 	r = io.LimitReader(r, int64(s.config.MaxTorrentSize))
 	mi, err := metainfo.New(r)
 	if err != nil {
 		return nil, err
 	}
-	id, port, sto, err := s.add()
+	id, dest, err := s.nextTorrentDest()
+	if err != nil {
+		return nil, err
+	}
+	port, sto, err := s.add(dest)
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +70,13 @@ func (s *Session) addTorrentStopped(r io.Reader) (*Torrent, error) {
 			s.releasePort(port)
 		}
 	}()
+	var existingDataDir string
+	if opt != nil && opt.FindExistingDataIn != "" {
+		existingDataDir, err = checkExistingDataDir(opt.FindExistingDataIn)
+		if err != nil {
+			return nil, err
+		}
+	}
 	t, err := newTorrent2(
 		s,
 		id,
@@ -62,6 +96,8 @@ func (s *Session) addTorrentStopped(r io.Reader) (*Torrent, error) {
 	}
 	t.webseedClient = &s.webseedClient
 	t.webseedSources = webseedsource.NewList(mi.URLList)
+	t.existingDataDir = existingDataDir
+	t.collections = mi.Collections
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -77,31 +113,40 @@ func (s *Session) addTorrentStopped(r io.Reader) (*Torrent, error) {
 		URLList:  mi.URLList,
 		Info:     mi.Info.Bytes,
 		AddedAt:  t.addedAt,
+		// Info dictionary is saved but top level keys of the torrent file are not.
+		Collections: mi.Collections,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
 	t2 := s.insertTorrent(t)
+	s.publishEvent(Event{Type: EventAdded, TorrentID: id})
 	return t2, nil
 }
 
 func (s *Session) AddURI(uri string) (*Torrent, error) {
+	return s.AddURIWithOptions(uri, nil)
+}
+
+// AddURIWithOptions is same as AddURI but accepts options for adding the torrent.
+// FindExistingDataIn is used only for torrent files downloaded from HTTP URIs. opt may be nil.
+func (s *Session) AddURIWithOptions(uri string, opt *AddTorrentOptions) (*Torrent, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
 	}
 	switch u.Scheme {
 	case "http", "https":
-		return s.addURL(uri)
+		return s.addURL(uri, opt)
 	case "magnet":
-		return s.addMagnet(uri)
+		return s.addMagnet(uri, opt != nil && opt.Stopped)
 	default:
 		return nil, errors.New("unsupported uri scheme: " + u.Scheme)
 	}
 }
 
-func (s *Session) addURL(u string) (*Torrent, error) {
+func (s *Session) addURL(u string, opt *AddTorrentOptions) (*Torrent, error) {
 	client := http.Client{
 		Timeout: s.config.TorrentAddHTTPTimeout,
 	}
@@ -115,15 +160,38 @@ func (s *Session) addURL(u string) (*Torrent, error) {
 		return nil, fmt.Errorf("torrent too large: %d", resp.ContentLength)
 	}
 	r := io.LimitReader(resp.Body, int64(s.config.MaxTorrentSize))
-	return s.AddTorrent(r)
+	return s.AddTorrentWithOptions(r, opt)
 }
 
-func (s *Session) addMagnet(link string) (*Torrent, error) {
+func (s *Session) addMagnet(link string, stopped bool) (*Torrent, error) {
 	ma, err := magnet.New(link)
 	if err != nil {
 		return nil, err
 	}
-	id, port, sto, err := s.add()
+	var seq int64
+	if ma.Mutable() {
+		item, err2 := s.resolveMutable(ma.PublicKey, ma.Salt)
+		switch {
+		case err2 == nil:
+			ma.InfoHash = item.InfoHash
+			seq = item.Seq
+		case ma.InfoHash == [20]byte{}:
+			return nil, fmt.Errorf("cannot resolve mutable torrent: %s", err2)
+		default:
+			s.log.Warningln("cannot resolve mutable torrent, using info hash in magnet link:", err2)
+		}
+	}
+	id, dest, err := s.nextTorrentDest()
+	if err != nil {
+		return nil, err
+	}
+	return s.addMagnetTorrent(ma, id, dest, seq, "", stopped)
+}
+
+// addMagnetTorrent adds the torrent in ma with id and data directory dest and starts it unless stopped is true.
+// For mutable torrents, seq is the sequence number of the version and replaces is the ID of the previous version.
+func (s *Session) addMagnetTorrent(ma *magnet.Magnet, id, dest string, seq int64, replaces string, stopped bool) (*Torrent, error) {
+	port, sto, err := s.add(dest)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +217,7 @@ func (s *Session) addMagnet(link string) (*Torrent, error) {
 	if err != nil {
 		return nil, err
 	}
+	t.replaces = replaces
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -163,16 +232,45 @@ func (s *Session) addMagnet(link string) (*Torrent, error) {
 		Trackers:   ma.Trackers,
 		FixedPeers: ma.Peers,
 		AddedAt:    t.addedAt,
+		PublicKey:  ma.PublicKey,
+		Salt:       ma.Salt,
+		Seq:        seq,
+		Replaces:   replaces,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
+	if ma.Mutable() {
+		s.addMutableTorrent(id, ma.PublicKey, ma.Salt, seq)
+	}
 	t2 := s.insertTorrent(t)
+	s.publishEvent(Event{Type: EventAdded, TorrentID: id})
+	if stopped {
+		return t2, nil
+	}
 	return t2, t2.Start()
 }
 
-func (s *Session) add() (id string, port int, sto *filestorage.FileStorage, err error) {
+// nextTorrentDest returns the ID and data directory of the torrent that is going to be added.
+// ID is taken from the last element of DataDir and DataDir is changed to its parent directory.
+// A new ID is generated if DataDir has no last element.
+func (s *Session) nextTorrentDest() (id, dest string, err error) {
+	u1, err := uuid.NewV1()
+	if err != nil {
+		return
+	}
+	s.mConfig.Lock()
+	defer s.mConfig.Unlock()
+	s.config.DataDir, id = filepath.Split(s.config.DataDir) // We need the path w/o id
+	if id == "" {
+		id = base64.RawURLEncoding.EncodeToString(u1[:])
+	}
+	dest = filepath.Join(s.config.DataDir, id)
+	return
+}
+
+func (s *Session) add(dest string) (port int, sto *filestorage.FileStorage, err error) {
 	port, err = s.getPort()
 	if err != nil {
 		return
@@ -182,18 +280,25 @@ func (s *Session) add() (id string, port int, sto *filestorage.FileStorage, err
 			s.releasePort(port)
 		}
 	}()
-	u1, err := uuid.NewV1()
+	sto, err = filestorage.New(dest)
+	return
+}
+
+// checkExistingDataDir expands dir and checks that it is a directory,
+// so an invalid FindExistingDataIn option is reported when adding the torrent.
+func checkExistingDataDir(dir string) (string, error) {
+	dir, err := homedir.Expand(dir)
 	if err != nil {
-		return
+		return "", err
 	}
-	id = base64.RawURLEncoding.EncodeToString(u1[:])
-	s.config.DataDir, id = filepath.Split(s.config.DataDir) // We need the path w/o id
-	dest := filepath.Join(s.config.DataDir, id)
-	sto, err = filestorage.New(dest)
+	fi, err := os.Stat(dir)
 	if err != nil {
-		return
+		return "", err
 	}
-	return
+	if !fi.IsDir() {
+		return "", &os.PathError{Op: "find", Path: dir, Err: os.ErrInvalid}
+	}
+	return dir, nil
 }
 
 func (s *Session) insertTorrent(t *torrent) *Torrent {
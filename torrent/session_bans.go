@@ -0,0 +1,128 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/banlist"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	errBanNotFound = errors.New("ban not found")
+	errInvalidIP   = errors.New("invalid IP address")
+)
+
+// Ban prevents connections to and from a peer IP.
+type Ban struct {
+	IP        net.IP
+	Reason    string
+	CreatedAt time.Time
+	// Zero value means the ban never expires.
+	ExpiresAt time.Time
+}
+
+// loadBans reads bans from session db. Expired bans are deleted from db.
+func (s *Session) loadBans() error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bansBucket)
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var ban banlist.Ban
+			err := json.Unmarshal(v, &ban)
+			if err != nil {
+				s.log.Errorf("cannot load ban of %s: %s", string(k), err)
+				expired = append(expired, k)
+				return nil
+			}
+			if ban.Expired(now) {
+				expired = append(expired, k)
+				return nil
+			}
+			s.bans.Add(ban)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListBans returns the effective bans in the order they are added.
+func (s *Session) ListBans() []Ban {
+	bans := s.bans.List()
+	ret := make([]Ban, len(bans))
+	for i, b := range bans {
+		ret[i] = Ban(b)
+	}
+	return ret
+}
+
+// AddBan bans ip for duration and disconnects peers with that IP.
+// Zero duration makes a permanent ban. Bans are kept in session db and survive restarts.
+func (s *Session) AddBan(ip net.IP, reason string, duration time.Duration) error {
+	if ip == nil {
+		return errInvalidIP
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	b := banlist.Ban{
+		IP:        ip,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		b.ExpiresAt = b.CreatedAt.Add(duration)
+	}
+	val, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).Put([]byte(ip.String()), val)
+	})
+	if err != nil {
+		return err
+	}
+	s.bans.Add(b)
+	s.mTorrents.RLock()
+	torrents := make([]*torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t.torrent)
+	}
+	s.mTorrents.RUnlock()
+	// Bans are also added from run loops of torrents. Do not wait for them to process the ban.
+	go func() {
+		for _, t := range torrents {
+			t.disconnectIP(ip)
+		}
+	}()
+	return nil
+}
+
+// RemoveBan lifts the ban on ip.
+func (s *Session) RemoveBan(ip net.IP) error {
+	if ip == nil {
+		return errInvalidIP
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if !s.bans.Remove(ip) {
+		return errBanNotFound
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).Delete([]byte(ip.String()))
+	})
+}
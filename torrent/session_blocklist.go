@@ -13,6 +13,8 @@ import (
 	"github.com/cenkalti/backoff"
 )
 
+var errBlocklistReloaderStopped = errors.New("blocklist reloader is stopped")
+
 func (s *Session) startBlocklistReloader() error {
 	if s.config.BlocklistURL == "" {
 		return nil
@@ -24,6 +26,8 @@ func (s *Session) startBlocklistReloader() error {
 
 	s.mBlocklist.Lock()
 	s.blocklistTimestamp = blocklistTimestamp
+	stopC := make(chan struct{})
+	s.blocklistReloaderStopC = stopC
 	s.mBlocklist.Unlock()
 
 	deadline := blocklistTimestamp.Add(s.config.BlocklistUpdateInterval)
@@ -32,11 +36,11 @@ func (s *Session) startBlocklistReloader() error {
 	switch {
 	case blocklistTimestamp.IsZero():
 		s.log.Infof("Blocklist is empty. Loading blocklist...")
-		s.retryReloadBlocklist()
+		s.retryReloadBlocklist(s.config.BlocklistURL, stopC)
 		nextReload = s.config.BlocklistUpdateInterval
 	case deadline.Before(now):
 		s.log.Infof("Last blocklist reload was %s ago. Reloading blocklist...", now.Sub(s.blocklistTimestamp).Truncate(time.Second).String())
-		s.retryReloadBlocklist()
+		s.retryReloadBlocklist(s.config.BlocklistURL, stopC)
 		nextReload = s.config.BlocklistUpdateInterval
 	default:
 		s.log.Infof("Loading blocklist from session db...")
@@ -46,10 +50,54 @@ func (s *Session) startBlocklistReloader() error {
 		}
 		nextReload = deadline.Sub(now)
 	}
-	go s.blocklistReloader(nextReload)
+	go s.blocklistReloader(s.config.BlocklistURL, nextReload, stopC)
 	return nil
 }
 
+// restartBlocklistReloader is called when BlocklistURL or BlocklistUpdateInterval is changed with UpdateConfig.
+// Blocklist is downloaded from the new URL immediately. If the URL is empty, blocklist is cleared.
+func (s *Session) restartBlocklistReloader(old, cfg Config) {
+	s.mBlocklist.Lock()
+	defer s.mBlocklist.Unlock()
+	if s.blocklistReloaderStopC != nil {
+		close(s.blocklistReloaderStopC)
+		s.blocklistReloaderStopC = nil
+	}
+	if cfg.BlocklistURL == "" {
+		s.log.Info("Blocklist URL is removed. Clearing blocklist...")
+		err := s.clearBlocklist()
+		if err != nil {
+			s.log.Errorln("cannot clear blocklist:", err.Error())
+		}
+		return
+	}
+	var nextReload time.Duration
+	if cfg.BlocklistURL == old.BlocklistURL && !s.blocklistTimestamp.IsZero() {
+		nextReload = time.Until(s.blocklistTimestamp.Add(cfg.BlocklistUpdateInterval))
+	}
+	stopC := make(chan struct{})
+	s.blocklistReloaderStopC = stopC
+	go s.blocklistReloader(cfg.BlocklistURL, nextReload, stopC)
+}
+
+// clearBlocklist removes all rules from blocklist and deletes the saved blocklist from session db.
+// It must be called with mBlocklist held.
+func (s *Session) clearBlocklist() error {
+	_, err := s.blocklist.Reload(bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	s.blocklistTimestamp = time.Time{}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionBucket)
+		err2 := b.Delete(blocklistKey)
+		if err2 != nil {
+			return err2
+		}
+		return b.Delete(blocklistTimestampKey)
+	})
+}
+
 func (s *Session) getBlocklistTimestamp() (time.Time, error) {
 	var t time.Time
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -65,7 +113,7 @@ func (s *Session) getBlocklistTimestamp() (time.Time, error) {
 	return t, err
 }
 
-func (s *Session) retryReloadBlocklist() {
+func (s *Session) retryReloadBlocklist(url string, stopC chan struct{}) {
 	bo := backoff.NewExponentialBackOff()
 	bo.MaxElapsedTime = 0
 
@@ -75,20 +123,27 @@ func (s *Session) retryReloadBlocklist() {
 	for {
 		select {
 		case <-ticker.C:
-			err := s.reloadBlocklist()
+			err := s.reloadBlocklist(url, stopC)
+			if err == errBlocklistReloaderStopped {
+				return
+			}
 			if err != nil {
 				s.log.Errorln("cannot load blocklist:", err.Error())
 				continue
 			}
 			return
+		case <-stopC:
+			return
 		case <-s.closeC:
 			return
 		}
 	}
 }
 
-func (s *Session) reloadBlocklist() error {
-	req, err := http.NewRequest(http.MethodGet, s.config.BlocklistURL, nil)
+// reloadBlocklist downloads the blocklist from url and saves it to session db.
+// Downloaded blocklist is discarded if the reloader is stopped by closing stopC in the meantime.
+func (s *Session) reloadBlocklist(url string, stopC chan struct{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
@@ -99,13 +154,15 @@ func (s *Session) reloadBlocklist() error {
 		select {
 		case <-s.closeC:
 			cancel()
+		case <-stopC:
+			cancel()
 		case <-ctx.Done():
 		}
 	}()
 	req = req.WithContext(ctx)
 
 	client := http.Client{
-		Timeout: s.config.BlocklistUpdateTimeout,
+		Timeout: s.getConfig().BlocklistUpdateTimeout,
 	}
 
 	resp, err := client.Do(req)
@@ -129,18 +186,26 @@ func (s *Session) reloadBlocklist() error {
 	}
 
 	buf := bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
-	r = io.TeeReader(r, buf)
+	_, err = io.Copy(buf, r)
+	if err != nil {
+		return err
+	}
 
-	err = s.loadBlocklistReader(r)
+	s.mBlocklist.Lock()
+	defer s.mBlocklist.Unlock()
+	select {
+	case <-stopC:
+		return errBlocklistReloaderStopped
+	default:
+	}
+
+	err = s.loadBlocklistReader(bytes.NewReader(buf.Bytes()))
 	if err != nil {
 		return err
 	}
 
 	now := time.Now()
-
-	s.mBlocklist.Lock()
 	s.blocklistTimestamp = now
-	s.mBlocklist.Unlock()
 
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(sessionBucket)
@@ -172,16 +237,18 @@ func (s *Session) loadBlocklistReader(r io.Reader) error {
 	return nil
 }
 
-func (s *Session) blocklistReloader(d time.Duration) {
+func (s *Session) blocklistReloader(url string, d time.Duration, stopC chan struct{}) {
 	for {
 		select {
 		case <-time.After(d):
+		case <-stopC:
+			return
 		case <-s.closeC:
 			return
 		}
 
 		s.log.Info("Reloading blocklist...")
-		s.retryReloadBlocklist()
-		d = s.config.BlocklistUpdateInterval
+		s.retryReloadBlocklist(url, stopC)
+		d = s.getConfig().BlocklistUpdateInterval
 	}
 }
@@ -0,0 +1,151 @@
+package torrent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// ReloadableConfigFields are the names of Config fields that can be changed with Session.UpdateConfig.
+// Limits are applied to running torrents immediately.
+// Timeouts and encryption settings take effect for new peer connections.
+// Blocklist is downloaded again when its URL is changed.
+// DHT node is restarted when its address or bootstrap nodes are changed.
+var ReloadableConfigFields = []string{
+	"PEXEnabled",
+	"HolepunchEnabled",
+	"BlocklistURL",
+	"BlocklistUpdateInterval",
+	"BlocklistUpdateTimeout",
+	"DHTHost",
+	"DHTPort",
+	"DHTBootstrapNodes",
+	"DHTAnnounceInterval",
+	"DHTMinAnnounceInterval",
+	"MutableTorrentResolveTimeout",
+	"MutableTorrentRemoveOld",
+	"TrackerNumWant",
+	"TrackerStopTimeout",
+	"TrackerMinAnnounceInterval",
+	"UnchokedPeers",
+	"OptimisticUnchokedPeers",
+	"MaxRequestsIn",
+	"MaxRequestsOut",
+	"DefaultRequestsOut",
+	"RequestQueueTime",
+	"RequestTimeout",
+	"EndgameMaxDuplicateDownloads",
+	"CorruptPieceBanDuration",
+	"MaxPieceDownloadsPerPeer",
+	"AllowedFastSetSize",
+	"SuggestPieces",
+	"MaxPeerDial",
+	"MaxPeerAccept",
+	"ParallelMetadataDownloads",
+	"PeerConnectTimeout",
+	"PeerHandshakeTimeout",
+	"PieceReadTimeout",
+	"MaxPeerAddresses",
+	"PieceReadAhead",
+	"DisableOutgoingEncryption",
+	"ForceOutgoingEncryption",
+	"ForceIncomingEncryption",
+}
+
+// ConfigNotReloadableError is returned from Session.UpdateConfig when the new config changes fields
+// that are not in ReloadableConfigFields. Session must be restarted for these changes to take effect.
+// For example, DHTEnabled cannot be changed because support for DHT is told to peers in handshakes.
+type ConfigNotReloadableError struct {
+	Fields []string
+}
+
+func (e *ConfigNotReloadableError) Error() string {
+	return "session must be restarted to change config fields: " + strings.Join(e.Fields, ", ")
+}
+
+// Config returns a copy of the current config of the session.
+func (s *Session) Config() Config {
+	return s.getConfig()
+}
+
+func (s *Session) getConfig() Config {
+	s.mConfig.RLock()
+	defer s.mConfig.RUnlock()
+	return s.config
+}
+
+// UpdateConfig changes the fields in ReloadableConfigFields to the values in cfg and applies them to all torrents in session.
+// Changes in other fields are ignored. If there are any, UpdateConfig returns *ConfigNotReloadableError after applying the reloadable fields.
+// If DHT node cannot be restarted with the new address, DHT fields are not changed and the error is returned.
+func (s *Session) UpdateConfig(cfg Config) error {
+	s.mUpdateConfig.Lock()
+	defer s.mUpdateConfig.Unlock()
+
+	var err error
+	cfg.Database, err = homedir.Expand(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	reloadable := make(map[string]bool, len(ReloadableConfigFields))
+	for _, name := range ReloadableConfigFields {
+		reloadable[name] = true
+	}
+
+	s.mConfig.Lock()
+	old := s.config
+	var changed bool
+	var notReloadable []string
+	cur := reflect.ValueOf(&s.config).Elem()
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if reflect.DeepEqual(cur.Field(i).Interface(), v.Field(i).Interface()) {
+			continue
+		}
+		switch {
+		case reloadable[name]:
+			cur.Field(i).Set(v.Field(i))
+			changed = true
+		case name == "DataDir":
+			// Session modifies DataDir while adding torrents so it never matches the initial value.
+		default:
+			notReloadable = append(notReloadable, name)
+		}
+	}
+	newConfig := s.config
+	s.mConfig.Unlock()
+
+	if changed {
+		if newConfig.BlocklistURL != old.BlocklistURL || newConfig.BlocklistUpdateInterval != old.BlocklistUpdateInterval {
+			s.restartBlocklistReloader(old, newConfig)
+		}
+		if !reflect.DeepEqual(newConfig.DHTBootstrapNodes, old.DHTBootstrapNodes) {
+			s.mutableResolver.SetBootstrapNodes(newConfig.DHTBootstrapNodes)
+		}
+		if newConfig.DHTHost != old.DHTHost || newConfig.DHTPort != old.DHTPort || !reflect.DeepEqual(newConfig.DHTBootstrapNodes, old.DHTBootstrapNodes) {
+			err = s.restartDHT(old, newConfig)
+			if err != nil {
+				s.mConfig.Lock()
+				s.config.DHTHost, s.config.DHTPort, s.config.DHTBootstrapNodes = old.DHTHost, old.DHTPort, old.DHTBootstrapNodes
+				newConfig = s.config
+				s.mConfig.Unlock()
+				s.mutableResolver.SetBootstrapNodes(old.DHTBootstrapNodes)
+				err = fmt.Errorf("cannot restart DHT node: %s", err)
+			}
+		}
+		s.log.Info("Config is updated. Applying changes to torrents...")
+		for _, t := range s.ListTorrents() {
+			t.torrent.setConfig(newConfig)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(notReloadable) > 0 {
+		return &ConfigNotReloadableError{Fields: notReloadable}
+	}
+	return nil
+}
@@ -2,17 +2,74 @@ package torrent
 
 import (
 	"net"
+	"strings"
 	"time"
+
+	"github.com/nictuku/dht"
 )
 
-func (s *Session) processDHTResults() {
+// startDHTNode creates a DHT node from cfg and starts listening.
+func startDHTNode(cfg Config) (*dht.DHT, error) {
+	dhtConfig := dht.NewConfig()
+	dhtConfig.Address = cfg.DHTHost
+	dhtConfig.Port = int(cfg.DHTPort)
+	dhtConfig.DHTRouters = strings.Join(cfg.DHTBootstrapNodes, ",")
+	dhtConfig.SaveRoutingTable = false
+	node, err := dht.New(dhtConfig)
+	if err != nil {
+		return nil, err
+	}
+	err = node.Start()
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// restartDHT replaces the DHT node when DHTHost, DHTPort or DHTBootstrapNodes is changed with UpdateConfig.
+// Old node is stopped first, so the new node can listen on the same address.
+// If the new node cannot be started, a node with old config is started again and the error is returned.
+func (s *Session) restartDHT(old, cfg Config) error {
+	s.mDHT.Lock()
+	defer s.mDHT.Unlock()
+	if s.dht == nil {
+		return nil
+	}
+	close(s.dhtStopC)
+	s.dht.Stop()
+	s.dht = nil
+	node, err := startDHTNode(cfg)
+	if err != nil {
+		var err2 error
+		node, err2 = startDHTNode(old)
+		if err2 != nil {
+			s.log.Errorln("cannot start DHT node again with previous config:", err2.Error())
+			return err
+		}
+	}
+	s.dht = node
+	s.dhtStopC = make(chan struct{})
+	go s.processDHTResults(node, s.dhtStopC)
+	return err
+}
+
+// addDHTNode adds the node at addr to the routing table of the DHT node if it is running.
+func (s *Session) addDHTNode(addr string) {
+	s.mDHT.RLock()
+	defer s.mDHT.RUnlock()
+	if s.dht != nil {
+		s.dht.AddNode(addr)
+	}
+}
+
+func (s *Session) processDHTResults(node *dht.DHT, stopC chan struct{}) {
 	dhtLimiter := time.NewTicker(time.Second)
 	defer dhtLimiter.Stop()
 	for {
 		select {
 		case <-dhtLimiter.C:
 			s.handleDHTtick()
-		case res := <-s.dht.PeersRequestResults:
+		case res := <-node.PeersRequestResults:
 			for ih, peers := range res {
 				torrents, ok := s.torrentsByInfoHash[ih]
 				if !ok {
@@ -27,6 +84,8 @@ func (s *Session) processDHTResults() {
 					}
 				}
 			}
+		case <-stopC:
+			return
 		case <-s.closeC:
 			return
 		}
@@ -34,6 +93,12 @@ func (s *Session) processDHTResults() {
 }
 
 func (s *Session) handleDHTtick() {
+	// Node is not stopped while requests are sent to it.
+	s.mDHT.RLock()
+	defer s.mDHT.RUnlock()
+	if s.dht == nil {
+		return
+	}
 	s.mPeerRequests.Lock()
 	defer s.mPeerRequests.Unlock()
 	for t := range s.dhtPeerRequests {
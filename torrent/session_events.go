@@ -0,0 +1,130 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+// Types of events published by Session.
+const (
+	// Torrent is added to the Session.
+	EventAdded EventType = "added"
+	// Torrent is removed from the Session.
+	EventRemoved EventType = "removed"
+	// Torrent is started.
+	EventStarted EventType = "started"
+	// Torrent is stopped. Stopped event is also published when the torrent is stopped by an error.
+	EventStopped EventType = "stopped"
+	// All pieces of the torrent are downloaded.
+	// It is not published when a torrent that is already complete is started or verified.
+	EventCompleted EventType = "completed"
+	// Torrent is stopped with an error.
+	EventError EventType = "error"
+	// Info dictionary of the torrent is downloaded from peers.
+	EventMetadataReceived EventType = "metadata-received"
+	// Announce to a tracker has failed.
+	EventTrackerError EventType = "tracker-error"
+	// A piece is downloaded and its hash is verified.
+	EventPieceCompleted EventType = "piece-completed"
+)
+
+// Number of events buffered for a Subscription. Events are dropped if the subscriber does not keep up.
+const eventBufferSize = 1024
+
+// Event is a change in the state of a torrent.
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	TorrentID string
+	// Set for EventError and EventTrackerError.
+	Error error
+	// URL of the tracker. Set for EventTrackerError.
+	Tracker string
+	// Index of the piece. Set for EventPieceCompleted.
+	Piece uint32
+}
+
+// Subscription receives events published by Session.
+type Subscription struct {
+	// C is closed when the Subscription or the Session is closed.
+	C <-chan Event
+
+	c   chan Event
+	bus *eventBus
+}
+
+// Close stops receiving events.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+type eventBus struct {
+	m           sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*Subscription]struct{})}
+}
+
+func (b *eventBus) subscribe() *Subscription {
+	c := make(chan Event, eventBufferSize)
+	sub := &Subscription{C: c, c: c, bus: b}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *Subscription) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+func (b *eventBus) publish(e Event) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for sub := range b.subscribers {
+		select {
+		case sub.c <- e:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// Subscribe returns a new Subscription for receiving events of all torrents in the Session.
+// Subscription must be closed after use.
+func (s *Session) Subscribe() *Subscription {
+	return s.events.subscribe()
+}
+
+func (s *Session) publishEvent(e Event) {
+	e.Time = time.Now()
+	s.events.publish(e)
+}
+
+func (t *torrent) publishEvent(typ EventType) {
+	t.session.publishEvent(Event{Type: typ, TorrentID: t.id})
+}
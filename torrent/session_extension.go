@@ -0,0 +1,123 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ProtocolONE/rain/internal/peer"
+	"github.com/ProtocolONE/rain/internal/peerprotocol"
+)
+
+var errTooManyExtensions = errors.New("too many extensions")
+
+// ExtensionHandler implements a custom message type of BEP 10 extension protocol.
+// Methods are called from the goroutine of the torrent that the peer belongs to.
+// They must not block and must not call the methods of Torrent synchronously.
+type ExtensionHandler interface {
+	// HandshakeKeys returns the keys that are added to the extension handshake sent to peers of the torrent.
+	// Keys that are set by the client, such as "m", "v" and "reqq", cannot be overridden.
+	HandshakeKeys(torrentID string) map[string]interface{}
+	// HandlePeer is called when a peer advertises the extension in its extension handshake.
+	// keys contains the keys in the handshake of the peer that are not used by the client.
+	HandlePeer(p *ExtensionPeer, keys map[string]interface{})
+	// HandleMessage is called for each message of the extension that is received from the peer.
+	// Payload contains the bytes after the extended message ID and is not decoded.
+	HandleMessage(p *ExtensionPeer, payload []byte)
+	// HandleDisconnect is called when a peer that is passed to HandlePeer is disconnected.
+	HandleDisconnect(p *ExtensionPeer)
+}
+
+// ExtensionPeer is a connected peer that supports a custom extension.
+// Its methods are safe for concurrent use.
+type ExtensionPeer struct {
+	peer      *peer.Peer
+	torrentID string
+	infoHash  InfoHash
+	// ID of the extension in the handshake of the peer
+	extensionID uint8
+}
+
+// TorrentID returns the ID of the torrent that the peer is connected for.
+func (p *ExtensionPeer) TorrentID() string {
+	return p.torrentID
+}
+
+// InfoHash returns the info hash of the torrent that the peer is connected for.
+func (p *ExtensionPeer) InfoHash() InfoHash {
+	return p.infoHash
+}
+
+// ID returns the peer ID sent in BitTorrent handshake.
+func (p *ExtensionPeer) ID() [20]byte {
+	return p.peer.ID
+}
+
+// Addr returns the remote address of the peer.
+func (p *ExtensionPeer) Addr() *net.TCPAddr {
+	return p.peer.Addr()
+}
+
+// Send queues a message of the extension for sending to the peer.
+// Payload is sent after the extended message ID as is.
+func (p *ExtensionPeer) Send(payload []byte) {
+	p.peer.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: p.extensionID,
+		Payload:           peerprotocol.ExtensionCustomMessage{Data: payload},
+	})
+}
+
+type customExtension struct {
+	name    string
+	id      uint8
+	handler ExtensionHandler
+}
+
+// RegisterExtension adds a custom extension to the extension handshake that is sent to peers.
+// Messages of the extension that are received from peers advertising the same name are passed to handler.
+// Peers that are already connected do not see the extension until they reconnect.
+func (s *Session) RegisterExtension(name string, handler ExtensionHandler) error {
+	if name == "" {
+		return errors.New("extension name is empty")
+	}
+	if handler == nil {
+		return errors.New("extension handler is nil")
+	}
+	switch name {
+	case peerprotocol.ExtensionKeyMetadata, peerprotocol.ExtensionKeyPEX, peerprotocol.ExtensionKeyDontHave, peerprotocol.ExtensionKeyHolepunch:
+		return fmt.Errorf("extension is implemented by the client: %s", name)
+	}
+	s.mCustomExtensions.Lock()
+	defer s.mCustomExtensions.Unlock()
+	for _, e := range s.customExtensions {
+		if e.name == name {
+			return fmt.Errorf("extension is already registered: %s", name)
+		}
+	}
+	id := peerprotocol.ExtensionIDFirstCustom + len(s.customExtensions)
+	if id > 255 {
+		return errTooManyExtensions
+	}
+	s.customExtensions = append(s.customExtensions, &customExtension{
+		name:    name,
+		id:      uint8(id),
+		handler: handler,
+	})
+	return nil
+}
+
+func (s *Session) getCustomExtensions() []*customExtension {
+	s.mCustomExtensions.RLock()
+	defer s.mCustomExtensions.RUnlock()
+	return s.customExtensions
+}
+
+func (s *Session) getCustomExtension(id uint8) *customExtension {
+	s.mCustomExtensions.RLock()
+	defer s.mCustomExtensions.RUnlock()
+	i := int(id) - peerprotocol.ExtensionIDFirstCustom
+	if i < 0 || i >= len(s.customExtensions) {
+		return nil
+	}
+	return s.customExtensions[i]
+}
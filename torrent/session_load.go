@@ -73,6 +73,14 @@ func (s *Session) loadExistingTorrents(ids []string) {
 		}
 		t.webseedClient = &s.webseedClient
 		t.webseedSources = webseedsource.NewList(spec.URLList)
+		t.replaces = spec.Replaces
+		t.collections = spec.Collections
+		t.labels = spec.Labels
+		t.downloadLimiter.SetLimit(spec.DownloadLimit)
+		t.uploadLimiter.SetLimit(spec.UploadLimit)
+		if len(spec.PublicKey) > 0 {
+			s.addMutableTorrent(id, spec.PublicKey, spec.Salt, spec.Seq)
+		}
 		go s.checkTorrent(t)
 		delete(s.availablePorts, spec.Port)
 
@@ -0,0 +1,167 @@
+package torrent
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/bitfield"
+	"github.com/ProtocolONE/rain/internal/magnet"
+	"github.com/ProtocolONE/rain/internal/metainfo"
+	"github.com/ProtocolONE/rain/internal/mutableresolver"
+	"github.com/ProtocolONE/rain/internal/resumer/boltdbresumer"
+)
+
+// mutableTorrent is a torrent that follows the versions published in DHT under a public key (BEP 46).
+type mutableTorrent struct {
+	publicKey []byte
+	salt      []byte
+	seq       int64
+}
+
+func (s *Session) addMutableTorrent(id string, publicKey, salt []byte, seq int64) {
+	s.mMutableTorrents.Lock()
+	s.mutableTorrents[id] = &mutableTorrent{publicKey: publicKey, salt: salt, seq: seq}
+	s.mMutableTorrents.Unlock()
+}
+
+func (s *Session) removeMutableTorrent(id string) {
+	s.mMutableTorrents.Lock()
+	delete(s.mutableTorrents, id)
+	s.mMutableTorrents.Unlock()
+}
+
+func (s *Session) resolveMutable(publicKey, salt []byte) (*mutableresolver.Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.getConfig().MutableTorrentResolveTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return s.mutableResolver.Resolve(ctx, publicKey, salt)
+}
+
+func (s *Session) updateMutableTorrentsLoop() {
+	ticker := time.NewTicker(s.config.MutableTorrentUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.updateMutableTorrents()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) updateMutableTorrents() {
+	s.mMutableTorrents.Lock()
+	mutables := make(map[string]mutableTorrent, len(s.mutableTorrents))
+	for id, mt := range s.mutableTorrents {
+		mutables[id] = *mt
+	}
+	s.mMutableTorrents.Unlock()
+
+	for id, mt := range mutables {
+		item, err := s.resolveMutable(mt.publicKey, mt.salt)
+		if err != nil {
+			s.log.Debugf("cannot resolve mutable torrent %s: %s", id, err)
+			continue
+		}
+		if item.Seq <= mt.seq {
+			continue
+		}
+		err = s.addNextVersion(id, mt, item)
+		if err != nil {
+			s.log.Errorf("cannot add new version of mutable torrent %s: %s", id, err)
+		}
+	}
+}
+
+// addNextVersion adds the new version of the mutable torrent with id and stops following the public key in the old one.
+func (s *Session) addNextVersion(id string, mt mutableTorrent, item *mutableresolver.Item) error {
+	t := s.GetTorrent(id)
+	if t == nil {
+		return nil
+	}
+	if item.InfoHash == t.InfoHash() {
+		s.addMutableTorrent(id, mt.publicKey, mt.salt, item.Seq)
+		return s.resumer.WriteMutable(id, mt.publicKey, mt.salt, item.Seq)
+	}
+	spec, err := s.resumer.Read(id)
+	if err != nil {
+		return err
+	}
+	ma := &magnet.Magnet{
+		InfoHash:  item.InfoHash,
+		Name:      spec.Name,
+		Trackers:  spec.Trackers,
+		Peers:     spec.FixedPeers,
+		PublicKey: mt.publicKey,
+		Salt:      mt.salt,
+	}
+	// New version is saved next to the old one.
+	nextID := nextVersionID(id, item.Seq)
+	dest := filepath.Join(filepath.Dir(spec.Dest), nextID)
+	// New version may be added before if saving the old one has failed.
+	if s.GetTorrent(nextID) == nil {
+		t2, err := s.addMagnetTorrent(ma, nextID, dest, item.Seq, id, false)
+		if err != nil {
+			return err
+		}
+		s.log.Infof("added version %d of mutable torrent %s as %s", item.Seq, id, t2.ID())
+	}
+	// Old version stops following the public key only after the new version is added,
+	// so the update is retried if adding fails.
+	s.removeMutableTorrent(id)
+	return s.resumer.WriteMutable(id, nil, nil, 0)
+}
+
+// nextVersionID returns the ID for the version seq of the mutable torrent with id.
+// Version suffix of id is replaced, so IDs do not grow with each version.
+func nextVersionID(id string, seq int64) string {
+	if i := strings.LastIndex(id, "-v"); i >= 0 {
+		if _, err := strconv.ParseInt(id[i+2:], 10, 64); err == nil {
+			id = id[:i]
+		}
+	}
+	return id + "-v" + strconv.FormatInt(seq, 10)
+}
+
+// removePreviousVersion removes the torrent with prevID after the torrent with id that replaces it is completed.
+func (s *Session) removePreviousVersion(id, prevID string) {
+	err := s.RemoveTorrent(prevID)
+	if err != nil {
+		s.log.Errorf("cannot remove previous version of torrent %s: %s", id, err)
+	}
+	err = s.resumer.WriteReplaces(id, "")
+	if err != nil {
+		s.log.Error(err)
+	}
+}
+
+// readDownloadedData returns the resume spec, info and bitfield of the torrent with id from resume database.
+// Info is nil if the metadata of the torrent is not downloaded or no piece is downloaded yet.
+func (s *Session) readDownloadedData(id string) (*boltdbresumer.Spec, *metainfo.Info, *bitfield.Bitfield, error) {
+	spec, err := s.resumer.Read(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(spec.Info) == 0 || len(spec.Bitfield) == 0 {
+		return spec, nil, nil, nil
+	}
+	info, err := metainfo.NewInfo(spec.Info)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	bf, err := bitfield.NewBytes(spec.Bitfield, info.NumPieces)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return spec, info, bf, nil
+}
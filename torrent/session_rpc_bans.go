@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"net"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+)
+
+func (h *rpcHandler) ListBans(args *rpctypes.ListBansRequest, reply *rpctypes.ListBansResponse) error {
+	bans := h.session.ListBans()
+	reply.Bans = make([]rpctypes.Ban, len(bans))
+	for i, b := range bans {
+		reply.Bans[i] = rpctypes.Ban{
+			IP:        b.IP.String(),
+			Reason:    b.Reason,
+			CreatedAt: rpctypes.Time{Time: b.CreatedAt},
+		}
+		if !b.ExpiresAt.IsZero() {
+			reply.Bans[i].ExpiresAt = &rpctypes.Time{Time: b.ExpiresAt}
+		}
+	}
+	return nil
+}
+
+func (h *rpcHandler) AddBan(args *rpctypes.AddBanRequest, reply *rpctypes.AddBanResponse) error {
+	ip := net.ParseIP(args.IP)
+	if ip == nil {
+		return errInvalidIP
+	}
+	return h.session.AddBan(ip, args.Reason, time.Duration(args.Duration)*time.Second)
+}
+
+func (h *rpcHandler) RemoveBan(args *rpctypes.RemoveBanRequest, reply *rpctypes.RemoveBanResponse) error {
+	ip := net.ParseIP(args.IP)
+	if ip == nil {
+		return errInvalidIP
+	}
+	return h.session.RemoveBan(ip)
+}
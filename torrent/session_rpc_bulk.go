@@ -0,0 +1,201 @@
+package torrent
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+	"github.com/fatih/structs"
+)
+
+var errEmptyFilter = errors.New("filter must not be empty")
+
+// filterTorrents returns the torrents in session that match f.
+func (h *rpcHandler) filterTorrents(f *rpctypes.TorrentFilter) ([]*Torrent, error) {
+	if f.Name != "" {
+		if _, err := path.Match(f.Name, ""); err != nil {
+			return nil, err
+		}
+	}
+	var torrents []*Torrent
+	if len(f.IDs) > 0 {
+		for _, id := range f.IDs {
+			if t := h.session.GetTorrent(id); t != nil {
+				torrents = append(torrents, t)
+			}
+		}
+	} else {
+		torrents = h.session.ListTorrents()
+	}
+	ret := torrents[:0]
+	for _, t := range torrents {
+		if matchTorrent(t, f) {
+			ret = append(ret, t)
+		}
+	}
+	return ret, nil
+}
+
+func matchTorrent(t *Torrent, f *rpctypes.TorrentFilter) bool {
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, t.Name()); !ok {
+			return false
+		}
+	}
+	if len(f.Status) > 0 {
+		status := torrentStatusToString(t.Stats().Status)
+		var ok bool
+		for _, s := range f.Status {
+			if strings.EqualFold(s, status) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.Label != "" {
+		var ok bool
+		for _, l := range t.Labels() {
+			if l == f.Label {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.TrackerHost != "" {
+		var ok bool
+		for _, tr := range t.Trackers() {
+			u, err := url.Parse(tr.URL)
+			if err == nil && strings.EqualFold(u.Hostname(), f.TrackerHost) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptyFilter(f *rpctypes.TorrentFilter) bool {
+	return len(f.IDs) == 0 && len(f.Status) == 0 && f.Name == "" && f.TrackerHost == "" && f.Label == ""
+}
+
+func (h *rpcHandler) ListTorrentsWithStats(args *rpctypes.ListTorrentsWithStatsRequest, reply *rpctypes.ListTorrentsWithStatsResponse) error {
+	torrents, err := h.filterTorrents(&args.Filter)
+	if err != nil {
+		return err
+	}
+	reply.Torrents = make([]rpctypes.TorrentWithStats, 0, len(torrents))
+	for _, t := range torrents {
+		m := structs.Map(newStats(t.Stats()))
+		if len(args.Fields) > 0 {
+			selected := make(map[string]interface{}, len(args.Fields))
+			for _, name := range args.Fields {
+				if v, ok := m[name]; ok {
+					selected[name] = v
+				}
+			}
+			m = selected
+		}
+		reply.Torrents = append(reply.Torrents, rpctypes.TorrentWithStats{
+			Torrent: newTorrent(t),
+			Stats:   m,
+		})
+	}
+	return nil
+}
+
+// bulk calls fn for each torrent that matches f.
+// Errors returned from fn are reported in results instead of failing the request.
+func (h *rpcHandler) bulk(f *rpctypes.TorrentFilter, fn func(t *Torrent) error) ([]rpctypes.BulkResult, error) {
+	if isEmptyFilter(f) {
+		return nil, errEmptyFilter
+	}
+	torrents, err := h.filterTorrents(f)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]rpctypes.BulkResult, 0, len(torrents))
+	for _, t := range torrents {
+		res := rpctypes.BulkResult{ID: t.ID()}
+		if err := fn(t); err != nil {
+			errStr := err.Error()
+			res.Error = &errStr
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (h *rpcHandler) StartTorrents(args *rpctypes.StartTorrentsRequest, reply *rpctypes.StartTorrentsResponse) error {
+	var err error
+	reply.Results, err = h.bulk(&args.Filter, (*Torrent).Start)
+	return err
+}
+
+func (h *rpcHandler) StopTorrents(args *rpctypes.StopTorrentsRequest, reply *rpctypes.StopTorrentsResponse) error {
+	var err error
+	reply.Results, err = h.bulk(&args.Filter, (*Torrent).Stop)
+	return err
+}
+
+func (h *rpcHandler) RemoveTorrents(args *rpctypes.RemoveTorrentsRequest, reply *rpctypes.RemoveTorrentsResponse) error {
+	var err error
+	reply.Results, err = h.bulk(&args.Filter, func(t *Torrent) error { return h.session.RemoveTorrent(t.ID()) })
+	return err
+}
+
+func (h *rpcHandler) SetTorrentLabels(args *rpctypes.SetTorrentLabelsRequest, reply *rpctypes.SetTorrentLabelsResponse) error {
+	var err error
+	reply.Results, err = h.bulk(&args.Filter, func(t *Torrent) error { return t.SetLabels(args.Labels) })
+	return err
+}
+
+func (h *rpcHandler) SetTorrentLimits(args *rpctypes.SetTorrentLimitsRequest, reply *rpctypes.SetTorrentLimitsResponse) error {
+	var err error
+	reply.Results, err = h.bulk(&args.Filter, func(t *Torrent) error { return t.SetSpeedLimits(args.DownloadLimit, args.UploadLimit) })
+	return err
+}
+
+// VerifyTorrents verifies matching torrents concurrently and waits for all of them to finish.
+func (h *rpcHandler) VerifyTorrents(args *rpctypes.VerifyTorrentsRequest, reply *rpctypes.VerifyTorrentsResponse) error {
+	if isEmptyFilter(&args.Filter) {
+		return errEmptyFilter
+	}
+	torrents, err := h.filterTorrents(&args.Filter)
+	if err != nil {
+		return err
+	}
+	reply.Results = make([]rpctypes.VerifyTorrentsResult, len(torrents))
+	var wg sync.WaitGroup
+	wg.Add(len(torrents))
+	for i, t := range torrents {
+		go func(res *rpctypes.VerifyTorrentsResult, t *Torrent) {
+			defer wg.Done()
+			res.ID = t.ID()
+			vr, err := t.Verify()
+			if err != nil {
+				errStr := err.Error()
+				res.Error = &errStr
+				return
+			}
+			res.Result = &rpctypes.VerifyResult{
+				Have:  vr.Have,
+				Found: vr.Found,
+				Lost:  vr.Lost,
+			}
+		}(&reply.Results[i], t)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,70 @@
+package torrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Config fields that contain credentials are not exposed over RPC.
+var rpcHiddenConfigFields = map[string]bool{
+	"RPCToken": true,
+	"RPCUsers": true,
+}
+
+func (h *rpcHandler) GetConfig(args *rpctypes.GetConfigRequest, reply *rpctypes.GetConfigResponse) error {
+	cfg := h.session.getConfig()
+	v := reflect.ValueOf(cfg)
+	reply.Config = make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if rpcHiddenConfigFields[name] {
+			continue
+		}
+		f := v.Field(i)
+		if f.Type() == durationType {
+			reply.Config[name] = time.Duration(f.Int()).String()
+		} else {
+			reply.Config[name] = f.Interface()
+		}
+	}
+	reply.Reloadable = ReloadableConfigFields
+	return nil
+}
+
+func (h *rpcHandler) SetConfig(args *rpctypes.SetConfigRequest, reply *rpctypes.SetConfigResponse) error {
+	cfg := h.session.getConfig()
+	v := reflect.ValueOf(&cfg).Elem()
+	for name, value := range args.Config {
+		f := v.FieldByName(name)
+		if !f.IsValid() || rpcHiddenConfigFields[name] {
+			return fmt.Errorf("unknown config field: %s", name)
+		}
+		err := setConfigField(f, value)
+		if err != nil {
+			return fmt.Errorf("invalid value for config field %s: %s", name, err)
+		}
+	}
+	return h.session.UpdateConfig(cfg)
+}
+
+func setConfigField(f reflect.Value, value interface{}) error {
+	if s, ok := value.(string); ok && f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, f.Addr().Interface())
+}
@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+)
+
+// Interval for sending comments on idle event streams so that proxies do not close the connection.
+const eventStreamKeepAlive = 30 * time.Second
+
+// handleEvents streams session events to the client in Server-Sent Events format.
+// Events can be filtered by torrent ID with "torrent" query parameter.
+func (s *rpcServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	torrentID := r.URL.Query().Get("torrent")
+
+	sub := s.session.Subscribe()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventStreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if torrentID != "" && e.TorrentID != torrentID {
+				continue
+			}
+			b, err := json.Marshal(newRPCEvent(e))
+			if err != nil {
+				s.log.Errorln("cannot marshal event:", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func newRPCEvent(e Event) rpctypes.Event {
+	var errStr *string
+	if e.Error != nil {
+		s := e.Error.Error()
+		errStr = &s
+	}
+	return rpctypes.Event{
+		Type:      string(e.Type),
+		Time:      rpctypes.Time{Time: e.Time},
+		TorrentID: e.TorrentID,
+		Error:     errStr,
+		Tracker:   e.Tracker,
+		Piece:     e.Piece,
+	}
+}
@@ -32,7 +32,7 @@ func (h *rpcHandler) ListTorrents(args *rpctypes.ListTorrentsRequest, reply *rpc
 
 func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctypes.AddTorrentResponse) error {
 	r := base64.NewDecoder(base64.StdEncoding, strings.NewReader(args.Torrent))
-	t, err := h.session.AddTorrent(r)
+	t, err := h.session.AddTorrentWithOptions(r, &AddTorrentOptions{FindExistingDataIn: args.FindExistingDataIn})
 	if err != nil {
 		return err
 	}
@@ -50,12 +50,16 @@ func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURI
 }
 
 func newTorrent(t *Torrent) rpctypes.Torrent {
+	download, upload := t.SpeedLimits()
 	return rpctypes.Torrent{
-		ID:       t.ID(),
-		Name:     t.Name(),
-		InfoHash: t.InfoHash().String(),
-		Port:     t.Port(),
-		AddedAt:  rpctypes.Time{Time: t.AddedAt()},
+		ID:            t.ID(),
+		Name:          t.Name(),
+		InfoHash:      t.InfoHash().String(),
+		Port:          t.Port(),
+		AddedAt:       rpctypes.Time{Time: t.AddedAt()},
+		Labels:        t.Labels(),
+		DownloadLimit: download,
+		UploadLimit:   upload,
 	}
 }
 
@@ -69,6 +73,14 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 	if !s.BlockListLastSuccessfulUpdate.IsZero() {
 		blocklistUpdatedAt = &rpctypes.Time{Time: s.BlockListLastSuccessfulUpdate}
 	}
+	cacheTorrents := make([]rpctypes.PieceCacheTorrent, len(s.PieceCacheTorrents))
+	for i, ct := range s.PieceCacheTorrents {
+		cacheTorrents[i] = rpctypes.PieceCacheTorrent{
+			ID:    ct.ID,
+			Items: ct.Items,
+			Size:  ct.Size,
+		}
+	}
 	reply.Stats = rpctypes.SessionStats{
 		Torrents:                      s.Torrents,
 		AvailablePorts:                s.AvailablePorts,
@@ -77,10 +89,17 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 		PieceCacheItems:               s.PieceCacheItems,
 		PieceCacheSize:                s.PieceCacheSize,
 		PieceCacheUtilization:         s.PieceCacheUtilization,
+		PieceCacheTorrents:            cacheTorrents,
 		ReadsPerSecond:                s.ReadsPerSecond,
 		ReadsActive:                   s.ReadsActive,
 		ReadsPending:                  s.ReadsPending,
 		ReadBytesPerSecond:            s.ReadBytesPerSecond,
+		PrefetchesPerSecond:           s.PrefetchesPerSecond,
+		WriteCacheFiles:               s.WriteCacheFiles,
+		WriteCacheSize:                s.WriteCacheSize,
+		WriteCacheUtilization:         s.WriteCacheUtilization,
+		WritesPerSecond:               s.WritesPerSecond,
+		WriteBytesPerSecond:           s.WriteBytesPerSecond,
 		ActivePieceBytes:              s.ActivePieceBytes,
 		TorrentsPendingRAM:            s.TorrentsPendingRAM,
 		Uptime:                        int(s.Uptime / time.Second),
@@ -93,8 +112,12 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 	if t == nil {
 		return errTorrentNotFound
 	}
-	s := t.Stats()
-	reply.Stats = rpctypes.Stats{
+	reply.Stats = newStats(t.Stats())
+	return nil
+}
+
+func newStats(s Stats) rpctypes.Stats {
+	ret := rpctypes.Stats{
 		Status: torrentStatusToString(s.Status),
 		Pieces: struct {
 			Checked   uint32
@@ -186,16 +209,18 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Download: s.Speed.Download,
 			Upload:   s.Speed.Upload,
 		},
+		HashFailures:  s.HashFailures,
+		TrackerErrors: s.TrackerErrors,
 	}
 	if s.Error != nil {
 		errStr := s.Error.Error()
-		reply.Stats.Error = &errStr
+		ret.Error = &errStr
 	}
 	if s.ETA != nil {
 		eta := uint(*s.ETA / time.Second)
-		reply.Stats.ETA = &eta
+		ret.ETA = &eta
 	}
-	return nil
+	return ret
 }
 
 func (h *rpcHandler) GetTorrentTrackers(args *rpctypes.GetTorrentTrackersRequest, reply *rpctypes.GetTorrentTrackersResponse) error {
@@ -240,6 +265,8 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			source = "INCOMING"
 		case SourceManual:
 			source = "MANUAL"
+		case SourceHolepunch:
+			source = "HOLEPUNCH"
 		default:
 			panic("unhandled peer source")
 		}
@@ -260,6 +287,9 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			EncryptedStream:    p.EncryptedStream,
 			DownloadSpeed:      p.DownloadSpeed,
 			UploadSpeed:        p.UploadSpeed,
+			RequestQueue:       p.RequestQueue,
+			PendingRequests:    p.PendingRequests,
+			RTT:                uint(p.RTT / time.Millisecond),
 		}
 	}
 	return nil
@@ -285,6 +315,35 @@ func (h *rpcHandler) GetTorrentWebseeds(args *rpctypes.GetTorrentWebseedsRequest
 	return nil
 }
 
+func (h *rpcHandler) GetTorrentFiles(args *rpctypes.GetTorrentFilesRequest, reply *rpctypes.GetTorrentFilesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	files := t.Files()
+	reply.Files = make([]rpctypes.File, len(files))
+	for i, f := range files {
+		reply.Files[i] = rpctypes.File{
+			Path:      f.Path,
+			Length:    f.Length,
+			Completed: f.Completed,
+		}
+	}
+	return nil
+}
+
+func (h *rpcHandler) GetTorrentPieces(args *rpctypes.GetTorrentPiecesRequest, reply *rpctypes.GetTorrentPiecesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	pm := t.PieceMap()
+	reply.NumPieces = uint32(len(pm.Availability))
+	reply.Have = base64.StdEncoding.EncodeToString(pm.Have)
+	reply.Availability = pm.Availability
+	return nil
+}
+
 func (h *rpcHandler) StartTorrent(args *rpctypes.StartTorrentRequest, reply *rpctypes.StartTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -324,3 +383,20 @@ func (h *rpcHandler) AddTracker(args *rpctypes.AddTrackerRequest, reply *rpctype
 	}
 	return t.AddTracker(args.URL)
 }
+
+func (h *rpcHandler) VerifyTorrent(args *rpctypes.VerifyTorrentRequest, reply *rpctypes.VerifyTorrentResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	res, err := t.Verify()
+	if err != nil {
+		return err
+	}
+	reply.Result = rpctypes.VerifyResult{
+		Have:  res.Have,
+		Found: res.Found,
+		Lost:  res.Lost,
+	}
+	return nil
+}
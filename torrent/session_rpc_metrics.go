@@ -0,0 +1,168 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// metricsWriter writes metrics in Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+type metricLabel struct {
+	name, value string
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// family writes the header of a metric family. Samples of the family must be written right after.
+func (w *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w *metricsWriter) sample(name string, value float64, labels ...metricLabel) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, `%s="%s"`, l.name, metricLabelEscaper.Replace(l.value))
+		}
+		w.buf.WriteByte('}')
+	}
+	fmt.Fprintf(&w.buf, " %g\n", value)
+}
+
+// gauge writes a metric family with a single sample.
+func (w *metricsWriter) gauge(name, help string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, value)
+}
+
+type torrentMetrics struct {
+	id          string
+	name        string
+	stats       Stats
+	peersBySrc  map[PeerSource]int
+	numTrackers int
+}
+
+// Label values of peer sources in the order they are written.
+var metricPeerSources = []struct {
+	source PeerSource
+	label  string
+}{
+	{SourceTracker, "tracker"},
+	{SourceDHT, "dht"},
+	{SourcePEX, "pex"},
+	{SourceIncoming, "incoming"},
+	{SourceManual, "manual"},
+	{SourceHolepunch, "holepunch"},
+}
+
+func (s *rpcServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var mw metricsWriter
+
+	ss := s.session.Stats()
+	mw.gauge("rain_torrents", "Number of torrents in session.", float64(ss.Torrents))
+	mw.gauge("rain_available_ports", "Number of ports available for new torrents.", float64(ss.AvailablePorts))
+	mw.gauge("rain_blocklist_rules", "Number of rules in blocklist.", float64(ss.BlockListRules))
+	if !ss.BlockListLastSuccessfulUpdate.IsZero() {
+		mw.gauge("rain_blocklist_last_update_timestamp_seconds", "Time of last successful blocklist update.", float64(ss.BlockListLastSuccessfulUpdate.Unix()))
+	}
+	mw.gauge("rain_piece_cache_items", "Number of items in piece cache.", float64(ss.PieceCacheItems))
+	mw.gauge("rain_piece_cache_size_bytes", "Size of piece cache.", float64(ss.PieceCacheSize))
+	mw.gauge("rain_piece_cache_utilization_percent", "Percentage of piece cache reads that are served from cache.", float64(ss.PieceCacheUtilization))
+	mw.gauge("rain_piece_cache_prefetches_per_second", "Read-ahead loads into piece cache per second.", float64(ss.PrefetchesPerSecond))
+	mw.gauge("rain_reads_per_second", "Piece reads from disk per second.", float64(ss.ReadsPerSecond))
+	mw.gauge("rain_reads_active", "Number of piece reads in progress.", float64(ss.ReadsActive))
+	mw.gauge("rain_reads_pending", "Number of piece reads waiting to start.", float64(ss.ReadsPending))
+	mw.gauge("rain_read_bytes_per_second", "Bytes read from disk per second.", float64(ss.ReadBytesPerSecond))
+	mw.gauge("rain_write_cache_files", "Number of files with data in write cache.", float64(ss.WriteCacheFiles))
+	mw.gauge("rain_write_cache_size_bytes", "Size of data in write cache.", float64(ss.WriteCacheSize))
+	mw.gauge("rain_write_cache_utilization_percent", "Percentage of reads that are served from write cache.", float64(ss.WriteCacheUtilization))
+	mw.gauge("rain_writes_per_second", "Write cache flushes to disk per second.", float64(ss.WritesPerSecond))
+	mw.gauge("rain_write_bytes_per_second", "Bytes written to disk per second.", float64(ss.WriteBytesPerSecond))
+	mw.gauge("rain_ram_active_piece_bytes", "Memory reserved by RAM manager for pieces being downloaded.", float64(ss.ActivePieceBytes))
+	mw.gauge("rain_ram_torrents_pending", "Number of torrents waiting for memory from RAM manager.", float64(ss.TorrentsPendingRAM))
+	mw.gauge("rain_uptime_seconds", "Time since session is created.", ss.Uptime.Seconds())
+
+	torrents := s.session.ListTorrents()
+	sort.Slice(torrents, func(i, j int) bool { return torrents[i].ID() < torrents[j].ID() })
+	tms := make([]torrentMetrics, 0, len(torrents))
+	for _, t := range torrents {
+		tm := torrentMetrics{
+			id:          t.ID(),
+			stats:       t.Stats(),
+			peersBySrc:  make(map[PeerSource]int),
+			numTrackers: len(t.Trackers()),
+		}
+		tm.name = tm.stats.Name
+		for _, p := range t.Peers() {
+			tm.peersBySrc[p.Source]++
+		}
+		tms = append(tms, tm)
+	}
+	perTorrent := func(name, typ, help string, value func(tm *torrentMetrics) float64) {
+		mw.family(name, typ, help)
+		for i := range tms {
+			tm := &tms[i]
+			mw.sample(name, value(tm), metricLabel{"id", tm.id}, metricLabel{"name", tm.name})
+		}
+	}
+	perTorrent("rain_torrent_status", "gauge", "Status of torrent. 0: Stopped, 1: Downloading Metadata, 2: Allocating, 3: Verifying, 4: Downloading, 5: Seeding, 6: Stopping.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Status) })
+	perTorrent("rain_torrent_error", "gauge", "1 if torrent is stopped with an error.",
+		func(tm *torrentMetrics) float64 {
+			if tm.stats.Error != nil {
+				return 1
+			}
+			return 0
+		})
+	perTorrent("rain_torrent_size_bytes", "gauge", "Total size of files in torrent.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Total) })
+	perTorrent("rain_torrent_completed_bytes", "gauge", "Bytes that are downloaded and passed hash check.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Completed) })
+	perTorrent("rain_torrent_downloaded_bytes_total", "counter", "Bytes downloaded from swarm.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Downloaded) })
+	perTorrent("rain_torrent_uploaded_bytes_total", "counter", "Bytes uploaded to swarm.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Uploaded) })
+	perTorrent("rain_torrent_wasted_bytes_total", "counter", "Bytes downloaded that are discarded.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Wasted) })
+	perTorrent("rain_torrent_hash_failures_total", "counter", "Downloaded pieces that failed hash check.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.HashFailures) })
+	perTorrent("rain_torrent_tracker_errors_total", "counter", "Failed announces to trackers.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.TrackerErrors) })
+	perTorrent("rain_torrent_trackers", "gauge", "Number of trackers of torrent.",
+		func(tm *torrentMetrics) float64 { return float64(tm.numTrackers) })
+	perTorrent("rain_torrent_download_speed_bytes", "gauge", "Download speed in bytes per second.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Speed.Download) })
+	perTorrent("rain_torrent_upload_speed_bytes", "gauge", "Upload speed in bytes per second.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Speed.Upload) })
+	perTorrent("rain_torrent_pieces_available", "gauge", "Number of unique pieces available in swarm.",
+		func(tm *torrentMetrics) float64 { return float64(tm.stats.Pieces.Available) })
+
+	mw.family("rain_torrent_peers", "gauge", "Number of connected peers by source.")
+	for i := range tms {
+		tm := &tms[i]
+		for _, src := range metricPeerSources {
+			mw.sample("rain_torrent_peers", float64(tm.peersBySrc[src.source]), metricLabel{"id", tm.id}, metricLabel{"name", tm.name}, metricLabel{"source", src.label})
+		}
+	}
+	mw.family("rain_torrent_addresses", "gauge", "Number of peer addresses ready to be connected by source.")
+	for i := range tms {
+		tm := &tms[i]
+		mw.sample("rain_torrent_addresses", float64(tm.stats.Addresses.Tracker), metricLabel{"id", tm.id}, metricLabel{"name", tm.name}, metricLabel{"source", "tracker"})
+		mw.sample("rain_torrent_addresses", float64(tm.stats.Addresses.DHT), metricLabel{"id", tm.id}, metricLabel{"name", tm.name}, metricLabel{"source", "dht"})
+		mw.sample("rain_torrent_addresses", float64(tm.stats.Addresses.PEX), metricLabel{"id", tm.id}, metricLabel{"name", tm.name}, metricLabel{"source", "pex"})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write(mw.buf.Bytes())
+}
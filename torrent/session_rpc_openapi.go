@@ -0,0 +1,171 @@
+package torrent
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+)
+
+// openAPIHandler serves OpenAPI 3 document of the REST API.
+// The document is generated from restRoutes and the request and response types of rpcHandler methods,
+// so it cannot get out of sync with the implementation.
+type openAPIHandler struct{}
+
+func (openAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeREST(w, http.StatusOK, openAPIDocument())
+}
+
+var timeType = reflect.TypeOf(rpctypes.Time{})
+
+func openAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error": openAPISchema(reflect.TypeOf(restError{}), nil, nil),
+	}
+	ht := reflect.TypeOf(&rpcHandler{})
+	paths := make(map[string]map[string]interface{})
+	for _, route := range restRoutes {
+		m, _ := ht.MethodByName(route.Handler)
+		argType := indirectType(m.Type.In(1))
+		replyType := m.Type.In(2).Elem()
+		params := restPathParams(route.Path)
+
+		op := map[string]interface{}{
+			"operationId": route.Handler,
+			"summary":     route.Summary,
+			"responses": map[string]interface{}{
+				"200": openAPIResponse("Successful response", openAPISchema(replyType, schemas, nil)),
+				"default": openAPIResponse("Error", map[string]interface{}{
+					"$ref": "#/components/schemas/Error",
+				}),
+			},
+		}
+		if len(params) > 0 {
+			var parameters []interface{}
+			for _, p := range params {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     p,
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+			op["parameters"] = parameters
+		}
+		if route.Method != http.MethodGet && route.Method != http.MethodDelete && argType.NumField() > len(params) {
+			// Path parameters are not read from body.
+			exclude := make(map[string]bool, len(params))
+			for _, p := range params {
+				exclude[strings.ToUpper(p)] = true
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": openAPISchema(argType, schemas, exclude),
+					},
+				},
+			}
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]interface{})
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "Rain",
+			"version": Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+func openAPIResponse(description string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schema,
+			},
+		},
+	}
+}
+
+// openAPISchema returns the schema of the JSON encoding of t.
+// Named struct types from rpctypes are added to schemas and referenced.
+// Fields in exclude are omitted from the top level struct.
+func openAPISchema(t reflect.Type, schemas map[string]interface{}, exclude map[string]bool) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := openAPISchema(t.Elem(), schemas, nil)
+		if _, ok := s["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32", "minimum": 0}
+	case reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas, nil)}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas, nil)}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() != "" && schemas != nil && exclude == nil && t.NumField() > 0 {
+			if _, ok := schemas[t.Name()]; !ok {
+				schemas[t.Name()] = nil // placeholder for recursive types
+				schemas[t.Name()] = openAPIStructSchema(t, schemas, nil)
+			}
+			return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		}
+		return openAPIStructSchema(t, schemas, exclude)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func openAPIStructSchema(t reflect.Type, schemas map[string]interface{}, exclude map[string]bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || exclude[strings.ToUpper(f.Name)] {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			// Fields of embedded structs are encoded in the outer object.
+			embedded := openAPIStructSchema(f.Type, schemas, nil)["properties"].(map[string]interface{})
+			for k, v := range embedded {
+				properties[k] = v
+			}
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		properties[name] = openAPISchema(f.Type, schemas, nil)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
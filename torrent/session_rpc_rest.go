@@ -0,0 +1,165 @@
+package torrent
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// restRoute maps an HTTP endpoint to a method of rpcHandler.
+// Request struct of the method is filled from JSON body and path parameters.
+// Path parameters are set to the field with upper case name, e.g. "id" to "ID".
+type restRoute struct {
+	Method  string
+	Path    string
+	Handler string // name of the rpcHandler method
+	Summary string
+}
+
+var restRoutes = []restRoute{
+	{http.MethodGet, "/api/version", "Version", "Get server version"},
+	{http.MethodGet, "/api/session/stats", "GetSessionStats", "Get session stats"},
+	{http.MethodPost, "/api/session/start", "StartAllTorrents", "Start all torrents"},
+	{http.MethodPost, "/api/session/stop", "StopAllTorrents", "Stop all torrents"},
+	{http.MethodGet, "/api/session/config", "GetConfig", "Get session config"},
+	{http.MethodPatch, "/api/session/config", "SetConfig", "Change reloadable fields of session config"},
+	{http.MethodGet, "/api/torrents", "ListTorrents", "List torrents"},
+	{http.MethodPost, "/api/torrents", "AddTorrent", "Add torrent from base64 encoded torrent file"},
+	{http.MethodPost, "/api/torrents/uri", "AddURI", "Add torrent from magnet link or URL of torrent file"},
+	{http.MethodPost, "/api/torrents/search", "ListTorrentsWithStats", "List torrents matching filter with selected stats"},
+	{http.MethodPost, "/api/torrents/bulk/start", "StartTorrents", "Start torrents matching filter"},
+	{http.MethodPost, "/api/torrents/bulk/stop", "StopTorrents", "Stop torrents matching filter"},
+	{http.MethodPost, "/api/torrents/bulk/remove", "RemoveTorrents", "Remove torrents matching filter and their data"},
+	{http.MethodPost, "/api/torrents/bulk/verify", "VerifyTorrents", "Verify torrents matching filter"},
+	{http.MethodPost, "/api/torrents/bulk/labels", "SetTorrentLabels", "Set labels of torrents matching filter"},
+	{http.MethodPost, "/api/torrents/bulk/limits", "SetTorrentLimits", "Set speed limits of torrents matching filter"},
+	{http.MethodDelete, "/api/torrents/{id}", "RemoveTorrent", "Remove torrent and its data"},
+	{http.MethodGet, "/api/torrents/{id}/stats", "GetTorrentStats", "Get torrent stats"},
+	{http.MethodGet, "/api/torrents/{id}/trackers", "GetTorrentTrackers", "List trackers of torrent"},
+	{http.MethodPost, "/api/torrents/{id}/trackers", "AddTracker", "Add tracker to torrent"},
+	{http.MethodGet, "/api/torrents/{id}/peers", "GetTorrentPeers", "List peers of torrent"},
+	{http.MethodPost, "/api/torrents/{id}/peers", "AddPeer", "Add peer to torrent"},
+	{http.MethodGet, "/api/torrents/{id}/webseeds", "GetTorrentWebseeds", "List webseed sources of torrent"},
+	{http.MethodGet, "/api/torrents/{id}/files", "GetTorrentFiles", "List files of torrent with their progress"},
+	{http.MethodGet, "/api/torrents/{id}/pieces", "GetTorrentPieces", "Get downloaded pieces and their availability in swarm"},
+	{http.MethodPost, "/api/torrents/{id}/start", "StartTorrent", "Start torrent"},
+	{http.MethodPost, "/api/torrents/{id}/stop", "StopTorrent", "Stop torrent"},
+	{http.MethodPost, "/api/torrents/{id}/verify", "VerifyTorrent", "Verify files of torrent"},
+	{http.MethodGet, "/api/bans", "ListBans", "List banned peer IPs"},
+	{http.MethodPost, "/api/bans", "AddBan", "Ban peer IP"},
+	{http.MethodDelete, "/api/bans/{ip}", "RemoveBan", "Remove ban of peer IP"},
+}
+
+// restError is the response body of failed REST requests.
+type restError struct {
+	Error string
+}
+
+func registerRESTRoutes(mux *http.ServeMux, h *rpcHandler) {
+	hv := reflect.ValueOf(h)
+	for _, route := range restRoutes {
+		m := hv.MethodByName(route.Handler)
+		if !m.IsValid() {
+			panic("rpc handler has no method: " + route.Handler)
+		}
+		mux.Handle(route.Method+" "+route.Path, restHandler{method: m, params: restPathParams(route.Path)})
+	}
+	mux.Handle(http.MethodGet+" /api/openapi.json", openAPIHandler{})
+}
+
+type restHandler struct {
+	method reflect.Value
+	params []string
+}
+
+func (h restHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	argType := h.method.Type().In(0)
+	replyType := h.method.Type().In(1).Elem()
+
+	// Browsers send simple cross-site requests without asking the server first.
+	// Reject requests from other web pages so they cannot change the session.
+	if r.Method != http.MethodGet {
+		if !sameOrigin(r) {
+			writeREST(w, http.StatusForbidden, restError{Error: "cross-origin request"})
+			return
+		}
+		if r.Method != http.MethodDelete {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType != "application/json" {
+				writeREST(w, http.StatusUnsupportedMediaType, restError{Error: "content type must be application/json"})
+				return
+			}
+		}
+	}
+
+	args := reflect.New(indirectType(argType))
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		err := json.NewDecoder(r.Body).Decode(args.Interface())
+		if err != nil && err != io.EOF {
+			writeREST(w, http.StatusBadRequest, restError{Error: err.Error()})
+			return
+		}
+	}
+	for _, p := range h.params {
+		if f := args.Elem().FieldByName(strings.ToUpper(p)); f.IsValid() {
+			f.SetString(r.PathValue(p))
+		}
+	}
+	if argType.Kind() != reflect.Ptr {
+		args = args.Elem()
+	}
+
+	reply := reflect.New(replyType)
+	out := h.method.Call([]reflect.Value{args, reply})
+	if err, _ := out[0].Interface().(error); err != nil {
+		status := http.StatusBadRequest
+		if err == errTorrentNotFound || err == errBanNotFound {
+			status = http.StatusNotFound
+		}
+		writeREST(w, status, restError{Error: err.Error()})
+		return
+	}
+	writeREST(w, http.StatusOK, reply.Interface())
+}
+
+// sameOrigin returns true if the request does not come from a web page on another host.
+// Requests without Origin header are not sent by browsers on behalf of other pages.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+func writeREST(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// restPathParams returns the names of parameters in path.
+func restPathParams(path string) []string {
+	var params []string
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			params = append(params, strings.Trim(s, "{}"))
+		}
+	}
+	return params
+}
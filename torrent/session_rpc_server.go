@@ -1,22 +1,38 @@
 package torrent
 
 import (
-	//"context"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"expvar"
-	//"net"
+	"net"
 	"net/http"
 	"net/rpc"
-	//"strconv"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtocolONE/rain/internal/logger"
+	"github.com/ProtocolONE/rain/internal/webui"
 	"github.com/powerman/rpc-codec/jsonrpc2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type rpcServer struct {
-	rpcServer  *rpc.Server
-	httpServer http.Server
-	log        logger.Logger
+	session     *Session
+	rpcServer   *rpc.Server
+	httpServer  http.Server
+	token       string
+	users       map[string]string
+	tlsCertFile string
+	tlsKeyFile  string
+	log         logger.Logger
+
+	// Hashes of passwords that are checked with bcrypt before, keyed by username.
+	// Checking bcrypt hashes on every request is too expensive.
+	mVerified sync.Mutex
+	verified  map[string][sha256.Size]byte
 }
 
 func newRPCServer(ses *Session) *rpcServer {
@@ -24,42 +40,122 @@ func newRPCServer(ses *Session) *rpcServer {
 	srv := rpc.NewServer()
 	_ = srv.RegisterName("Session", h)
 
+	s := &rpcServer{
+		session:     ses,
+		rpcServer:   srv,
+		token:       ses.config.RPCToken,
+		users:       ses.config.RPCUsers,
+		tlsCertFile: ses.config.RPCTLSCertFile,
+		tlsKeyFile:  ses.config.RPCTLSKeyFile,
+		log:         logger.New("rpc server"),
+		verified:    make(map[string][sha256.Size]byte),
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/debug/vars", expvar.Handler())
-	mux.Handle("/", jsonrpc2.HTTPHandler(srv))
-
-	return &rpcServer{
-		rpcServer: srv,
-		httpServer: http.Server{
-			Handler: mux,
-		},
-		log: logger.New("rpc server"),
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	registerRESTRoutes(mux, h)
+	if ses.config.RPCTransmissionEnabled {
+		mux.Handle("/transmission/rpc", newTransmissionHandler(ses))
+	}
+	if ses.config.RPCWebUIEnabled {
+		mux.Handle("/ui/", webui.Handler("/ui/"))
 	}
+	mux.Handle("/", jsonrpc2.HTTPHandler(srv))
+	s.httpServer.Handler = s.authenticate(mux)
+	return s
 }
 
 func (s *rpcServer) Start(host string, port int) error {
-	/*addr := net.JoinHostPort(host, strconv.Itoa(port))
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	s.log.Infoln("RPC server is listening on", listener.Addr().String())
+	useTLS := s.tlsCertFile != "" && s.tlsKeyFile != ""
+	if useTLS {
+		s.log.Infoln("RPC server is listening with TLS on", listener.Addr().String())
+	} else {
+		s.log.Infoln("RPC server is listening on", listener.Addr().String())
+	}
 
 	go func() {
-		err := s.httpServer.Serve(listener)
+		var err error
+		if useTLS {
+			err = s.httpServer.ServeTLS(listener, s.tlsCertFile, s.tlsKeyFile)
+		} else {
+			err = s.httpServer.Serve(listener)
+		}
 		if err == http.ErrServerClosed {
 			return
 		}
-		s.log.Fatal(err)
-	}()*/
+		s.log.Errorln("RPC server has stopped:", err)
+	}()
 
 	return nil
 }
 
 func (s *rpcServer) Stop(timeout time.Duration) error {
-	/*ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)*/
-	return nil
+	return s.httpServer.Shutdown(ctx)
+}
+
+// authenticate rejects requests that do not have valid credentials before passing them to h.
+// All requests are allowed if neither a token nor users are configured.
+func (s *rpcServer) authenticate(h http.Handler) http.Handler {
+	if s.token == "" && len(s.users) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.checkAuth(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if len(s.users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="rain"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (s *rpcServer) checkAuth(r *http.Request) bool {
+	if s.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") {
+			token := strings.TrimPrefix(auth, "Bearer ")
+			return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+		}
+	}
+	if len(s.users) > 0 {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		return s.checkPassword(username, password)
+	}
+	return false
+}
+
+func (s *rpcServer) checkPassword(username, password string) bool {
+	hash, ok := s.users[username]
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(password))
+	s.mVerified.Lock()
+	verified, ok := s.verified[username]
+	s.mVerified.Unlock()
+	if ok && subtle.ConstantTimeCompare(sum[:], verified[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	s.mVerified.Lock()
+	s.verified[username] = sum
+	s.mVerified.Unlock()
+	return true
 }
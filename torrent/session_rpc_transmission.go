@@ -0,0 +1,446 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ProtocolONE/rain/internal/logger"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+)
+
+// Version of the Transmission RPC protocol that is implemented by transmissionHandler.
+const (
+	transmissionRPCVersion        = 15
+	transmissionRPCVersionMinimum = 1
+)
+
+const transmissionSessionIDHeader = "X-Transmission-Session-Id"
+
+// Torrent status values in Transmission RPC protocol.
+const (
+	transmissionStatusStopped  = 0
+	transmissionStatusCheck    = 2
+	transmissionStatusDownload = 4
+	transmissionStatusSeed     = 6
+)
+
+// Torrent error values in Transmission RPC protocol.
+const (
+	transmissionErrorNone  = 0
+	transmissionErrorLocal = 3
+)
+
+const transmissionETANotAvailable = -1
+
+var errTransmissionMethod = errors.New("method name not recognized")
+
+// transmissionHandler serves a subset of Transmission RPC protocol so that existing tools can control the Session.
+// Transmission identifies torrents with integers, so each torrent is given a number when it is seen first.
+type transmissionHandler struct {
+	session   *Session
+	sessionID string
+	log       logger.Logger
+
+	mIDs       sync.Mutex
+	numbers    map[string]int // torrent id -> transmission id
+	torrentIDs map[int]string // transmission id -> torrent id
+	nextNumber int
+}
+
+type transmissionRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       json.RawMessage `json:"tag,omitempty"`
+}
+
+type transmissionResponse struct {
+	Result    string          `json:"result"`
+	Arguments interface{}     `json:"arguments"`
+	Tag       json.RawMessage `json:"tag,omitempty"`
+}
+
+func newTransmissionHandler(ses *Session) *transmissionHandler {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return &transmissionHandler{
+		session:    ses,
+		sessionID:  base64.RawURLEncoding.EncodeToString(b),
+		log:        logger.New("transmission rpc"),
+		numbers:    make(map[string]int),
+		torrentIDs: make(map[int]string),
+		nextNumber: 1,
+	}
+}
+
+func (h *transmissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Clients must echo the session id given in the 409 response to protect against CSRF.
+	if r.Header.Get(transmissionSessionIDHeader) != h.sessionID {
+		w.Header().Set(transmissionSessionIDHeader, h.sessionID)
+		http.Error(w, "invalid session id", http.StatusConflict)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var req transmissionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := transmissionResponse{Result: "success", Tag: req.Tag}
+	resp.Arguments, err = h.handle(req.Method, req.Arguments)
+	if err != nil {
+		resp.Result = err.Error()
+	}
+	if resp.Arguments == nil {
+		resp.Arguments = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		h.log.Debugln("cannot write response:", err)
+	}
+}
+
+func (h *transmissionHandler) handle(method string, args json.RawMessage) (interface{}, error) {
+	switch method {
+	case "torrent-get":
+		return h.torrentGet(args)
+	case "torrent-add":
+		return h.torrentAdd(args)
+	case "torrent-start", "torrent-start-now":
+		return nil, h.forEach(args, (*Torrent).Start)
+	case "torrent-stop":
+		return nil, h.forEach(args, (*Torrent).Stop)
+	case "torrent-remove":
+		return nil, h.torrentRemove(args)
+	case "session-get":
+		return h.sessionGet(), nil
+	case "session-stats":
+		return h.sessionStats(), nil
+	default:
+		return nil, errTransmissionMethod
+	}
+}
+
+func (h *transmissionHandler) number(id string) int {
+	h.mIDs.Lock()
+	defer h.mIDs.Unlock()
+	n, ok := h.numbers[id]
+	if !ok {
+		n = h.nextNumber
+		h.nextNumber++
+		h.numbers[id] = n
+		h.torrentIDs[n] = id
+	}
+	return n
+}
+
+// torrents returns the torrents selected by "ids" argument.
+// ids may be missing, a single number, a list of numbers and info hashes, or "recently-active".
+func (h *transmissionHandler) torrents(ids json.RawMessage) ([]*Torrent, error) {
+	all := h.session.ListTorrents()
+	sort.Slice(all, func(i, j int) bool { return all[i].AddedAt().Before(all[j].AddedAt()) })
+	// Give numbers in the order of addition.
+	for _, t := range all {
+		h.number(t.ID())
+	}
+	if len(ids) == 0 || string(ids) == "null" {
+		return all, nil
+	}
+	var s string
+	if json.Unmarshal(ids, &s) == nil && s == "recently-active" {
+		return all, nil
+	}
+	var list []interface{}
+	var n float64
+	if json.Unmarshal(ids, &n) == nil {
+		list = []interface{}{n}
+	} else if err := json.Unmarshal(ids, &list); err != nil {
+		return nil, errors.New("invalid ids")
+	}
+	selected := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		switch v := v.(type) {
+		case float64:
+			h.mIDs.Lock()
+			id, ok := h.torrentIDs[int(v)]
+			h.mIDs.Unlock()
+			if ok {
+				selected[id] = struct{}{}
+			}
+		case string:
+			for _, t := range all {
+				if t.InfoHash().String() == v {
+					selected[t.ID()] = struct{}{}
+				}
+			}
+		default:
+			return nil, errors.New("invalid ids")
+		}
+	}
+	ret := make([]*Torrent, 0, len(selected))
+	for _, t := range all {
+		if _, ok := selected[t.ID()]; ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret, nil
+}
+
+func (h *transmissionHandler) forEach(args json.RawMessage, fn func(t *Torrent) error) error {
+	var req struct {
+		IDs json.RawMessage `json:"ids"`
+	}
+	if len(args) > 0 {
+		err := json.Unmarshal(args, &req)
+		if err != nil {
+			return err
+		}
+	}
+	torrents, err := h.torrents(req.IDs)
+	if err != nil {
+		return err
+	}
+	for _, t := range torrents {
+		err = fn(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *transmissionHandler) torrentGet(args json.RawMessage) (interface{}, error) {
+	var req struct {
+		IDs    json.RawMessage `json:"ids"`
+		Fields []string        `json:"fields"`
+	}
+	if len(args) > 0 {
+		err := json.Unmarshal(args, &req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	torrents, err := h.torrents(req.IDs)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]map[string]interface{}, 0, len(torrents))
+	for _, t := range torrents {
+		fields := h.torrentFields(t)
+		if len(req.Fields) > 0 {
+			selected := make(map[string]interface{}, len(req.Fields))
+			for _, f := range req.Fields {
+				if v, ok := fields[f]; ok {
+					selected[f] = v
+				}
+			}
+			fields = selected
+		}
+		ret = append(ret, fields)
+	}
+	return map[string]interface{}{"torrents": ret}, nil
+}
+
+func (h *transmissionHandler) torrentFields(t *Torrent) map[string]interface{} {
+	s := t.Stats()
+
+	status := transmissionStatusStopped
+	switch s.Status {
+	case Allocating, Verifying:
+		status = transmissionStatusCheck
+	case DownloadingMetadata, Downloading:
+		status = transmissionStatusDownload
+	case Seeding:
+		status = transmissionStatusSeed
+	}
+	errCode, errString := transmissionErrorNone, ""
+	if s.Error != nil {
+		errCode, errString = transmissionErrorLocal, s.Error.Error()
+	}
+	var percentDone, recheckProgress, uploadRatio float64
+	if s.Bytes.Total > 0 {
+		percentDone = float64(s.Bytes.Completed) / float64(s.Bytes.Total)
+	}
+	if s.Pieces.Total > 0 && s.Status == Verifying {
+		recheckProgress = float64(s.Pieces.Checked) / float64(s.Pieces.Total)
+	}
+	if s.Bytes.Downloaded > 0 {
+		uploadRatio = float64(s.Bytes.Uploaded) / float64(s.Bytes.Downloaded)
+	}
+	eta := transmissionETANotAvailable
+	if s.ETA != nil {
+		eta = int(s.ETA.Seconds())
+	}
+	metadataPercentComplete := 0.0
+	if s.Pieces.Total > 0 {
+		metadataPercentComplete = 1.0
+	}
+	trackers := make([]map[string]interface{}, 0)
+	for i, tr := range t.Trackers() {
+		trackers = append(trackers, map[string]interface{}{
+			"id":       i,
+			"announce": tr.URL,
+			"tier":     i,
+		})
+	}
+	var downloadDir string
+	if sto, ok := t.torrent.storage.(*filestorage.FileStorage); ok {
+		downloadDir = sto.Dest()
+	}
+	return map[string]interface{}{
+		"id":                      h.number(t.ID()),
+		"hashString":              t.InfoHash().String(),
+		"name":                    s.Name,
+		"status":                  status,
+		"error":                   errCode,
+		"errorString":             errString,
+		"percentDone":             percentDone,
+		"recheckProgress":         recheckProgress,
+		"metadataPercentComplete": metadataPercentComplete,
+		"totalSize":               s.Bytes.Total,
+		"sizeWhenDone":            s.Bytes.Total,
+		"leftUntilDone":           s.Bytes.Incomplete,
+		"haveValid":               s.Bytes.Completed,
+		"downloadedEver":          s.Bytes.Downloaded,
+		"uploadedEver":            s.Bytes.Uploaded,
+		"corruptEver":             s.Bytes.Wasted,
+		"uploadRatio":             uploadRatio,
+		"rateDownload":            s.Speed.Download,
+		"rateUpload":              s.Speed.Upload,
+		"eta":                     eta,
+		"addedDate":               t.AddedAt().Unix(),
+		"peersConnected":          s.Peers.Total,
+		"pieceCount":              s.Pieces.Total,
+		"pieceSize":               s.PieceLength,
+		"isPrivate":               s.Private,
+		"isFinished":              s.Status == Seeding,
+		"secondsSeeding":          int(s.SeededFor.Seconds()),
+		"queuePosition":           0,
+		"downloadDir":             downloadDir,
+		"trackers":                trackers,
+	}
+}
+
+func (h *transmissionHandler) torrentRemove(args json.RawMessage) error {
+	var req struct {
+		DeleteLocalData bool `json:"delete-local-data"`
+	}
+	if len(args) > 0 {
+		err := json.Unmarshal(args, &req)
+		if err != nil {
+			return err
+		}
+	}
+	remove := h.session.RemoveTorrentKeepData
+	if req.DeleteLocalData {
+		remove = h.session.RemoveTorrent
+	}
+	return h.forEach(args, func(t *Torrent) error { return remove(t.ID()) })
+}
+
+func (h *transmissionHandler) torrentAdd(args json.RawMessage) (interface{}, error) {
+	var req struct {
+		Filename string `json:"filename"`
+		Metainfo string `json:"metainfo"`
+		Paused   bool   `json:"paused"`
+	}
+	err := json.Unmarshal(args, &req)
+	if err != nil {
+		return nil, err
+	}
+	var t *Torrent
+	switch {
+	case req.Metainfo != "":
+		b, err2 := base64.StdEncoding.DecodeString(req.Metainfo)
+		if err2 != nil {
+			return nil, err2
+		}
+		t, err = h.session.AddTorrentWithOptions(bytes.NewReader(b), &AddTorrentOptions{Stopped: req.Paused})
+	case req.Filename != "":
+		t, err = h.session.AddURIWithOptions(req.Filename, &AddTorrentOptions{Stopped: req.Paused})
+	default:
+		return nil, errors.New("no filename or metainfo")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"torrent-added": map[string]interface{}{
+			"id":         h.number(t.ID()),
+			"name":       t.Name(),
+			"hashString": t.InfoHash().String(),
+		},
+	}, nil
+}
+
+func (h *transmissionHandler) sessionGet() interface{} {
+	cfg := h.session.getConfig()
+	return map[string]interface{}{
+		"version":                    "Rain " + Version,
+		"rpc-version":                transmissionRPCVersion,
+		"rpc-version-minimum":        transmissionRPCVersionMinimum,
+		"session-id":                 h.sessionID,
+		"download-dir":               cfg.DataDir,
+		"peer-port":                  cfg.PortBegin,
+		"dht-enabled":                cfg.DHTEnabled,
+		"pex-enabled":                cfg.PEXEnabled,
+		"blocklist-enabled":          cfg.BlocklistURL != "",
+		"blocklist-url":              cfg.BlocklistURL,
+		"speed-limit-down-enabled":   false,
+		"speed-limit-up-enabled":     false,
+		"alt-speed-enabled":          false,
+		"seedRatioLimited":           false,
+		"seedRatioLimit":             0,
+		"idle-seeding-limit-enabled": false,
+		"idle-seeding-limit":         0,
+		"start-added-torrents":       true,
+	}
+}
+
+func (h *transmissionHandler) sessionStats() interface{} {
+	var active, paused int
+	var downloadSpeed, uploadSpeed uint
+	var downloaded, uploaded int64
+	torrents := h.session.ListTorrents()
+	for _, t := range torrents {
+		s := t.Stats()
+		if s.Status == Stopped {
+			paused++
+		} else {
+			active++
+		}
+		downloadSpeed += s.Speed.Download
+		uploadSpeed += s.Speed.Upload
+		downloaded += s.Bytes.Downloaded
+		uploaded += s.Bytes.Uploaded
+	}
+	stats := map[string]interface{}{
+		"uploadedBytes":   uploaded,
+		"downloadedBytes": downloaded,
+		"filesAdded":      len(torrents),
+		"sessionCount":    1,
+		"secondsActive":   int(h.session.Stats().Uptime.Seconds()),
+	}
+	return map[string]interface{}{
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"torrentCount":       len(torrents),
+		"downloadSpeed":      downloadSpeed,
+		"uploadSpeed":        uploadSpeed,
+		"cumulative-stats":   stats,
+		"current-stats":      stats,
+	}
+}
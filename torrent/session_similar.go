@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"github.com/ProtocolONE/rain/internal/existingdata"
+	"github.com/ProtocolONE/rain/internal/metainfo"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+)
+
+// copySimilarTorrents links the files that are identical in the local torrents that are similar to this torrent (BEP 38) into the storage.
+// A torrent is similar if its info hash is in the "similar" list of info or it shares one of the collections.
+// Collections of both torrents include the ones outside of the info dictionary.
+// See existingdata.Link for why writes to the data of one torrent never change the other.
+// Reusing files is optional, so errors are only logged.
+// It is called before allocation, from the goroutine of the allocator.
+func (t *torrent) copySimilarTorrents(info *metainfo.Info, collections []string, cancel <-chan struct{}) {
+	fs, ok := t.storage.(*filestorage.FileStorage)
+	if !ok {
+		return
+	}
+	// Torrents added from magnet links have only the collections in their info dictionary.
+	if len(collections) == 0 {
+		collections = info.Collections
+	}
+	if len(info.Similar) == 0 && len(collections) == 0 {
+		return
+	}
+	similar := make(map[InfoHash]struct{}, len(info.Similar))
+	for _, b := range info.Similar {
+		var ih InfoHash
+		copy(ih[:], b)
+		similar[ih] = struct{}{}
+	}
+	collectionSet := make(map[string]struct{}, len(collections))
+	for _, c := range collections {
+		collectionSet[c] = struct{}{}
+	}
+	var copied int
+	for _, other := range t.session.ListTorrents() {
+		spec, otherInfo, bf, err := t.session.readDownloadedData(other.ID())
+		if err != nil {
+			t.log.Errorf("cannot read data of torrent %s: %s", other.ID(), err)
+			continue
+		}
+		if otherInfo == nil || otherInfo.Hash == info.Hash {
+			continue
+		}
+		_, ok := similar[otherInfo.Hash]
+		otherCollections := spec.Collections
+		if len(otherCollections) == 0 {
+			otherCollections = otherInfo.Collections
+		}
+		for _, c := range otherCollections {
+			if _, ok2 := collectionSet[c]; ok2 {
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+		matches := existingdata.FindInTorrent(info, otherInfo, bf.Test, spec.Dest)
+		err = existingdata.Link(matches, fs.Dest(), cancel)
+		if err == existingdata.ErrCancelled {
+			return
+		}
+		if err != nil {
+			t.log.Errorf("cannot link files of torrent %s: %s", other.ID(), err)
+			continue
+		}
+		copied += len(matches)
+	}
+	if copied > 0 {
+		t.log.Infof("reusing %d of %d files from similar torrents", copied, len(info.GetFiles()))
+	}
+}
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"sort"
 	"strconv"
 	"time"
 
@@ -17,15 +18,29 @@ type SessionStats struct {
 	PieceCacheItems               int
 	PieceCacheSize                int64
 	PieceCacheUtilization         int
+	PieceCacheTorrents            []PieceCacheTorrentStats
 	ReadsPerSecond                int
 	ReadsActive                   int
 	ReadsPending                  int
 	ReadBytesPerSecond            int
+	PrefetchesPerSecond           int
+	WriteCacheFiles               int
+	WriteCacheSize                int64
+	WriteCacheUtilization         int
+	WritesPerSecond               int
+	WriteBytesPerSecond           int
 	ActivePieceBytes              int64
 	TorrentsPendingRAM            int
 	Uptime                        time.Duration
 }
 
+// PieceCacheTorrentStats contains the number and size of cached piece regions that belong to a torrent.
+type PieceCacheTorrentStats struct {
+	ID    string
+	Items int
+	Size  int64
+}
+
 func (s *Session) Stats() SessionStats {
 	s.mTorrents.RLock()
 	torrents := len(s.torrents)
@@ -41,7 +56,14 @@ func (s *Session) Stats() SessionStats {
 
 	ramStats := s.ram.Stats()
 
-	return SessionStats{
+	groups := s.pieceCache.Groups()
+	cacheTorrents := make([]PieceCacheTorrentStats, 0, len(groups))
+	for id, g := range groups {
+		cacheTorrents = append(cacheTorrents, PieceCacheTorrentStats{ID: id, Items: g.Items, Size: g.Size})
+	}
+	sort.Slice(cacheTorrents, func(i, j int) bool { return cacheTorrents[i].Size > cacheTorrents[j].Size })
+
+	stats := SessionStats{
 		Torrents:                      torrents,
 		AvailablePorts:                ports,
 		BlockListRules:                s.blocklist.Len(),
@@ -49,14 +71,24 @@ func (s *Session) Stats() SessionStats {
 		PieceCacheItems:               s.pieceCache.Len(),
 		PieceCacheSize:                s.pieceCache.Size(),
 		PieceCacheUtilization:         s.pieceCache.Utilization(),
+		PieceCacheTorrents:            cacheTorrents,
 		ReadsPerSecond:                s.pieceCache.LoadsPerSecond(),
 		ReadsActive:                   s.pieceCache.LoadsActive(),
 		ReadsPending:                  s.pieceCache.LoadsWaiting(),
 		ReadBytesPerSecond:            s.pieceCache.LoadedBytesPerSecond(),
+		PrefetchesPerSecond:           s.pieceCache.PrefetchesPerSecond(),
 		ActivePieceBytes:              ramStats.Used,
 		TorrentsPendingRAM:            ramStats.Count,
 		Uptime:                        time.Since(s.createdAt),
 	}
+	if s.writeCache != nil {
+		stats.WriteCacheFiles = s.writeCache.Len()
+		stats.WriteCacheSize = s.writeCache.Size()
+		stats.WriteCacheUtilization = s.writeCache.Utilization()
+		stats.WritesPerSecond = s.writeCache.FlushesPerSecond()
+		stats.WriteBytesPerSecond = s.writeCache.FlushedBytesPerSecond()
+	}
+	return stats
 }
 
 func (s *Session) updateStatsLoop() {
@@ -73,27 +105,54 @@ func (s *Session) updateStatsLoop() {
 }
 
 func (s *Session) updateStats() {
+	// Take a copy of bitfields before flushing the write cache.
+	// Pieces in the copy are written to the cache already, so they are on disk after the flush.
+	// Lock is released before flushing, so adding and removing torrents are not blocked by disk IO.
+	var cacheErrors int
+	if s.writeCache != nil {
+		cacheErrors = s.writeCache.Errors()
+	}
 	s.mTorrents.RLock()
-	defer s.mTorrents.RUnlock()
+	torrents := make([]*torrent, 0, len(s.torrents))
+	bitfields := make(map[string][]byte, len(s.torrents))
+	for id, t := range s.torrents {
+		torrents = append(torrents, t.torrent)
+		t.torrent.mBitfield.RLock()
+		if t.torrent.bitfield != nil {
+			bitfields[id] = append([]byte(nil), t.torrent.bitfield.Bytes()...)
+		}
+		t.torrent.mBitfield.RUnlock()
+	}
+	s.mTorrents.RUnlock()
+
+	if s.writeCache != nil {
+		if err := s.writeCache.Flush(); err != nil {
+			s.log.Errorln("cannot write cached data to disk:", err.Error())
+			bitfields = nil
+		} else if s.writeCache.Errors() != cacheErrors {
+			// Data of a file that is closed after taking the copy may be lost.
+			bitfields = nil
+		}
+	}
+
 	err := s.db.Update(func(tx *bolt.Tx) error {
 		mb := tx.Bucket(torrentsBucket)
-		for _, t := range s.torrents {
-			b := mb.Bucket([]byte(t.torrent.id))
-			_ = b.Put(boltdbresumer.Keys.BytesDownloaded, []byte(strconv.FormatInt(t.torrent.counters.Read(counters.BytesDownloaded), 10)))
-			_ = b.Put(boltdbresumer.Keys.BytesUploaded, []byte(strconv.FormatInt(t.torrent.counters.Read(counters.BytesUploaded), 10)))
-			_ = b.Put(boltdbresumer.Keys.BytesWasted, []byte(strconv.FormatInt(t.torrent.counters.Read(counters.BytesWasted), 10)))
-			_ = b.Put(boltdbresumer.Keys.SeededFor, []byte(time.Duration(t.torrent.counters.Read(counters.SeededFor)).String()))
-
-			t.torrent.mBitfield.RLock()
-			if t.torrent.bitfield != nil {
-				_ = b.Put(boltdbresumer.Keys.Bitfield, t.torrent.bitfield.Bytes())
+		for _, t := range torrents {
+			b := mb.Bucket([]byte(t.id))
+			if b == nil {
+				// Torrent is removed after taking the copy.
+				continue
+			}
+			_ = b.Put(boltdbresumer.Keys.BytesDownloaded, []byte(strconv.FormatInt(t.counters.Read(counters.BytesDownloaded), 10)))
+			_ = b.Put(boltdbresumer.Keys.BytesUploaded, []byte(strconv.FormatInt(t.counters.Read(counters.BytesUploaded), 10)))
+			_ = b.Put(boltdbresumer.Keys.BytesWasted, []byte(strconv.FormatInt(t.counters.Read(counters.BytesWasted), 10)))
+			_ = b.Put(boltdbresumer.Keys.SeededFor, []byte(time.Duration(t.counters.Read(counters.SeededFor)).String()))
+			if bf, ok := bitfields[t.id]; ok {
+				_ = b.Put(boltdbresumer.Keys.Bitfield, bf)
 			}
 		}
 		return nil
 	})
-	for _, t := range s.torrents {
-		t.torrent.mBitfield.RUnlock()
-	}
 	if err != nil {
 		s.log.Errorln("cannot update stats:", err.Error())
 	}
@@ -2,6 +2,7 @@ package torrent
 
 import (
 	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -53,6 +54,17 @@ func (t *Torrent) Webseeds() []Webseed {
 	return t.torrent.Webseeds()
 }
 
+// Files returns the files of torrent with their progress.
+// Returns nil if the metadata of the torrent is not downloaded yet.
+func (t *Torrent) Files() []File {
+	return t.torrent.Files()
+}
+
+// PieceMap returns the state of each piece in torrent.
+func (t *Torrent) PieceMap() PieceMap {
+	return t.torrent.PieceMap()
+}
+
 func (t *Torrent) Port() int {
 	return t.torrent.port
 }
@@ -93,3 +105,49 @@ func (t *Torrent) Stop() error {
 	t.torrent.Stop()
 	return nil
 }
+
+// Labels returns the labels of the torrent.
+func (t *Torrent) Labels() []string {
+	t.torrent.mLabels.Lock()
+	defer t.torrent.mLabels.Unlock()
+	return append([]string(nil), t.torrent.labels...)
+}
+
+// SetLabels replaces the labels of the torrent.
+func (t *Torrent) SetLabels(labels []string) error {
+	t.torrent.mLabels.Lock()
+	defer t.torrent.mLabels.Unlock()
+	err := t.torrent.session.resumer.WriteLabels(t.torrent.id, labels)
+	if err != nil {
+		return err
+	}
+	t.torrent.labels = append([]string(nil), labels...)
+	return nil
+}
+
+// SpeedLimits returns the download and upload speed limits of the torrent in bytes per second.
+// Zero means unlimited.
+func (t *Torrent) SpeedLimits() (download, upload int64) {
+	return t.torrent.downloadLimiter.Limit(), t.torrent.uploadLimiter.Limit()
+}
+
+// SetSpeedLimits changes the download and upload speed limits of the torrent in bytes per second.
+// Zero means unlimited. Limits are applied to connected peers immediately.
+func (t *Torrent) SetSpeedLimits(download, upload int64) error {
+	if download < 0 || upload < 0 {
+		return errors.New("speed limit must not be negative")
+	}
+	err := t.torrent.session.resumer.WriteSpeedLimits(t.torrent.id, download, upload)
+	if err != nil {
+		return err
+	}
+	t.torrent.downloadLimiter.SetLimit(download)
+	t.torrent.uploadLimiter.SetLimit(upload)
+	return nil
+}
+
+// Verify checks the hashes of all pieces on disk and updates the bitfield of the torrent.
+// Transfers are stopped during verification. Torrent returns to its previous state after verification is done.
+func (t *Torrent) Verify() (VerifyResult, error) {
+	return t.torrent.Verify()
+}
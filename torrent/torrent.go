@@ -28,12 +28,15 @@ import (
 	"github.com/ProtocolONE/rain/internal/piecepicker"
 	"github.com/ProtocolONE/rain/internal/piecewriter"
 	"github.com/ProtocolONE/rain/internal/resumer"
+	"github.com/ProtocolONE/rain/internal/smartban"
+	"github.com/ProtocolONE/rain/internal/speedlimit"
 	"github.com/ProtocolONE/rain/internal/storage"
 	"github.com/ProtocolONE/rain/internal/suspendchan"
 	"github.com/ProtocolONE/rain/internal/tracker"
 	"github.com/ProtocolONE/rain/internal/unchoker"
 	"github.com/ProtocolONE/rain/internal/verifier"
 	"github.com/ProtocolONE/rain/internal/webseedsource"
+	"github.com/ProtocolONE/rain/internal/writecache"
 	"github.com/rcrowley/go-metrics"
 )
 
@@ -78,6 +81,9 @@ type torrent struct {
 
 	piecePicker *piecepicker.PiecePicker
 
+	// Keeps blocks of pieces that failed hash check to find out who sent the corrupt data.
+	smartBan *smartban.SmartBan
+
 	// Peers are sent to this channel when they are disconnected.
 	peerDisconnectedC chan *peer.Peer
 
@@ -98,9 +104,17 @@ type torrent struct {
 	unchoker *unchoker.Unchoker
 
 	// Active piece downloads are kept in this map.
-	pieceDownloaders        map[*peer.Peer]*piecedownloader.PieceDownloader
-	pieceDownloadersSnubbed map[*peer.Peer]*piecedownloader.PieceDownloader
-	pieceDownloadersChoked  map[*peer.Peer]*piecedownloader.PieceDownloader
+	// A peer may have multiple downloads, kept in the order they are started.
+	pieceDownloaders        map[*peer.Peer][]*piecedownloader.PieceDownloader
+	pieceDownloadersSnubbed map[*piecedownloader.PieceDownloader]struct{}
+	pieceDownloadersChoked  map[*piecedownloader.PieceDownloader]struct{}
+
+	// Peers that support the extensions registered with Session.RegisterExtension, keyed by our extension ID.
+	extensionPeers map[*peer.Peer]map[uint8]*ExtensionPeer
+
+	// Peers that sent the addresses in PEX messages, keyed by address.
+	// Used as relays for ut_holepunch when dialing the address fails.
+	pexSources map[string]*peer.Peer
 
 	// When a peer has snubbed us, a message sent to this channel.
 	peerSnubbedC chan *peer.Peer
@@ -111,12 +125,22 @@ type torrent struct {
 
 	pieceWriterResultC chan *piecewriter.PieceWriter
 
+	// Files in write cache report here when their dirty data cannot be written to disk.
+	cacheWriteErrorC chan cacheWriteError
+	// Files of the last allocation that are wrapped by write cache.
+	// They are kept after the torrent is stopped, because closing them may fail too.
+	cacheFiles map[*writecache.File]struct{}
+
 	// This channel is closed once all pieces are downloaded and verified.
 	completeC chan struct{}
 
 	// True after all pieces are download, verified and written to disk.
 	completed bool
 
+	// True if all pieces were downloaded before this run, including the state loaded from resume db.
+	// It is used for publishing EventCompleted only when the torrent becomes complete.
+	wasCompleted bool
+
 	// If any unrecoverable error occurs, it will be sent to this channel and download will be stopped.
 	errC chan error
 
@@ -137,12 +161,17 @@ type torrent struct {
 	trackersCommandC     chan trackersRequest     // Trackers()
 	peersCommandC        chan peersRequest        // Peers()
 	webseedsCommandC     chan webseedsRequest     // Webseeds()
+	filesCommandC        chan filesRequest        // Files()
+	pieceMapCommandC     chan pieceMapRequest     // PieceMap()
 	startCommandC        chan struct{}            // Start()
 	stopCommandC         chan struct{}            // Stop()
 	notifyErrorCommandC  chan notifyErrorCommand  // NotifyError()
 	notifyListenCommandC chan notifyListenCommand // NotifyListen()
 	addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
 	addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	verifyCommandC       chan verifyRequest       // Verify()
+	configCommandC       chan Config              // setConfig()
+	disconnectIPCommandC chan net.IP              // disconnectIP()
 
 	// Trackers send announce responses to this channel.
 	addrsFromTrackers chan []*net.TCPAddr
@@ -199,15 +228,41 @@ type torrent struct {
 	verifierResultC   chan *verifier.Verifier
 	checkedPieces     uint32
 
+	// Holds the state before the verification that is started by Verify() command.
+	// It is nil if there is no pending Verify() command.
+	verifyCmd *verifyCommand
+
 	counters              counters.Counters
 	seedDurationUpdatedAt time.Time
 	seedDurationTicker    *time.Ticker
 
+	// ID of the torrent that is the previous version of this mutable torrent (BEP 46).
+	// Identical files are linked from its storage and it is removed when this torrent is completed.
+	replaces string
+
+	// Directory to search for the files of the torrent that are already downloaded, given in AddTorrentOptions.
+	// Matched files are linked into the storage before the first allocation. It is not saved to resume database.
+	existingDataDir string
+
+	// Collections of the torrent (BEP 38), including the ones outside of the info dictionary.
+	// Used for finding similar torrents.
+	collections []string
+
+	// Labels set by the user for selecting torrents.
+	mLabels sync.Mutex
+	labels  []string
+
+	// Limit the speed of all peer connections of the torrent.
+	downloadLimiter *speedlimit.Limiter
+	uploadLimiter   *speedlimit.Limiter
+
 	// Holds connected peer IPs so we don't dial/accept multiple connections to/from same IP.
 	connectedPeerIPs map[string]struct{}
 
-	// Peers that are sending corrupt data are banned.
-	bannedPeerIPs map[string]struct{}
+	// IPs of peers that are being dialed after a ut_holepunch connect message.
+	// The peer is dialing us at the same time, so an incoming connection from the IP is accepted while dialing.
+	// Value is true if the incoming connection is accepted.
+	holepunchIPs map[string]bool
 
 	// A signal sent to run() loop when announcers are stopped.
 	announcersStoppedC chan struct{}
@@ -232,6 +287,9 @@ type torrent struct {
 	webseedPieceResultC *suspendchan.Chan
 	webseedRetryC       chan *webseedsource.WebseedSource
 
+	// Copy of session config. Updated by run() loop when session config is changed.
+	config Config
+
 	log logger.Logger
 }
 
@@ -252,11 +310,12 @@ func newTorrent2(
 	if len(infoHash) != 20 {
 		return nil, errors.New("invalid infoHash (must be 20 bytes)")
 	}
-	cfg := s.config
+	cfg := s.getConfig()
 	var ih [20]byte
 	copy(ih[:], infoHash)
 	t := &torrent{
 		session:                   s,
+		config:                    cfg,
 		id:                        id,
 		addedAt:                   addedAt,
 		infoHash:                  ih,
@@ -267,6 +326,9 @@ func newTorrent2(
 		port:                      port,
 		info:                      info,
 		bitfield:                  bf,
+		wasCompleted:              bf != nil && bf.All(),
+		downloadLimiter:           speedlimit.New(0),
+		uploadLimiter:             speedlimit.New(0),
 		log:                       logger.New("torrent " + id),
 		peerDisconnectedC:         make(chan *peer.Peer),
 		messages:                  make(chan peer.Message),
@@ -274,13 +336,16 @@ func newTorrent2(
 		peers:                     make(map[*peer.Peer]struct{}),
 		incomingPeers:             make(map[*peer.Peer]struct{}),
 		outgoingPeers:             make(map[*peer.Peer]struct{}),
-		pieceDownloaders:          make(map[*peer.Peer]*piecedownloader.PieceDownloader),
-		pieceDownloadersSnubbed:   make(map[*peer.Peer]*piecedownloader.PieceDownloader),
-		pieceDownloadersChoked:    make(map[*peer.Peer]*piecedownloader.PieceDownloader),
+		pieceDownloaders:          make(map[*peer.Peer][]*piecedownloader.PieceDownloader),
+		pieceDownloadersSnubbed:   make(map[*piecedownloader.PieceDownloader]struct{}),
+		pieceDownloadersChoked:    make(map[*piecedownloader.PieceDownloader]struct{}),
+		extensionPeers:            make(map[*peer.Peer]map[uint8]*ExtensionPeer),
+		pexSources:                make(map[string]*peer.Peer),
 		peerSnubbedC:              make(chan *peer.Peer),
 		infoDownloaders:           make(map[*peer.Peer]*infodownloader.InfoDownloader),
 		infoDownloadersSnubbed:    make(map[*peer.Peer]*infodownloader.InfoDownloader),
 		pieceWriterResultC:        make(chan *piecewriter.PieceWriter),
+		smartBan:                  smartban.New(),
 		completeC:                 make(chan struct{}),
 		closeC:                    make(chan chan struct{}),
 		startCommandC:             make(chan struct{}),
@@ -289,10 +354,15 @@ func newTorrent2(
 		trackersCommandC:          make(chan trackersRequest),
 		peersCommandC:             make(chan peersRequest),
 		webseedsCommandC:          make(chan webseedsRequest),
+		filesCommandC:             make(chan filesRequest),
+		pieceMapCommandC:          make(chan pieceMapRequest),
 		notifyErrorCommandC:       make(chan notifyErrorCommand),
 		notifyListenCommandC:      make(chan notifyListenCommand),
 		addPeersCommandC:          make(chan []*net.TCPAddr),
 		addTrackersCommandC:       make(chan []tracker.Tracker),
+		verifyCommandC:            make(chan verifyRequest),
+		configCommandC:            make(chan Config),
+		disconnectIPCommandC:      make(chan net.IP),
 		addrsFromTrackers:         make(chan []*net.TCPAddr),
 		peerIDs:                   make(map[[20]byte]struct{}),
 		incomingConnC:             make(chan net.Conn),
@@ -307,7 +377,7 @@ func newTorrent2(
 		verifierProgressC:         make(chan verifier.Progress),
 		verifierResultC:           make(chan *verifier.Verifier),
 		connectedPeerIPs:          make(map[string]struct{}),
-		bannedPeerIPs:             make(map[string]struct{}),
+		holepunchIPs:              make(map[string]bool),
 		announcersStoppedC:        make(chan struct{}),
 		dhtPeersC:                 make(chan []*net.TCPAddr, 1),
 		counters:                  counters.New(stats.BytesDownloaded, stats.BytesUploaded, stats.BytesWasted, stats.SeededFor),
@@ -315,11 +385,12 @@ func newTorrent2(
 		downloadSpeed:             metrics.NewEWMA1(),
 		uploadSpeed:               metrics.NewEWMA1(),
 		ramNotifyC:                make(chan interface{}),
+		cacheWriteErrorC:          make(chan cacheWriteError, 1),
 		webseedPieceResultC:       suspendchan.New(0),
 		webseedRetryC:             make(chan *webseedsource.WebseedSource),
 		doneC:                     make(chan struct{}),
 	}
-	t.addrList = addrlist.New(cfg.MaxPeerAddresses, s.blocklist, port, &t.externalIP)
+	t.addrList = addrlist.New(cfg.MaxPeerAddresses, s.blocklist, s.bans, port, &t.externalIP)
 	if t.info != nil {
 		t.piecePool = bufferpool.New(int(t.info.PieceLength))
 	}
@@ -335,7 +406,7 @@ func newTorrent2(
 
 func (t *torrent) copyPeerIDPrefix() int {
 	if t.info.IsPrivate() {
-		return copy(t.peerID[:], []byte(t.session.config.PrivatePeerIDPrefix))
+		return copy(t.peerID[:], []byte(t.config.PrivatePeerIDPrefix))
 	}
 	return copy(t.peerID[:], []byte(publicPeerIDPrefix))
 }
@@ -5,8 +5,12 @@ import (
 
 	"github.com/ProtocolONE/rain/internal/allocator"
 	"github.com/ProtocolONE/rain/internal/bitfield"
+	"github.com/ProtocolONE/rain/internal/existingdata"
+	"github.com/ProtocolONE/rain/internal/metainfo"
 	"github.com/ProtocolONE/rain/internal/piece"
 	"github.com/ProtocolONE/rain/internal/piecepicker"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+	"github.com/ProtocolONE/rain/internal/writecache"
 )
 
 func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
@@ -14,6 +18,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		panic("invalid allocator")
 	}
 	t.allocator = nil
+	t.existingDataDir = ""
 
 	if al.Error != nil {
 		t.stop(fmt.Errorf("file allocation error: %s", al.Error))
@@ -24,6 +29,12 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		panic("files exist")
 	}
 	t.files = al.Files
+	if t.session.writeCache != nil {
+		t.cacheFiles = make(map[*writecache.File]struct{}, len(t.files))
+		for i := range t.files {
+			t.files[i].Storage = t.wrapWriteCache(t.files[i].Storage)
+		}
+	}
 
 	if t.pieces != nil {
 		panic("pieces exists")
@@ -33,10 +44,12 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	if t.piecePicker != nil {
 		panic("piece picker exists")
 	}
-	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.piecePicker = piecepicker.New(t.pieces, t.config.EndgameMaxDuplicateDownloads, t.webseedSources)
 
 	for pe := range t.peers {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
+		// Peers connected before the info is downloaded
+		t.sendAllowedFast(pe)
 	}
 
 	// If we already have bitfield from resume db, skip verification and start downloading.
@@ -54,7 +67,8 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	}
 
 	// No need to verify files if they didn't exist when we create them.
-	if !al.NeedHashCheck {
+	// Verification is always done if requested explicitly with Verify().
+	if !al.NeedHashCheck && t.verifyCmd == nil {
 		t.mBitfield.Lock()
 		t.bitfield = bitfield.New(t.info.NumPieces)
 		t.mBitfield.Unlock()
@@ -69,3 +83,21 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	// Some files exists on the disk, need to verify pieces to create a correct bitfield.
 	t.startVerifier()
 }
+
+// adoptExistingData finds the files of the torrent in dir and links them into the storage of the torrent.
+// Found files are verified after allocation. Reusing files is optional, so errors are only logged.
+// It is called before allocation, from the goroutine of the allocator.
+func (t *torrent) adoptExistingData(info *metainfo.Info, dir string, cancel <-chan struct{}) {
+	fs, ok := t.storage.(*filestorage.FileStorage)
+	if !ok {
+		return
+	}
+	matches, err := existingdata.Find(info, dir, cancel)
+	if err == nil {
+		t.log.Infof("found %d of %d files in %s", len(matches), len(info.GetFiles()), dir)
+		err = existingdata.Link(matches, fs.Dest(), cancel)
+	}
+	if err != nil && err != existingdata.ErrCancelled {
+		t.log.Errorf("cannot reuse existing files in %s: %s", dir, err)
+	}
+}
@@ -23,12 +23,14 @@ func (t *torrent) close() {
 
 func (t *torrent) closePeer(pe *peer.Peer) {
 	pe.Close()
-	if pd, ok := t.pieceDownloaders[pe]; ok {
+	for _, pd := range t.pieceDownloaders[pe] {
 		t.closePieceDownloader(pd)
 	}
 	if id, ok := t.infoDownloaders[pe]; ok {
 		t.closeInfoDownloader(id)
 	}
+	t.closeExtensionPeers(pe)
+	t.removePEXSource(pe)
 	delete(t.peers, pe)
 	delete(t.incomingPeers, pe)
 	delete(t.outgoingPeers, pe)
@@ -48,17 +50,26 @@ func (t *torrent) closeWebseedDownloader(src *webseedsource.WebseedSource) {
 
 func (t *torrent) closePieceDownloader(pd *piecedownloader.PieceDownloader) {
 	pe := pd.Peer.(*peer.Peer)
-	_, open := t.pieceDownloaders[pe]
-	if !open {
+	pds := t.pieceDownloaders[pe]
+	i := indexOfPieceDownloader(pds, pd)
+	if i < 0 {
 		return
 	}
-	delete(t.pieceDownloaders, pe)
-	delete(t.pieceDownloadersSnubbed, pe)
-	delete(t.pieceDownloadersChoked, pe)
+	// Copy remaining downloaders to a new slice because callers may be iterating over the old one.
+	remaining := make([]*piecedownloader.PieceDownloader, 0, len(pds)-1)
+	remaining = append(remaining, pds[:i]...)
+	remaining = append(remaining, pds[i+1:]...)
+	if len(remaining) == 0 {
+		delete(t.pieceDownloaders, pe)
+		pe.Downloading = false
+	} else {
+		t.pieceDownloaders[pe] = remaining
+	}
+	delete(t.pieceDownloadersSnubbed, pd)
+	delete(t.pieceDownloadersChoked, pd)
 	if t.piecePicker != nil {
 		t.piecePicker.HandleCancelDownload(pe, pd.Piece.Index)
 	}
-	pe.Downloading = false
 	if t.session.ram != nil {
 		t.session.ram.Release(int64(t.info.PieceLength))
 	}
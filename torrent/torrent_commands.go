@@ -104,6 +104,43 @@ func (t *torrent) AddTrackers(trackers []tracker.Tracker) {
 	}
 }
 
+// VerifyResult contains the changes in the bitfield of the torrent after a forced verification.
+type VerifyResult struct {
+	// Number of pieces that have passed hash check.
+	Have uint32
+	// Indexes of pieces that were missing before and have passed hash check.
+	Found []uint32
+	// Indexes of pieces that were completed before and have failed hash check.
+	Lost []uint32
+}
+
+type verifyRequest struct {
+	Response chan verifyResponse
+}
+
+type verifyResponse struct {
+	Result VerifyResult
+	Error  error
+}
+
+// Verify stops transfers and checks the hashes of all pieces in files on disk.
+// The bitfield is replaced with the result of the check and the torrent returns to its previous state.
+// Verify blocks until the verification is done.
+func (t *torrent) Verify() (VerifyResult, error) {
+	req := verifyRequest{Response: make(chan verifyResponse, 1)}
+	select {
+	case t.verifyCommandC <- req:
+	case <-t.closeC:
+		return VerifyResult{}, errClosed
+	}
+	select {
+	case resp := <-req.Response:
+		return resp.Result, resp.Error
+	case <-t.closeC:
+		return VerifyResult{}, errClosed
+	}
+}
+
 type TrackerStatus int
 
 const (
@@ -166,6 +203,12 @@ type Peer struct {
 	EncryptedStream    bool
 	DownloadSpeed      uint
 	UploadSpeed        uint
+	// Number of blocks that are allowed to be requested from the peer at the same time.
+	RequestQueue int
+	// Number of blocks that are requested from the peer but not received yet.
+	PendingRequests int
+	// Estimated round-trip time of block requests.
+	RTT time.Duration
 }
 
 type PeerSource int
@@ -176,6 +219,7 @@ const (
 	SourcePEX
 	SourceIncoming
 	SourceManual
+	SourceHolepunch
 )
 
 type peersRequest struct {
@@ -219,3 +263,57 @@ func (t *torrent) Webseeds() []Webseed {
 	}
 	return webseeds
 }
+
+// File in torrent and the number of its bytes that are downloaded.
+type File struct {
+	Path      string
+	Length    int64
+	Completed int64
+}
+
+type filesRequest struct {
+	Response chan []File
+}
+
+// Files returns nil if the metadata of the torrent is not downloaded yet.
+func (t *torrent) Files() []File {
+	var files []File
+	req := filesRequest{Response: make(chan []File, 1)}
+	select {
+	case t.filesCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case files = <-req.Response:
+	case <-t.closeC:
+	}
+	return files
+}
+
+// PieceMap contains the state of each piece in torrent.
+type PieceMap struct {
+	// Bitfield of pieces that are downloaded and passed hash check.
+	// Highest bit of first byte is the first piece.
+	Have []byte
+	// Number of connected peers that have each piece.
+	Availability []int
+}
+
+type pieceMapRequest struct {
+	Response chan PieceMap
+}
+
+// PieceMap returns empty PieceMap if the metadata of the torrent is not downloaded yet.
+func (t *torrent) PieceMap() PieceMap {
+	var pm PieceMap
+	req := pieceMapRequest{Response: make(chan PieceMap, 1)}
+	select {
+	case t.pieceMapCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case pm = <-req.Response:
+	case <-t.closeC:
+	}
+	return pm
+}
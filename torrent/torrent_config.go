@@ -0,0 +1,32 @@
+package torrent
+
+// setConfig sends new session config to run() loop.
+func (t *torrent) setConfig(cfg Config) {
+	select {
+	case t.configCommandC <- cfg:
+	case <-t.closeC:
+	}
+}
+
+func (t *torrent) handleConfigChange(cfg Config) {
+	t.config = cfg
+	t.unchoker.SetLimits(cfg.UnchokedPeers, cfg.OptimisticUnchokedPeers)
+	t.addrList.SetMaxItems(cfg.MaxPeerAddresses)
+	if t.piecePicker != nil {
+		t.piecePicker.SetMaxDuplicateDownload(cfg.EndgameMaxDuplicateDownloads)
+	}
+	for _, an := range t.announcers {
+		an.SetConfig(cfg.TrackerNumWant, cfg.TrackerMinAnnounceInterval)
+	}
+	if t.dhtAnnouncer != nil {
+		t.dhtAnnouncer.SetIntervals(cfg.DHTAnnounceInterval, cfg.DHTMinAnnounceInterval)
+	}
+	// Make use of increased limits without waiting for next event.
+	switch t.status() {
+	case DownloadingMetadata:
+		t.startInfoDownloaders()
+		t.dialAddresses()
+	case Downloading:
+		t.dialAddresses()
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func (t *torrent) handleNewConnection(conn net.Conn) {
-	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
+	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.config.MaxPeerAccept {
 		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
 		conn.Close()
 		return
@@ -20,14 +20,12 @@ func (t *torrent) handleNewConnection(conn net.Conn) {
 		return
 	}
 	if _, ok := t.connectedPeerIPs[ipstr]; ok {
-		t.log.Debugln("received duplicate connection from same IP: ", ipstr)
-		conn.Close()
-		return
-	}
-	if _, ok := t.bannedPeerIPs[ipstr]; ok {
-		t.log.Debugln("connection attempt from banned IP: ", ipstr)
-		conn.Close()
-		return
+		if accepted, ok := t.holepunchIPs[ipstr]; !ok || accepted {
+			t.log.Debugln("received duplicate connection from same IP: ", ipstr)
+			conn.Close()
+			return
+		}
+		t.holepunchIPs[ipstr] = true
 	}
 	h := incominghandshaker.New(conn)
 	t.incomingHandshakers[h] = struct{}{}
@@ -36,9 +34,27 @@ func (t *torrent) handleNewConnection(conn net.Conn) {
 		t.peerID,
 		t.getSKey,
 		t.checkInfoHash,
+		t.session.bans.Banned,
 		t.incomingHandshakerResultC,
-		t.session.config.PeerHandshakeTimeout,
+		t.config.PeerHandshakeTimeout,
 		t.session.extensions,
-		t.session.config.ForceIncomingEncryption,
+		t.config.ForceIncomingEncryption,
 	)
 }
+
+// disconnectIP closes connections to peers with ip.
+func (t *torrent) disconnectIP(ip net.IP) {
+	select {
+	case t.disconnectIPCommandC <- ip:
+	case <-t.closeC:
+	}
+}
+
+func (t *torrent) handleDisconnectIP(ip net.IP) {
+	for pe := range t.peers {
+		if pe.Addr().IP.Equal(ip) {
+			t.log.Debugln("disconnecting banned peer:", pe.String())
+			t.closePeer(pe)
+		}
+	}
+}
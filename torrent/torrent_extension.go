@@ -0,0 +1,61 @@
+package torrent
+
+import (
+	"github.com/ProtocolONE/rain/internal/peer"
+	"github.com/ProtocolONE/rain/internal/peerprotocol"
+)
+
+// addCustomExtensions advertises the extensions registered with Session.RegisterExtension in handshake.
+func (t *torrent) addCustomExtensions(msg *peerprotocol.ExtensionHandshakeMessage) {
+	for _, e := range t.session.getCustomExtensions() {
+		msg.M[e.name] = e.id
+		for k, v := range e.handler.HandshakeKeys(t.id) {
+			if msg.Extra == nil {
+				msg.Extra = make(map[string]interface{})
+			}
+			msg.Extra[k] = v
+		}
+	}
+}
+
+func (t *torrent) handleCustomExtensionHandshake(pe *peer.Peer, msg peerprotocol.ExtensionHandshakeMessage) {
+	for _, e := range t.session.getCustomExtensions() {
+		id, ok := msg.M[e.name]
+		if !ok || id == peerprotocol.ExtensionIDHandshake {
+			continue
+		}
+		ep := &ExtensionPeer{
+			peer:        pe,
+			torrentID:   t.id,
+			infoHash:    InfoHash(t.infoHash),
+			extensionID: id,
+		}
+		if t.extensionPeers[pe] == nil {
+			t.extensionPeers[pe] = make(map[uint8]*ExtensionPeer)
+		}
+		t.extensionPeers[pe][e.id] = ep
+		e.handler.HandlePeer(ep, msg.Extra)
+	}
+}
+
+func (t *torrent) handleCustomExtensionMessage(pe *peer.Peer, msg peerprotocol.ExtensionCustomMessage) {
+	e := t.session.getCustomExtension(msg.ExtendedMessageID)
+	if e == nil {
+		pe.Logger().Debugln("received message of unknown extension:", msg.ExtendedMessageID)
+		return
+	}
+	ep, ok := t.extensionPeers[pe][e.id]
+	if !ok {
+		// Cannot reply to the peer if it did not advertise the extension.
+		pe.Logger().Debugln("received message of extension that is not in handshake:", e.name)
+		return
+	}
+	e.handler.HandleMessage(ep, msg.Data)
+}
+
+func (t *torrent) closeExtensionPeers(pe *peer.Peer) {
+	for id, ep := range t.extensionPeers[pe] {
+		t.session.getCustomExtension(id).handler.HandleDisconnect(ep)
+	}
+	delete(t.extensionPeers, pe)
+}
@@ -22,7 +22,13 @@ func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
 func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHandshaker) {
 	delete(t.incomingHandshakers, ih)
 	if ih.Error != nil {
-		delete(t.connectedPeerIPs, ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
+		ip := ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String()
+		if _, ok := t.holepunchIPs[ip]; ok {
+			// IP is still used by the holepunch dial.
+			t.holepunchIPs[ip] = false
+			return
+		}
+		delete(t.connectedPeerIPs, ip)
 		return
 	}
 	t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
@@ -30,8 +36,20 @@ func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHan
 
 func (t *torrent) handleOutgoingHandshakeDone(oh *outgoinghandshaker.OutgoingHandshaker) {
 	delete(t.outgoingHandshakers, oh)
+	ip := oh.Addr.IP.String()
+	var accepted bool
+	if oh.Source == peersource.Holepunch {
+		accepted = t.holepunchIPs[ip]
+		delete(t.holepunchIPs, ip)
+	}
 	if oh.Error != nil {
-		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		// If the peer has connected to us first, our dial fails but the IP is used by the incoming connection.
+		if !accepted {
+			delete(t.connectedPeerIPs, ip)
+		}
+		if _, ok := oh.Error.(*net.OpError); ok && oh.Source == peersource.PEX {
+			t.sendHolepunchRendezvous(oh.Addr)
+		}
 		t.dialAddresses()
 		return
 	}
@@ -0,0 +1,181 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/ProtocolONE/rain/internal/btconn"
+	"github.com/ProtocolONE/rain/internal/externalip"
+	"github.com/ProtocolONE/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/ProtocolONE/rain/internal/peer"
+	"github.com/ProtocolONE/rain/internal/peerprotocol"
+	"github.com/ProtocolONE/rain/internal/peersource"
+)
+
+// holepunchID returns the ID of ut_holepunch extension in the handshake of the peer.
+func holepunchID(pe *peer.Peer) (uint8, bool) {
+	if pe.ExtensionHandshake == nil {
+		return 0, false
+	}
+	id, ok := pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyHolepunch]
+	return id, ok && id != 0
+}
+
+func sendHolepunch(pe *peer.Peer, id uint8, msg peerprotocol.ExtensionHolepunchMessage) {
+	pe.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: id,
+		Payload:           msg,
+	})
+}
+
+// addPEXSources remembers the peer that sent the addresses so it can be asked to relay a rendezvous message
+// if the addresses cannot be dialed directly.
+func (t *torrent) addPEXSources(pe *peer.Peer, addrs []*net.TCPAddr) {
+	if !t.config.HolepunchEnabled {
+		return
+	}
+	if _, ok := holepunchID(pe); !ok {
+		return
+	}
+	for _, addr := range addrs {
+		if len(t.pexSources) >= t.config.MaxPeerAddresses {
+			return
+		}
+		t.pexSources[addr.String()] = pe
+	}
+}
+
+func (t *torrent) removePEXSource(pe *peer.Peer) {
+	for addr, src := range t.pexSources {
+		if src == pe {
+			delete(t.pexSources, addr)
+		}
+	}
+}
+
+// sendHolepunchRendezvous asks the peer that has sent the address with PEX to connect us with the peer at addr.
+func (t *torrent) sendHolepunchRendezvous(addr *net.TCPAddr) {
+	key := addr.String()
+	relay, ok := t.pexSources[key]
+	delete(t.pexSources, key)
+	if !ok || !t.config.HolepunchEnabled {
+		return
+	}
+	if _, ok = t.peers[relay]; !ok {
+		return
+	}
+	id, ok := holepunchID(relay)
+	if !ok {
+		return
+	}
+	relay.Logger().Debugln("sending holepunch rendezvous for", addr.String())
+	sendHolepunch(relay, id, peerprotocol.ExtensionHolepunchMessage{
+		Type: peerprotocol.HolepunchRendezvous,
+		Addr: addr,
+	})
+}
+
+func (t *torrent) handleHolepunchMessage(pe *peer.Peer, msg peerprotocol.ExtensionHolepunchMessage) {
+	if !t.config.HolepunchEnabled {
+		return
+	}
+	switch msg.Type {
+	case peerprotocol.HolepunchRendezvous:
+		t.relayHolepunch(pe, msg.Addr)
+	case peerprotocol.HolepunchConnect:
+		t.dialHolepunch(msg.Addr)
+	case peerprotocol.HolepunchError:
+		pe.Logger().Debugf("holepunch to %s failed: %s", msg.Addr, peerprotocol.HolepunchErrorString(msg.ErrCode))
+	default:
+		pe.Logger().Debugln("unknown holepunch message type:", msg.Type)
+	}
+}
+
+// relayHolepunch sends connect messages to both peers so they dial each other at the same time.
+func (t *torrent) relayHolepunch(pe *peer.Peer, target *net.TCPAddr) {
+	id, ok := holepunchID(pe)
+	if !ok {
+		return
+	}
+	sendError := func(code uint32) {
+		pe.Logger().Debugf("cannot relay holepunch to %s: %s", target, peerprotocol.HolepunchErrorString(code))
+		sendHolepunch(pe, id, peerprotocol.ExtensionHolepunchMessage{
+			Type:    peerprotocol.HolepunchError,
+			Addr:    target,
+			ErrCode: code,
+		})
+	}
+	if target.Port == 0 || target.IP.IsUnspecified() {
+		sendError(peerprotocol.HolepunchNoSuchPeer)
+		return
+	}
+	if target.Port == t.port && (target.IP.IsLoopback() || target.IP.Equal(t.externalIP) || externalip.IsExternal(target.IP)) {
+		sendError(peerprotocol.HolepunchNoSelf)
+		return
+	}
+	var other *peer.Peer
+	for p := range t.peers {
+		addr := p.Addr()
+		if addr.Port == target.Port && addr.IP.Equal(target.IP) {
+			other = p
+			break
+		}
+	}
+	if other == nil || other == pe {
+		sendError(peerprotocol.HolepunchNotConnected)
+		return
+	}
+	otherID, ok := holepunchID(other)
+	if !ok {
+		sendError(peerprotocol.HolepunchNoSupport)
+		return
+	}
+	sendHolepunch(other, otherID, peerprotocol.ExtensionHolepunchMessage{
+		Type: peerprotocol.HolepunchConnect,
+		Addr: pe.Addr(),
+	})
+	sendHolepunch(pe, id, peerprotocol.ExtensionHolepunchMessage{
+		Type: peerprotocol.HolepunchConnect,
+		Addr: target,
+	})
+}
+
+// dialHolepunch connects to the peer at addr while the peer is connecting to us.
+// Both sides initiate the connection so encrypted handshake cannot be done.
+// Seeders dial too because NAT in front of us drops the packets of the peer until we send a packet to it.
+func (t *torrent) dialHolepunch(addr *net.TCPAddr) {
+	if t.config.ForceOutgoingEncryption {
+		return
+	}
+	if addr.Port == 0 || addr.IP.IsUnspecified() {
+		return
+	}
+	ip := addr.IP.String()
+	if _, ok := t.connectedPeerIPs[ip]; ok {
+		return
+	}
+	if t.session.blocklist != nil && t.session.blocklist.Blocked(addr.IP) {
+		return
+	}
+	if len(t.outgoingPeers)+len(t.outgoingHandshakers) >= t.config.MaxPeerDial {
+		return
+	}
+	h := outgoinghandshaker.New(addr, peersource.Holepunch)
+	if t.acceptor != nil && btconn.ReusePortSupported && addr.IP.To4() != nil {
+		// The peer is dialing our listen port, so NAT lets its packets in only if we dial from the same port.
+		h.LocalAddr = &net.TCPAddr{Port: t.port}
+	}
+	t.outgoingHandshakers[h] = struct{}{}
+	t.connectedPeerIPs[ip] = struct{}{}
+	t.holepunchIPs[ip] = false
+	go h.Run(
+		t.config.PeerConnectTimeout,
+		t.config.PeerHandshakeTimeout,
+		t.peerID,
+		t.infoHash,
+		t.outgoingHandshakerResultC,
+		t.session.extensions,
+		true,
+		false,
+		t.session.bans.Banned,
+	)
+}
@@ -16,7 +16,7 @@ func (t *torrent) nextInfoDownload() *infodownloader.InfoDownloader {
 		if pe.ExtensionHandshake.MetadataSize == 0 {
 			continue
 		}
-		if pe.ExtensionHandshake.MetadataSize > int(t.session.config.MaxMetadataSize) {
+		if pe.ExtensionHandshake.MetadataSize > int(t.config.MaxMetadataSize) {
 			continue
 		}
 		_, ok := pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyMetadata]
@@ -11,6 +11,7 @@ import (
 	"github.com/ProtocolONE/rain/internal/peerconn/peerwriter"
 	"github.com/ProtocolONE/rain/internal/peerprotocol"
 	"github.com/ProtocolONE/rain/internal/peersource"
+	"github.com/ProtocolONE/rain/internal/piece"
 	"github.com/ProtocolONE/rain/internal/piecedownloader"
 	"github.com/ProtocolONE/rain/internal/piecewriter"
 	"github.com/ProtocolONE/rain/internal/tracker"
@@ -35,13 +36,9 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	}
 	t.downloadSpeed.Update(int64(len(msg.Buffer.Data)))
 	t.counters.Incr(counters.BytesDownloaded, int64(len(msg.Buffer.Data)))
-	pd, ok := t.pieceDownloaders[pe]
-	if !ok {
-		t.counters.Incr(counters.BytesWasted, int64(len(msg.Buffer.Data)))
-		msg.Buffer.Release()
-		return
-	}
-	if pd.Piece.Index != msg.Index {
+	pe.BlockReceived(msg.Index, msg.Begin)
+	pd := t.pieceDownloaderFor(pe, msg.Index)
+	if pd == nil {
 		t.counters.Incr(counters.BytesWasted, int64(len(msg.Buffer.Data)))
 		msg.Buffer.Release()
 		return
@@ -81,18 +78,31 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 		msg.Buffer.Release()
 		return
 	}
+	if err != piecedownloader.ErrBlockDuplicate {
+		t.mergeBlock(pd, block, msg.Buffer.Data)
+	}
 	msg.Buffer.Release()
 	if !pd.Done() {
-		pe := pd.Peer.(*peer.Peer)
 		if pd.AllowedFast || !pe.PeerChoking {
-			pd.RequestBlocks(t.maxAllowedRequests(pe))
+			t.requestBlocks(pe)
 			pe.ResetSnubTimer()
 		}
-		return
+		// Merged block may complete the download of the same piece from another peer.
+		pd = t.completedPieceDownloader(piece.Index)
+		if pd == nil {
+			return
+		}
+		pe = pd.Peer.(*peer.Peer)
 	}
 	t.log.Debugf("piece #%d downloaded from %s", msg.Index, pe.IP())
 	t.closePieceDownloader(pd)
-	pe.StopSnubTimer()
+	if _, ok := t.pieceDownloaders[pe]; ok {
+		// Blocks of other pieces are still expected from this peer.
+		t.requestBlocks(pe)
+		pe.ResetSnubTimer()
+	} else {
+		pe.StopSnubTimer()
+	}
 
 	if piece.Writing {
 		panic("piece is already writing")
@@ -107,7 +117,35 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	t.webseedPieceResultC.Suspend()
 
 	pw := piecewriter.New(piece, pe, pd.Buffer)
-	go pw.Run(t.pieceWriterResultC, t.doneC)
+	pw.BlockSources = pd.BlockSources()
+	pw.HashBlocks = t.smartBan.Has(piece.Index)
+	go pw.Run(t.session.hashPool, t.pieceWriterResultC, t.doneC)
+}
+
+// mergeBlock copies the block received by pd to other downloads of the same piece in endgame.
+// Then the piece is completed by the blocks of the fastest peers and it may contain blocks from several peers.
+func (t *torrent) mergeBlock(pd *piecedownloader.PieceDownloader, block piece.Block, data []byte) {
+	for _, pe := range t.piecePicker.RequestedPeers(pd.Piece.Index) {
+		pd2 := t.pieceDownloaderFor(pe, pd.Piece.Index)
+		if pd2 == nil || pd2 == pd {
+			continue
+		}
+		if pd2.MergeBlock(block, data, pd.Peer) && !pd2.Done() {
+			// Request is cancelled, fill the queue again.
+			t.requestBlocks(pe)
+		}
+	}
+}
+
+// completedPieceDownloader returns the download of the piece at index that has all blocks of the piece.
+func (t *torrent) completedPieceDownloader(index uint32) *piecedownloader.PieceDownloader {
+	for _, pe := range t.piecePicker.RequestedPeers(index) {
+		pd := t.pieceDownloaderFor(pe, index)
+		if pd != nil && pd.Done() {
+			return pd
+		}
+	}
+	return nil
 }
 
 func (t *torrent) handlePeerMessage(pm peer.Message) {
@@ -179,37 +217,52 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if t.piecePicker != nil {
 			t.piecePicker.HandleAllowedFast(pe, msg.Index)
 		}
+	case peerprotocol.SuggestMessage:
+		// Suggestions are advisory. Piece picker prefers the rarest pieces regardless.
+		pe.Logger().Debug("Peer ", pe.String(), " suggested piece #", msg.Index)
 	case peerprotocol.UnchokeMessage:
 		pe.PeerChoking = false
-		pd, ok := t.pieceDownloaders[pe]
-		if !ok {
-			t.startPieceDownloaderFor(pe)
-			break
-		}
-		if pd.AllowedFast {
-			break
+		var unchoked bool
+		for _, pd := range t.pieceDownloaders[pe] {
+			if pd.AllowedFast {
+				continue
+			}
+			unchoked = true
+			delete(t.pieceDownloadersChoked, pd)
+			if t.piecePicker != nil {
+				t.piecePicker.HandleUnchoke(pe, pd.Piece.Index)
+			}
 		}
-		delete(t.pieceDownloadersChoked, pd.Peer.(*peer.Peer))
-		pd.RequestBlocks(t.maxAllowedRequests(pe))
-		pe.ResetSnubTimer()
-		if t.piecePicker != nil {
-			t.piecePicker.HandleUnchoke(pe, pd.Piece.Index)
+		if unchoked {
+			t.requestBlocks(pe)
+			pe.ResetSnubTimer()
 		}
+		t.startPieceDownloaderFor(pe)
 	case peerprotocol.ChokeMessage:
 		pe.PeerChoking = true
-		pd, ok := t.pieceDownloaders[pe]
-		if !ok {
-			break
+		if !pe.FastEnabled {
+			// Peer drops the requests without rejecting them.
+			pe.RequestsDropped()
+		}
+		var choked, allowedFast bool
+		for _, pd := range t.pieceDownloaders[pe] {
+			if pd.AllowedFast {
+				allowedFast = true
+				continue
+			}
+			choked = true
+			pd.Choked()
+			t.pieceDownloadersChoked[pd] = struct{}{}
+			delete(t.pieceDownloadersSnubbed, pd)
+			if t.piecePicker != nil {
+				t.piecePicker.HandleChoke(pe, pd.Piece.Index)
+			}
 		}
-		if pd.AllowedFast {
+		if !choked {
 			break
 		}
-		pd.Choked()
-		pe.StopSnubTimer()
-		t.pieceDownloadersChoked[pe] = pd
-		delete(t.pieceDownloadersSnubbed, pe)
-		if t.piecePicker != nil {
-			t.piecePicker.HandleChoke(pe, pd.Piece.Index)
+		if !allowedFast {
+			pe.StopSnubTimer()
 		}
 		t.startPieceDownloaders()
 	case peerprotocol.InterestedMessage:
@@ -234,16 +287,21 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		pi := &t.pieces[msg.Index]
-		if pe.ClientChoking {
+		_, allowedFast := pe.ClientAllowedFast[msg.Index]
+		allowedFast = allowedFast && t.bitfield.Test(msg.Index)
+		if pe.ClientChoking && !allowedFast {
 			if pe.FastEnabled {
 				m := peerprotocol.RejectMessage{RequestMessage: msg}
 				pe.SendMessage(m)
 			}
 		} else {
 			if t.session.pieceCache != nil {
-				pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.PieceReadSize, t.peerID))
+				if pe.ReadStream == nil && t.config.PieceReadAhead > 0 {
+					pe.ReadStream = cachedpiece.NewStream(t.config.PieceReadAhead)
+				}
+				pe.SendPiece(msg, cachedpiece.New(t.pieces, msg.Index, t.session.pieceCache, t.config.PieceReadSize, t.id, pe.ReadStream), allowedFast)
 			} else {
-				pe.SendPiece(msg, pi.Data)
+				pe.SendPiece(msg, pi.Data, allowedFast)
 			}
 		}
 	case peerprotocol.RejectMessage:
@@ -258,11 +316,9 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			t.closePeer(pe)
 			break
 		}
-		pd, ok := t.pieceDownloaders[pe]
-		if !ok {
-			break
-		}
-		if pd.Piece.Index != msg.Index {
+		pe.RequestRejected(msg.Index, msg.Begin)
+		pd := t.pieceDownloaderFor(pe, msg.Index)
+		if pd == nil {
 			break
 		}
 		block, ok := pd.Piece.FindBlock(msg.Begin, msg.Length)
@@ -292,14 +348,19 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			}})
 		}
 	case peerprotocol.PortMessage:
-		if t.session.dht != nil {
-			t.session.dht.AddNode(fmt.Sprintf("%s:%d", pe.IP(), msg.Port))
-		}
+		t.session.addDHTNode(fmt.Sprintf("%s:%d", pe.IP(), msg.Port))
 	case peerwriter.BlockUploaded:
 		t.uploadSpeed.Update(int64(msg.Length))
 		t.counters.Incr(counters.BytesUploaded, int64(msg.Length))
 	case peerprotocol.ExtensionHandshakeMessage:
 		pe.Logger().Debugln("extension handshake received:", msg)
+		// Peers send the handshake again when their upload only state changes, e.g. when they complete the download.
+		pe.UploadOnly = msg.UploadOnly != 0
+		if pe.UploadOnly && t.completed {
+			pe.Logger().Debugln("closing connection to upload only peer while seeding")
+			t.closePeer(pe)
+			break
+		}
 		if pe.ExtensionHandshake != nil {
 			pe.Logger().Debugln("peer changed extensions")
 			break
@@ -312,17 +373,41 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if _, ok := msg.M[peerprotocol.ExtensionKeyMetadata]; ok {
 			t.startInfoDownloaders()
 		}
-		if t.session.config.PEXEnabled {
+		if t.config.PEXEnabled {
 			if _, ok := msg.M[peerprotocol.ExtensionKeyPEX]; ok {
 				if t.info != nil && t.info.Private != 1 {
 					pe.StartPEX(t.peers)
 				}
 			}
 		}
+		t.handleCustomExtensionHandshake(pe, msg)
 	case peerprotocol.ExtensionMetadataMessage:
 		t.handleMetadataMessage(pe, msg)
+	case peerprotocol.ExtensionDontHaveMessage:
+		if t.pieces == nil || t.bitfield == nil {
+			pe.Messages = append(pe.Messages, msg)
+			break
+		}
+		if msg.Index >= t.info.NumPieces {
+			pe.Logger().Errorln("invalid lt_donthave index:", msg.Index)
+			t.closePeer(pe)
+			break
+		}
+		if t.piecePicker != nil {
+			t.piecePicker.HandleDontHave(pe, msg.Index)
+		} else {
+			pe.Bitfield.Clear(msg.Index)
+		}
+		if pd := t.pieceDownloaderFor(pe, msg.Index); pd != nil {
+			t.closePieceDownloader(pd)
+			pd.CancelPending()
+			t.startPieceDownloaderFor(pe)
+		}
+		t.updateInterestedState(pe)
+	case peerprotocol.ExtensionCustomMessage:
+		t.handleCustomExtensionMessage(pe, msg)
 	case peerprotocol.ExtensionPEXMessage:
-		if !t.session.config.PEXEnabled {
+		if !t.config.PEXEnabled {
 			break
 		}
 		addrs, err := tracker.DecodePeersCompact([]byte(msg.Added))
@@ -330,7 +415,10 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			t.log.Error(err)
 			break
 		}
+		t.addPEXSources(pe, addrs)
 		t.handleNewPeers(addrs, peersource.PEX)
+	case peerprotocol.ExtensionHolepunchMessage:
+		t.handleHolepunchMessage(pe, msg)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -93,6 +93,7 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 		}
 		t.info = info
 		t.piecePool = bufferpool.New(int(info.PieceLength))
+		t.publishEvent(EventMetadataReceived)
 		err = t.session.resumer.WriteInfo(t.id, t.info.Bytes)
 		if err != nil {
 			t.stop(fmt.Errorf("cannot write resume info: %s", err))
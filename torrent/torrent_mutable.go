@@ -0,0 +1,46 @@
+package torrent
+
+import (
+	"github.com/ProtocolONE/rain/internal/existingdata"
+	"github.com/ProtocolONE/rain/internal/metainfo"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
+)
+
+// copyPreviousVersion links the files that are identical in the previous version of the mutable torrent into the storage.
+// Linked files are verified after allocation so only changed pieces are downloaded.
+// See existingdata.Link for why downloading one version never changes the data of the other.
+// It is called before allocation, from the goroutine of the allocator.
+func (t *torrent) copyPreviousVersion(info *metainfo.Info, prevID string, cancel <-chan struct{}) {
+	fs, ok := t.storage.(*filestorage.FileStorage)
+	if !ok {
+		return
+	}
+	spec, prev, bf, err := t.session.readDownloadedData(prevID)
+	if err != nil {
+		t.log.Debugln("cannot read previous version of torrent:", err)
+		return
+	}
+	if prev == nil {
+		return
+	}
+	matches := existingdata.FindInTorrent(info, prev, bf.Test, spec.Dest)
+	err = existingdata.Link(matches, fs.Dest(), cancel)
+	if err == existingdata.ErrCancelled {
+		return
+	}
+	if err != nil {
+		t.log.Errorln("cannot link files of previous version:", err)
+		return
+	}
+	t.log.Infof("reusing %d of %d files from previous version", len(matches), len(info.GetFiles()))
+}
+
+// removePreviousVersion removes the torrent that is replaced by this version if it is enabled in config.
+func (t *torrent) removePreviousVersion() {
+	if t.replaces == "" || !t.config.MutableTorrentRemoveOld {
+		return
+	}
+	id, prevID := t.id, t.replaces
+	t.replaces = ""
+	go t.session.removePreviousVersion(id, prevID)
+}
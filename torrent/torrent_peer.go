@@ -6,12 +6,14 @@ import (
 	"strconv"
 
 	"github.com/ProtocolONE/rain/internal/bitfield"
+	"github.com/ProtocolONE/rain/internal/cachedpiece"
 	"github.com/ProtocolONE/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/ProtocolONE/rain/internal/mse"
 	"github.com/ProtocolONE/rain/internal/peer"
 	"github.com/ProtocolONE/rain/internal/peerprotocol"
 	"github.com/ProtocolONE/rain/internal/peersource"
 	"github.com/ProtocolONE/rain/internal/resolver"
+	"github.com/ProtocolONE/rain/internal/speedlimit"
 )
 
 func (t *torrent) setNeedMorePeers(val bool) {
@@ -56,7 +58,7 @@ func (t *torrent) resolveAndAddPeer(host string, port int) {
 		}
 		cancel()
 	}()
-	ip, err := resolver.ResolveIPv4(ctx, t.session.config.DNSResolveTimeout, host)
+	ip, err := resolver.ResolveIPv4(ctx, t.config.DNSResolveTimeout, host)
 	if err != nil {
 		return
 	}
@@ -71,22 +73,11 @@ func (t *torrent) handleNewPeers(addrs []*net.TCPAddr, source peersource.Source)
 		return
 	}
 	if !t.completed {
-		addrs = t.filterBannedIPs(addrs)
 		t.addrList.Push(addrs, source)
 		t.dialAddresses()
 	}
 }
 
-func (t *torrent) filterBannedIPs(a []*net.TCPAddr) []*net.TCPAddr {
-	b := a[:0]
-	for _, x := range a {
-		if _, ok := t.bannedPeerIPs[x.IP.String()]; !ok {
-			b = append(b, x)
-		}
-	}
-	return b
-}
-
 func (t *torrent) dialAddresses() {
 	if t.completed {
 		return
@@ -94,7 +85,7 @@ func (t *torrent) dialAddresses() {
 	peersConnected := func() int {
 		return len(t.outgoingPeers) + len(t.outgoingHandshakers)
 	}
-	for peersConnected() < t.session.config.MaxPeerDial {
+	for peersConnected() < t.config.MaxPeerDial {
 		addr, src := t.addrList.Pop()
 		if addr == nil {
 			t.setNeedMorePeers(true)
@@ -108,14 +99,15 @@ func (t *torrent) dialAddresses() {
 		t.outgoingHandshakers[h] = struct{}{}
 		t.connectedPeerIPs[ip] = struct{}{}
 		go h.Run(
-			t.session.config.PeerConnectTimeout,
-			t.session.config.PeerHandshakeTimeout,
+			t.config.PeerConnectTimeout,
+			t.config.PeerHandshakeTimeout,
 			t.peerID,
 			t.infoHash,
 			t.outgoingHandshakerResultC,
 			t.session.extensions,
-			t.session.config.DisableOutgoingEncryption,
-			t.session.config.ForceOutgoingEncryption,
+			t.config.DisableOutgoingEncryption,
+			t.config.ForceOutgoingEncryption,
+			t.session.bans.Banned,
 		)
 	}
 }
@@ -140,7 +132,8 @@ func (t *torrent) startPeer(
 	}
 	t.peerIDs[peerID] = struct{}{}
 
-	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn)
+	conn = speedlimit.NewConn(conn, t.downloadLimiter, t.uploadLimiter)
+	pe := peer.New(conn, source, peerID, extensions, cipher, t.config.PieceReadTimeout, t.config.RequestTimeout, t.config.MaxRequestsIn)
 	t.peers[pe] = struct{}{}
 	peers[pe] = struct{}{}
 	if t.info != nil {
@@ -165,27 +158,42 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 		msg := peerprotocol.BitfieldMessage{Data: bitfieldData}
 		p.SendMessage(&msg)
 	}
+	t.sendAllowedFast(p)
+	t.sendSuggests(p)
+	if p.ExtensionsEnabled {
+		t.sendExtensionHandshake(p)
+	}
+	if p.DHTEnabled {
+		msg := peerprotocol.PortMessage{Port: t.config.DHTPort}
+		p.SendMessage(msg)
+	}
+}
+
+// sendExtensionHandshake sends the extension handshake (BEP 10) to the peer.
+// It is sent again when the torrent is completed to tell that we are upload only (BEP 21).
+func (t *torrent) sendExtensionHandshake(p *peer.Peer) {
 	var metadataSize uint32
 	if t.info != nil {
 		metadataSize = uint32(len(t.info.Bytes))
 	}
-	if p.ExtensionsEnabled {
-		extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn)
-		msg := peerprotocol.ExtensionMessage{
-			ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
-			Payload:           extHandshakeMsg,
-		}
-		p.SendMessage(msg)
+	extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.config.MaxRequestsIn)
+	if t.completed {
+		extHandshakeMsg.UploadOnly = 1
 	}
-	if p.DHTEnabled {
-		msg := peerprotocol.PortMessage{Port: t.session.config.DHTPort}
-		p.SendMessage(msg)
+	if !t.config.HolepunchEnabled {
+		delete(extHandshakeMsg.M, peerprotocol.ExtensionKeyHolepunch)
+	}
+	t.addCustomExtensions(&extHandshakeMsg)
+	msg := peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload:           extHandshakeMsg,
 	}
+	p.SendMessage(msg)
 }
 
 func (t *torrent) getClientVersion() string {
 	if t.info.IsPrivate() {
-		return t.session.config.PrivateExtensionHandshakeClientVersion
+		return t.config.PrivateExtensionHandshakeClientVersion
 	}
 	return publicExtensionHandshakeClientVersion
 }
@@ -203,15 +211,20 @@ func (t *torrent) processQueuedMessages() {
 
 func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
 	// Mark slow peer as snubbed to skip that peer in piece picker
-	if pd, ok := t.pieceDownloaders[pe]; ok {
+	if pds, ok := t.pieceDownloaders[pe]; ok {
 		// Snub timer is already stopped on choke message but may fire anyway.
 		if pe.PeerChoking {
 			return
 		}
 		pe.Snubbed = true
-		t.pieceDownloadersSnubbed[pe] = pd
-		if t.piecePicker != nil {
-			t.piecePicker.HandleSnubbed(pe, pd.Piece.Index)
+		for _, pd := range pds {
+			if _, ok := t.pieceDownloadersSnubbed[pd]; ok {
+				continue
+			}
+			t.pieceDownloadersSnubbed[pd] = struct{}{}
+			if t.piecePicker != nil {
+				t.piecePicker.HandleSnubbed(pe, pd.Piece.Index)
+			}
 		}
 		t.startPieceDownloaders()
 	} else if id, ok := t.infoDownloaders[pe]; ok {
@@ -220,3 +233,35 @@ func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
 		t.startInfoDownloaders()
 	}
 }
+
+// sendAllowedFast sends the allowed fast set of the peer once the info of the torrent is known.
+func (t *torrent) sendAllowedFast(pe *peer.Peer) {
+	if !pe.FastEnabled || t.info == nil || pe.ClientAllowedFast != nil || t.config.AllowedFastSetSize <= 0 {
+		return
+	}
+	set := peerprotocol.AllowedFastSet(pe.Addr().IP, t.infoHash[:], t.info.NumPieces, t.config.AllowedFastSetSize)
+	pe.ClientAllowedFast = make(map[uint32]struct{}, len(set))
+	for _, index := range set {
+		pe.ClientAllowedFast[index] = struct{}{}
+		pe.SendMessage(peerprotocol.AllowedFastMessage{HaveMessage: peerprotocol.HaveMessage{Index: index}})
+	}
+}
+
+// sendSuggests suggests the pieces that are recently read from disk,
+// so the peer downloads them while they are still in cache.
+func (t *torrent) sendSuggests(pe *peer.Peer) {
+	if !pe.FastEnabled || t.bitfield == nil || t.session.pieceCache == nil || t.config.SuggestPieces <= 0 {
+		return
+	}
+	var n int
+	for _, index := range cachedpiece.CachedPieces(t.session.pieceCache, t.id) {
+		if n >= t.config.SuggestPieces {
+			break
+		}
+		if index >= t.bitfield.Len() || !t.bitfield.Test(index) {
+			continue
+		}
+		pe.SendMessage(peerprotocol.SuggestMessage{HaveMessage: peerprotocol.HaveMessage{Index: index}})
+		n++
+	}
+}
@@ -5,10 +5,20 @@ import (
 	"time"
 
 	"github.com/ProtocolONE/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/ProtocolONE/rain/internal/storage"
+	"github.com/ProtocolONE/rain/internal/writecache"
 )
 
+// writeBitfield saves the bitfield to resume db after the cached piece data is written to disk,
+// so the resume db never contains pieces that would be lost on a crash.
 func (t *torrent) writeBitfield() error {
-	err := t.session.resumer.WriteBitfield(t.id, t.bitfield.Bytes())
+	err := t.flushWriteCache()
+	if err != nil {
+		err = fmt.Errorf("cannot write cached data to disk: %s", err)
+		t.log.Errorln(err)
+		return err
+	}
+	err = t.session.resumer.WriteBitfield(t.id, t.bitfield.Bytes())
 	if err != nil {
 		err = fmt.Errorf("cannot write bitfield to resume db: %s", err)
 		t.log.Errorln(err)
@@ -16,15 +26,71 @@ func (t *torrent) writeBitfield() error {
 	return err
 }
 
+func (t *torrent) flushWriteCache() error {
+	for _, f := range t.files {
+		if cf, ok := f.Storage.(*writecache.File); ok {
+			err := cf.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type cacheWriteError struct {
+	file *writecache.File
+	err  error
+}
+
+// wrapWriteCache returns a file that writes to f through the session write cache.
+// Write errors are reported to the run loop, because they may happen while flushing in another goroutine.
+func (t *torrent) wrapWriteCache(f storage.File) *writecache.File {
+	var cf *writecache.File
+	cf = t.session.writeCache.Wrap(f, func(err error) {
+		select {
+		case t.cacheWriteErrorC <- cacheWriteError{file: cf, err: err}:
+		default:
+		}
+	})
+	t.cacheFiles[cf] = struct{}{}
+	return cf
+}
+
+// handleCacheWriteError stops the torrent if the data of one of its files cannot be written to disk.
+// Pieces in the bitfield may be lost, so bitfield is recreated by verifying files when the torrent is started again.
+func (t *torrent) handleCacheWriteError(we cacheWriteError) {
+	if _, ok := t.cacheFiles[we.file]; !ok {
+		// Error of a file from a previous allocation.
+		return
+	}
+	// Torrent may be stopping already because of the same error returned from a piece write.
+	t.stop(fmt.Errorf("cannot write cached data to disk: %s", we.err))
+	t.mBitfield.Lock()
+	t.bitfield = nil
+	t.mBitfield.Unlock()
+	if t.completed {
+		t.completed = false
+		t.completeC = make(chan struct{})
+	}
+}
+
 func (t *torrent) checkCompletion() bool {
 	if t.completed {
 		return true
 	}
 	if !t.bitfield.All() {
+		// Pieces may be lost in verification. Publish the event again when they are downloaded.
+		t.wasCompleted = false
 		return false
 	}
 	t.completed = true
 	close(t.completeC)
+	if !t.wasCompleted {
+		t.wasCompleted = true
+		t.publishEvent(EventCompleted)
+		t.removePreviousVersion()
+	}
 	for h := range t.outgoingHandshakers {
 		h.Close()
 	}
@@ -33,14 +99,17 @@ func (t *torrent) checkCompletion() bool {
 		t.closeWebseedDownloader(src)
 	}
 	for pe := range t.peers {
-		if !pe.PeerInterested {
+		// There is nothing to exchange with peers that are not going to download.
+		if !pe.PeerInterested || pe.UploadOnly {
 			t.closePeer(pe)
 		}
 	}
 	t.addrList.Reset()
-	for _, pd := range t.pieceDownloaders {
-		t.closePieceDownloader(pd)
-		pd.CancelPending()
+	for _, pds := range t.pieceDownloaders {
+		for _, pd := range pds {
+			t.closePieceDownloader(pd)
+			pd.CancelPending()
+		}
 	}
 	t.piecePicker = nil
 	t.updateSeedDuration(time.Now())
@@ -43,6 +43,10 @@ func (t *torrent) run() {
 			req.Response <- t.getPeers()
 		case req := <-t.webseedsCommandC:
 			req.Response <- t.getWebseeds()
+		case req := <-t.filesCommandC:
+			req.Response <- t.getFiles()
+		case req := <-t.pieceMapCommandC:
+			req.Response <- t.getPieceMap()
 		case p := <-t.allocatorProgressC:
 			t.bytesAllocated = p.AllocatedSize
 		case al := <-t.allocatorResultC:
@@ -52,7 +56,7 @@ func (t *torrent) run() {
 		case ve := <-t.verifierResultC:
 			t.handleVerificationDone(ve)
 		case data := <-t.ramNotifyC:
-			t.startSinglePieceDownloader(data.(*peer.Peer))
+			t.handleRAMNotify(data.(*peer.Peer))
 		case addrs := <-t.addrsFromTrackers:
 			t.handleNewPeers(addrs, peersource.Tracker)
 		case addrs := <-t.addPeersCommandC:
@@ -61,6 +65,12 @@ func (t *torrent) run() {
 			t.handleNewPeers(addrs, peersource.DHT)
 		case trackers := <-t.addTrackersCommandC:
 			t.handleNewTrackers(trackers)
+		case req := <-t.verifyCommandC:
+			t.handleVerifyCommand(req)
+		case cfg := <-t.configCommandC:
+			t.handleConfigChange(cfg)
+		case ip := <-t.disconnectIPCommandC:
+			t.handleDisconnectIP(ip)
 		case conn := <-t.incomingConnC:
 			t.handleNewConnection(conn)
 		case res := <-t.webseedPieceResultC.ReceiveC():
@@ -69,6 +79,8 @@ func (t *torrent) run() {
 			t.startPieceDownloaderForWebseed(src)
 		case pw := <-t.pieceWriterResultC:
 			t.handlePieceWriteDone(pw)
+		case we := <-t.cacheWriteErrorC:
+			t.handleCacheWriteError(we)
 		case now := <-t.seedDurationTicker.C:
 			t.updateSeedDuration(now)
 		case <-t.speedCounterTicker.C:
@@ -6,7 +6,11 @@ import (
 	"github.com/ProtocolONE/rain/internal/acceptor"
 	"github.com/ProtocolONE/rain/internal/allocator"
 	"github.com/ProtocolONE/rain/internal/announcer"
+	"github.com/ProtocolONE/rain/internal/btconn"
+	"github.com/ProtocolONE/rain/internal/counters"
+	"github.com/ProtocolONE/rain/internal/metainfo"
 	"github.com/ProtocolONE/rain/internal/peer"
+	"github.com/ProtocolONE/rain/internal/piece"
 	"github.com/ProtocolONE/rain/internal/piecedownloader"
 	"github.com/ProtocolONE/rain/internal/piecepicker"
 	"github.com/ProtocolONE/rain/internal/tracker"
@@ -18,6 +22,10 @@ import (
 func (t *torrent) start() {
 	// Do not start if already started.
 	if t.errC != nil {
+		// Keep running after the verification started by Verify() command is done.
+		if t.verifyCmd != nil {
+			t.verifyCmd.wasRunning = true
+		}
 		return
 	}
 
@@ -31,6 +39,14 @@ func (t *torrent) start() {
 	t.errC = make(chan error, 1)
 	t.portC = make(chan int, 1)
 	t.lastError = nil
+	t.publishEvent(EventStarted)
+
+	// Verify() command is checking the files of the stopped torrent.
+	// Transfers are started after the verification is done.
+	if t.verifyCmd != nil {
+		t.verifyCmd.wasRunning = true
+		return
+	}
 
 	if t.info != nil {
 		if t.pieces != nil {
@@ -57,8 +73,12 @@ func (t *torrent) startVerifier() {
 	if t.verifier != nil {
 		panic("verifier exists")
 	}
+	// Files may be changed on disk since their regions are cached.
+	if t.session.pieceCache != nil {
+		t.session.pieceCache.RemoveGroup(t.id)
+	}
 	t.verifier = verifier.New()
-	go t.verifier.Run(t.pieces, t.verifierProgressC, t.verifierResultC)
+	go t.verifier.Run(t.pieces, t.session.hashPool, t.verifierProgressC, t.verifierResultC)
 }
 
 func (t *torrent) startAllocator() {
@@ -66,7 +86,30 @@ func (t *torrent) startAllocator() {
 		panic("allocator exists")
 	}
 	t.allocator = allocator.New()
-	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+	// Existing files are reused only before the data of the torrent is verified for the first time.
+	var dataDir, prevID string
+	var similar bool
+	if t.bitfield == nil && t.verifyCmd == nil {
+		dataDir, prevID = t.existingDataDir, t.replaces
+		similar = len(t.info.Similar) > 0 || len(t.info.Collections) > 0 || len(t.collections) > 0
+	}
+	if dataDir == "" && prevID == "" && !similar {
+		go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+		return
+	}
+	// Searching and linking files may take long, so it is done in the goroutine of the allocator and stopped with it.
+	go func(al *allocator.Allocator, info *metainfo.Info, dataDir, prevID string, collections []string) {
+		if dataDir != "" {
+			t.adoptExistingData(info, dataDir, al.Closing())
+		}
+		if prevID != "" {
+			t.copyPreviousVersion(info, prevID, al.Closing())
+		}
+		if similar {
+			t.copySimilarTorrents(info, collections, al.Closing())
+		}
+		al.Run(info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+	}(t.allocator, t.info, dataDir, prevID, t.collections)
 }
 
 func (t *torrent) addFixedPeers() {
@@ -81,20 +124,24 @@ func (t *torrent) startAnnouncers() {
 			t.startNewAnnouncer(tr)
 		}
 	}
-	if t.dhtAnnouncer == nil && t.session.config.DHTEnabled && (t.info == nil || t.info.Private != 1) {
+	if t.dhtAnnouncer == nil && t.config.DHTEnabled && (t.info == nil || t.info.Private != 1) {
 		t.dhtAnnouncer = announcer.NewDHTAnnouncer()
-		go t.dhtAnnouncer.Run(t.announceDHT, t.session.config.DHTAnnounceInterval, t.session.config.DHTMinAnnounceInterval, t.log)
+		go t.dhtAnnouncer.Run(t.announceDHT, t.config.DHTAnnounceInterval, t.config.DHTMinAnnounceInterval, t.log)
 	}
 }
 
 func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
 	an := announcer.NewPeriodicalAnnouncer(
 		tr,
-		t.session.config.TrackerNumWant,
-		t.session.config.TrackerMinAnnounceInterval,
+		t.config.TrackerNumWant,
+		t.config.TrackerMinAnnounceInterval,
 		t.announcerFields,
 		t.completeC,
 		t.addrsFromTrackers,
+		func(err error) {
+			t.counters.Incr(counters.TrackerErrors, 1)
+			t.session.publishEvent(Event{Type: EventTrackerError, TorrentID: t.id, Error: err, Tracker: tr.URL()})
+		},
 		t.log,
 	)
 	t.announcers = append(t.announcers, an)
@@ -105,7 +152,9 @@ func (t *torrent) startAcceptor() {
 	if t.acceptor != nil {
 		return
 	}
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{Port: t.port})
+	// Port is shared with the connections dialed for holepunch.
+	// HolepunchEnabled is not checked here because it can be changed while the torrent is running.
+	listener, err := btconn.ListenReusePort("tcp4", &net.TCPAddr{Port: t.port})
 	if err != nil {
 		t.log.Warningf("cannot listen port %d: %s", t.port, err)
 	} else {
@@ -121,7 +170,7 @@ func (t *torrent) startInfoDownloaders() {
 	if t.info != nil {
 		return
 	}
-	for len(t.infoDownloaders)-len(t.infoDownloadersSnubbed) < t.session.config.ParallelMetadataDownloads {
+	for len(t.infoDownloaders)-len(t.infoDownloadersSnubbed) < t.config.ParallelMetadataDownloads {
 		id := t.nextInfoDownload()
 		if id == nil {
 			break
@@ -146,9 +195,7 @@ func (t *torrent) startPieceDownloaders() {
 		}
 	}
 	for pe := range t.peers {
-		if !pe.Downloading {
-			t.startPieceDownloaderFor(pe)
-		}
+		t.startPieceDownloaderFor(pe)
 	}
 }
 
@@ -179,20 +226,50 @@ func (t *torrent) startWebseedDownloader(sp *piecepicker.WebseedDownloadSpec) {
 		src.LastError = nil
 		break
 	}
-	go ud.Run(t.webseedClient, t.pieces, t.info.MultiFile(), t.webseedPieceResultC.SendC(), t.piecePool, t.session.config.WebseedResponseBodyReadTimeout)
+	go ud.Run(t.webseedClient, t.pieces, t.info.MultiFile(), t.webseedPieceResultC.SendC(), t.piecePool, t.config.WebseedResponseBodyReadTimeout)
 }
 
+// startPieceDownloaderFor starts new piece downloads from the peer until it has as many as maxPieceDownloads allows.
 func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
 	if t.status() != Downloading {
 		return
 	}
-	if t.session.ram == nil {
-		t.startSinglePieceDownloader(pe)
+	if pe.RAMRequested {
+		// Next download is started when the memory is given.
 		return
 	}
-	ok := t.session.ram.Request(string(t.peerID[:]), pe, int64(t.info.PieceLength), t.ramNotifyC, pe.Done())
-	if ok {
-		t.startSinglePieceDownloader(pe)
+	for len(t.pieceDownloaders[pe]) < t.maxPieceDownloads(pe) {
+		n := len(t.pieceDownloaders[pe])
+		if t.session.ram == nil {
+			t.startSinglePieceDownloader(pe)
+		} else {
+			ok := t.session.ram.Request(string(t.peerID[:]), pe, int64(t.info.PieceLength), t.ramNotifyC, pe.Done())
+			if !ok {
+				// Download is started when memory becomes available.
+				pe.RAMRequested = true
+				return
+			}
+			t.startSinglePieceDownloader(pe)
+		}
+		if len(t.pieceDownloaders[pe]) == n {
+			// No piece to download from this peer.
+			return
+		}
+	}
+}
+
+// handleRAMNotify starts the piece download that has been waiting for memory and more downloads if the peer allows.
+func (t *torrent) handleRAMNotify(pe *peer.Peer) {
+	pe.RAMRequested = false
+	if _, ok := t.peers[pe]; !ok {
+		// Peer is disconnected after the memory is given.
+		t.session.ram.Release(int64(t.info.PieceLength))
+		return
+	}
+	n := len(t.pieceDownloaders[pe])
+	t.startSinglePieceDownloader(pe)
+	if len(t.pieceDownloaders[pe]) > n {
+		t.startPieceDownloaderFor(pe)
 	}
 }
 
@@ -206,29 +283,115 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 	if t.status() != Downloading {
 		return
 	}
+	if len(t.pieceDownloaders[pe]) >= t.maxPieceDownloads(pe) {
+		return
+	}
 	pi, allowedFast := t.piecePicker.PickFor(pe)
 	if pi == nil {
 		return
 	}
 	pd := piecedownloader.New(pi, pe, allowedFast, t.piecePool.Get(int(pi.Length)))
-	if _, ok := t.pieceDownloaders[pe]; ok {
-		panic("peer already has a piece downloader")
+	if t.pieceDownloaderFor(pe, pi.Index) != nil {
+		panic("peer already has a piece downloader for the piece")
 	}
 	t.log.Debugf("requesting piece #%d from peer %s", pi.Index, pe.IP())
-	t.pieceDownloaders[pe] = pd
+	t.pieceDownloaders[pe] = append(t.pieceDownloaders[pe], pd)
 	pe.Downloading = true
-	pd.RequestBlocks(t.maxAllowedRequests(pe))
+	t.requestBlocks(pe)
 	pe.ResetSnubTimer()
 	started = true
 }
 
+// pieceDownloaderFor returns the active download of piece at index from the peer, or nil if there is none.
+func (t *torrent) pieceDownloaderFor(pe *peer.Peer, index uint32) *piecedownloader.PieceDownloader {
+	for _, pd := range t.pieceDownloaders[pe] {
+		if pd.Piece.Index == index {
+			return pd
+		}
+	}
+	return nil
+}
+
+func indexOfPieceDownloader(pds []*piecedownloader.PieceDownloader, pd *piecedownloader.PieceDownloader) int {
+	for i := range pds {
+		if pds[i] == pd {
+			return i
+		}
+	}
+	return -1
+}
+
+// requestBlocks fills the request queue of the peer with blocks from its piece downloads.
+// Downloads started earlier get their blocks requested first, so pieces complete in order.
+func (t *torrent) requestBlocks(pe *peer.Peer) {
+	pds := t.pieceDownloaders[pe]
+	free := t.maxAllowedRequests(pe)
+	for _, pd := range pds {
+		free -= pd.Pending()
+	}
+	for _, pd := range pds {
+		if free <= 0 {
+			return
+		}
+		if !pd.AllowedFast && pe.PeerChoking {
+			continue
+		}
+		pending := pd.Pending()
+		pd.RequestBlocks(pending + free)
+		free -= pd.Pending() - pending
+	}
+}
+
+// maxPieceDownloads returns the number of pieces that can be downloaded from the peer at the same time.
+// It is enough for keeping the request queue of the peer full but limited by how fast the peer is sending pieces,
+// so slow peers do not hold pieces that can be downloaded from other peers.
+func (t *torrent) maxPieceDownloads(pe *peer.Peer) int {
+	if pe.Snubbed {
+		return 1
+	}
+	pieceLength := int64(t.info.PieceLength)
+	// Pieces needed to fill the request queue.
+	n := int((int64(t.maxAllowedRequests(pe))*piece.BlockSize + pieceLength - 1) / pieceLength)
+	// Pieces that the peer can send in a second, plus the one being completed.
+	if m := 1 + int(int64(pe.DownloadSpeed())/pieceLength); m < n {
+		n = m
+	}
+	if n > t.config.MaxPieceDownloadsPerPeer {
+		n = t.config.MaxPieceDownloadsPerPeer
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// minRequestsOut is the lower limit of adaptive request queue so that a slow peer can show it is getting faster.
+const minRequestsOut = 2
+
+// maxAllowedRequests returns the number of blocks that can be requested from the peer at the same time.
+// When download speed of the peer is known, the queue is sized to keep RequestQueueTime of data in flight,
+// or twice the round-trip time for high latency peers, so fast peers are saturated and slow peers are not flooded.
 func (t *torrent) maxAllowedRequests(pe *peer.Peer) int {
-	ret := t.session.config.DefaultRequestsOut
+	ret := t.config.DefaultRequestsOut
+	limit := t.config.MaxRequestsOut
 	if pe.ExtensionHandshake != nil && pe.ExtensionHandshake.RequestQueue > 0 {
 		ret = pe.ExtensionHandshake.RequestQueue
+		if ret < limit {
+			limit = ret
+		}
+	}
+	if speed := pe.DownloadSpeed(); speed > 0 && t.config.RequestQueueTime > 0 {
+		queueTime := t.config.RequestQueueTime
+		if rtt := 2 * pe.RTT(); rtt > queueTime {
+			queueTime = rtt
+		}
+		ret = int(float64(speed) * queueTime.Seconds() / piece.BlockSize)
+		if ret < minRequestsOut {
+			ret = minRequestsOut
+		}
 	}
-	if ret > t.session.config.MaxRequestsOut {
-		ret = t.session.config.MaxRequestsOut
+	if ret > limit {
+		ret = limit
 	}
 	return ret
 }
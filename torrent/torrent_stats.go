@@ -1,10 +1,12 @@
 package torrent
 
 import (
+	"path/filepath"
 	"strings"
 	"time"
 	"unicode"
 
+	"github.com/ProtocolONE/rain/internal/bitfield"
 	"github.com/ProtocolONE/rain/internal/counters"
 	"github.com/ProtocolONE/rain/internal/mse"
 	"github.com/ProtocolONE/rain/internal/peersource"
@@ -108,6 +110,10 @@ type Stats struct {
 	}
 	// Time remaining to complete download. nil value means infinity.
 	ETA *time.Duration
+	// Number of downloaded pieces that failed hash check.
+	HashFailures int64
+	// Number of failed announces to trackers.
+	TrackerErrors int64
 }
 
 func (t *torrent) stats() Stats {
@@ -129,14 +135,18 @@ func (t *torrent) stats() Stats {
 	s.MetadataDownloads.Total = len(t.infoDownloaders)
 	s.MetadataDownloads.Snubbed = len(t.infoDownloadersSnubbed)
 	s.MetadataDownloads.Running = len(t.infoDownloaders) - len(t.infoDownloadersSnubbed)
-	s.Downloads.Total = len(t.pieceDownloaders)
+	for _, pds := range t.pieceDownloaders {
+		s.Downloads.Total += len(pds)
+	}
 	s.Downloads.Snubbed = len(t.pieceDownloadersSnubbed)
 	s.Downloads.Choked = len(t.pieceDownloadersChoked)
-	s.Downloads.Running = len(t.pieceDownloaders) - len(t.pieceDownloadersChoked) - len(t.pieceDownloadersSnubbed)
+	s.Downloads.Running = s.Downloads.Total - len(t.pieceDownloadersChoked) - len(t.pieceDownloadersSnubbed)
 	s.Pieces.Available = t.avaliablePieceCount()
 	s.Bytes.Downloaded = t.counters.Read(counters.BytesDownloaded)
 	s.Bytes.Uploaded = t.counters.Read(counters.BytesUploaded)
 	s.Bytes.Wasted = t.counters.Read(counters.BytesWasted)
+	s.HashFailures = t.counters.Read(counters.HashFailures)
+	s.TrackerErrors = t.counters.Read(counters.TrackerErrors)
 	s.SeededFor = time.Duration(t.counters.Read(counters.SeededFor))
 	s.Bytes.Allocated = t.bytesAllocated
 	s.Pieces.Checked = t.checkedPieces
@@ -244,6 +254,10 @@ func (t *torrent) getPeers() []Peer {
 			source = SourcePEX
 		case peersource.Incoming:
 			source = SourceIncoming
+		case peersource.Manual:
+			source = SourceManual
+		case peersource.Holepunch:
+			source = SourceHolepunch
 		default:
 			panic("unhandled peer source")
 		}
@@ -264,6 +278,11 @@ func (t *torrent) getPeers() []Peer {
 			Source:             source,
 			DownloadSpeed:      pe.DownloadSpeed(),
 			UploadSpeed:        pe.UploadSpeed(),
+			RequestQueue:       t.maxAllowedRequests(pe),
+			RTT:                pe.RTT(),
+		}
+		for _, pd := range t.pieceDownloaders[pe] {
+			p.PendingRequests += pd.Pending()
 		}
 		peers = append(peers, p)
 	}
@@ -283,6 +302,53 @@ func (t *torrent) getWebseeds() []Webseed {
 	return webseeds
 }
 
+func (t *torrent) getFiles() []File {
+	if t.info == nil {
+		return nil
+	}
+	fds := t.info.GetFiles()
+	files := make([]File, len(fds))
+	var offset int64 // position of the file among all pieces
+	for i, fd := range fds {
+		files[i] = File{
+			Path:   filepath.Join(fd.Path...),
+			Length: fd.Length,
+		}
+		if t.bitfield != nil && fd.Length > 0 {
+			pieceLength := int64(t.info.PieceLength)
+			end := offset + fd.Length
+			for j := uint32(offset / pieceLength); int64(j)*pieceLength < end; j++ {
+				if !t.bitfield.Test(j) {
+					continue
+				}
+				begin := int64(j) * pieceLength
+				files[i].Completed += min(end, begin+pieceLength) - max(offset, begin)
+			}
+		}
+		offset += fd.Length
+	}
+	return files
+}
+
+func (t *torrent) getPieceMap() PieceMap {
+	if t.info == nil {
+		return PieceMap{}
+	}
+	var pm PieceMap
+	if t.bitfield != nil {
+		pm.Have = t.bitfield.Copy().Bytes()
+	} else {
+		pm.Have = make([]byte, bitfield.NumBytes(t.info.NumPieces))
+	}
+	pm.Availability = make([]int, t.info.NumPieces)
+	if t.piecePicker != nil {
+		for i := range pm.Availability {
+			pm.Availability[i] = t.piecePicker.Availability(uint32(i))
+		}
+	}
+	return pm
+}
+
 func (t *torrent) updateSeedDuration(now time.Time) {
 	if t.status() != Seeding {
 		t.seedDurationUpdatedAt = time.Time{}
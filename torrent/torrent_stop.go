@@ -14,11 +14,19 @@ func (t *torrent) handleStopped() {
 	t.errC = nil
 	t.portC = nil
 	t.log.Info("torrent has stopped")
+	t.publishEvent(EventStopped)
 }
 
 func (t *torrent) stop(err error) {
 	s := t.status()
 	if s == Stopping || s == Stopped {
+		// Verify() command checks the files of a stopped torrent without starting it.
+		if t.verifyCmd != nil {
+			t.cancelVerifyCommand(err)
+			t.closeData()
+			t.stopAllocator()
+			t.stopVerifier()
+		}
 		return
 	}
 
@@ -26,8 +34,11 @@ func (t *torrent) stop(err error) {
 	t.lastError = err
 	if err != nil && err != errClosed {
 		t.log.Error(err)
+		t.session.publishEvent(Event{Type: EventError, TorrentID: t.id, Error: err})
 	}
 
+	t.cancelVerifyCommand(err)
+
 	t.stopAcceptor()
 	t.stopPeers()
 	t.stopPiecedownloaders()
@@ -66,7 +77,7 @@ func (t *torrent) stop(err error) {
 	if t.stoppedEventAnnouncer != nil {
 		panic("stopped event announcer exists")
 	}
-	t.stoppedEventAnnouncer = announcer.NewStopAnnouncer(trackers, t.announcerFields(), t.session.config.TrackerStopTimeout, t.announcersStoppedC, t.log)
+	t.stoppedEventAnnouncer = announcer.NewStopAnnouncer(trackers, t.announcerFields(), t.config.TrackerStopTimeout, t.announcersStoppedC, t.log)
 
 	go t.stoppedEventAnnouncer.Run()
 
@@ -106,6 +117,7 @@ func (t *torrent) stopOutgoingHandshakers() {
 		oh.Close()
 	}
 	t.outgoingHandshakers = make(map[*outgoinghandshaker.OutgoingHandshaker]struct{})
+	t.holepunchIPs = make(map[string]bool)
 }
 
 func (t *torrent) stopIncomingHandshakers() {
@@ -127,6 +139,7 @@ func (t *torrent) closeData() {
 	t.files = nil
 	t.pieces = nil
 	t.piecePicker = nil
+	t.smartBan.Reset()
 	t.bytesAllocated = 0
 	t.checkedPieces = 0
 }
@@ -167,7 +180,9 @@ func (t *torrent) stopInfoDownloaders() {
 
 func (t *torrent) stopPiecedownloaders() {
 	t.log.Debugln("stopping piece downloaders")
-	for _, pd := range t.pieceDownloaders {
-		t.closePieceDownloader(pd)
+	for _, pds := range t.pieceDownloaders {
+		for _, pd := range pds {
+			t.closePieceDownloader(pd)
+		}
 	}
 }
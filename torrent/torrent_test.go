@@ -1,20 +1,44 @@
 package torrent
 
 import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/log"
+	"github.com/ProtocolONE/rain/internal/btconn"
 	"github.com/ProtocolONE/rain/internal/logger"
+	"github.com/ProtocolONE/rain/internal/magnet"
+	"github.com/ProtocolONE/rain/internal/mutableresolver"
+	"github.com/ProtocolONE/rain/internal/peerprotocol"
+	"github.com/ProtocolONE/rain/internal/piece"
+	"github.com/ProtocolONE/rain/internal/rpctypes"
+	"github.com/ProtocolONE/rain/internal/storage/filestorage"
 	"github.com/ProtocolONE/rain/internal/webseedsource"
+	"github.com/ProtocolONE/rain/internal/writecache"
+	"github.com/ProtocolONE/rain/rainrpc"
 	"github.com/fortytw2/leaktest"
+	"github.com/zeebo/bencode"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -57,19 +81,25 @@ func CopyDir(src, dst string) error {
 }
 
 func seeder(t *testing.T) (addr string, c func()) {
+	_, port, c := seederTorrent(t)
+	return "127.0.0.1:" + strconv.Itoa(port), c
+}
+
+// seederTorrent starts a session that seeds the sample torrent and returns the torrent and its listen port.
+func seederTorrent(t *testing.T) (tor *Torrent, port int, c func()) {
 	f, err := os.Open(torrentFile)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
 	s, closeSession := newTestSession(t)
-	tor, err := s.addTorrentStopped(f)
+	tor, err = s.addTorrentStopped(f, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	src := filepath.Join(torrentDataDir, torrentName)
 	dst := filepath.Join(s.config.DataDir, tor.ID(), torrentName)
-	err = os.Mkdir(filepath.Join(s.config.DataDir, tor.ID()), os.ModeDir|0750)
+	err = os.MkdirAll(filepath.Join(s.config.DataDir, tor.ID()), os.ModeDir|0750)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -79,7 +109,6 @@ func seeder(t *testing.T) (addr string, c func()) {
 	}
 	tor.torrent.trackers = nil
 	tor.Start()
-	var port int
 	select {
 	case port = <-tor.torrent.NotifyListen():
 	case err = <-tor.torrent.NotifyError():
@@ -87,7 +116,7 @@ func seeder(t *testing.T) (addr string, c func()) {
 	case <-time.After(timeout):
 		t.Fatal("seeder is not ready")
 	}
-	return "127.0.0.1:" + strconv.Itoa(port), func() {
+	return tor, port, func() {
 		closeSession()
 	}
 }
@@ -156,7 +185,7 @@ func TestDownloadWebseed(t *testing.T) {
 	}
 	defer f.Close()
 
-	tor, err := s.addTorrentStopped(f)
+	tor, err := s.addTorrentStopped(f, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -188,3 +217,1805 @@ func assertCompleted(t *testing.T, tor *Torrent) {
 		t.Fatal(err)
 	}
 }
+
+func TestRPCAuth(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.RPCToken = "token"
+	s.config.RPCUsers = map[string]string{"user": string(hash)}
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	cases := []struct {
+		setAuth func(r *http.Request)
+		status  int
+	}{
+		{func(r *http.Request) {}, http.StatusUnauthorized},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusOK},
+		{func(r *http.Request) { r.SetBasicAuth("user", "wrong") }, http.StatusUnauthorized},
+		{func(r *http.Request) { r.SetBasicAuth("user", "secret") }, http.StatusOK},
+		// Served from the cache of verified passwords.
+		{func(r *http.Request) { r.SetBasicAuth("user", "secret") }, http.StatusOK},
+		{func(r *http.Request) { r.SetBasicAuth("user", "wrong") }, http.StatusUnauthorized},
+	}
+	for i, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/debug/vars", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.setAuth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("case %d: unexpected status: %d", i, resp.StatusCode)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	sub := s.Subscribe()
+	defer sub.Close()
+
+	clt := rainrpc.NewClient(srv.URL)
+	defer clt.Close()
+	remoteSub, err := clt.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remoteSub.Close()
+
+	s.publishEvent(Event{Type: EventStarted, TorrentID: "bar"})
+	s.publishEvent(Event{Type: EventPieceCompleted, TorrentID: "foo", Piece: 3})
+
+	for _, typ := range []EventType{EventStarted, EventPieceCompleted} {
+		select {
+		case e := <-sub.C:
+			if e.Type != typ {
+				t.Fatalf("unexpected event: %v", e)
+			}
+		case <-time.After(timeout):
+			t.Fatal("timeout")
+		}
+	}
+	select {
+	case e := <-remoteSub.C:
+		if e.Type != string(EventPieceCompleted) || e.TorrentID != "foo" || e.Piece != 3 {
+			t.Fatalf("unexpected event: %v", e)
+		}
+	case <-time.After(timeout):
+		t.Fatal("timeout")
+	}
+}
+
+func TestTransmissionRPC(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newTransmissionHandler(s))
+	defer srv.Close()
+
+	call := func(sessionID, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(transmissionSessionIDHeader, sessionID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := call("", `{"method":"session-get"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get(transmissionSessionIDHeader)
+
+	resp = call(sessionID, `{"method":"session-get","tag":7}`)
+	defer resp.Body.Close()
+	var reply struct {
+		Result    string
+		Tag       int
+		Arguments struct {
+			RPCVersion int `json:"rpc-version"`
+		}
+	}
+	err := json.NewDecoder(resp.Body).Decode(&reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result != "success" || reply.Tag != 7 || reply.Arguments.RPCVersion != transmissionRPCVersion {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	resp = call(sessionID, `{"method":"torrent-foo"}`)
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result != errTransmissionMethod.Error() {
+		t.Fatalf("unexpected result: %s", reply.Result)
+	}
+}
+
+func TestRESTAPI(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/torrents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Torrents []interface{}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || list.Torrents == nil {
+		t.Fatalf("unexpected response: %d %v", resp.StatusCode, list)
+	}
+
+	resp, err = http.Post(srv.URL+"/api/torrents/foo/start", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	// Cross-site requests must be rejected.
+	resp, err = http.Post(srv.URL+"/api/session/stop", "text/plain", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/session/stop", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "http://example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]interface{}
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range restRoutes {
+		if _, ok := doc.Paths[route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("route is not documented: %s %s", route.Method, route.Path)
+		}
+	}
+	if _, ok := doc.Components.Schemas["Stats"]; !ok {
+		t.Error("Stats schema is missing")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "# TYPE rain_torrents gauge\nrain_torrents 0\n") {
+		t.Fatalf("unexpected metrics:\n%s", b)
+	}
+}
+
+func TestFilterTorrents(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &rpcHandler{session: s}
+	cases := []struct {
+		filter  rpctypes.TorrentFilter
+		matches bool
+	}{
+		{rpctypes.TorrentFilter{}, true},
+		{rpctypes.TorrentFilter{IDs: []string{tor.ID()}}, true},
+		{rpctypes.TorrentFilter{IDs: []string{"foo"}}, false},
+		{rpctypes.TorrentFilter{Status: []string{"stopped", "seeding"}}, true},
+		{rpctypes.TorrentFilter{Status: []string{"downloading"}}, false},
+		{rpctypes.TorrentFilter{Name: "sample_*"}, true},
+		{rpctypes.TorrentFilter{Name: "other*"}, false},
+		{rpctypes.TorrentFilter{TrackerHost: "tracker.invalid"}, false},
+	}
+	for i, c := range cases {
+		torrents, err := h.filterTorrents(&c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(torrents) == 1) != c.matches {
+			t.Errorf("case %d: unexpected number of torrents: %d", i, len(torrents))
+		}
+	}
+
+	var reply rpctypes.StopTorrentsResponse
+	err = h.StopTorrents(&rpctypes.StopTorrentsRequest{}, &reply)
+	if err != errEmptyFilter {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBulkLabelsAndLimits(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &rpcHandler{session: s}
+	filter := rpctypes.TorrentFilter{IDs: []string{tor.ID()}}
+	var labelsReply rpctypes.SetTorrentLabelsResponse
+	err = h.SetTorrentLabels(&rpctypes.SetTorrentLabelsRequest{Filter: filter, Labels: []string{"foo", "bar"}}, &labelsReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labelsReply.Results) != 1 || labelsReply.Results[0].Error != nil {
+		t.Fatalf("unexpected results: %v", labelsReply.Results)
+	}
+	var limitsReply rpctypes.SetTorrentLimitsResponse
+	err = h.SetTorrentLimits(&rpctypes.SetTorrentLimitsRequest{Filter: rpctypes.TorrentFilter{Label: "bar"}, DownloadLimit: 1000, UploadLimit: 2000}, &limitsReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limitsReply.Results) != 1 || limitsReply.Results[0].Error != nil {
+		t.Fatalf("unexpected results: %v", limitsReply.Results)
+	}
+	err = h.SetTorrentLimits(&rpctypes.SetTorrentLimitsRequest{Filter: filter, DownloadLimit: -1}, &limitsReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limitsReply.Results[0].Error == nil {
+		t.Fatal("negative limit must be rejected")
+	}
+
+	torrents, err := h.filterTorrents(&rpctypes.TorrentFilter{Label: "baz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 0 {
+		t.Fatal("torrent must not match other label")
+	}
+	download, upload := tor.SpeedLimits()
+	if download != 1000 || upload != 2000 {
+		t.Fatalf("unexpected limits: %d %d", download, upload)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Labels) != 2 || spec.Labels[0] != "foo" || spec.DownloadLimit != 1000 || spec.UploadLimit != 2000 {
+		t.Fatalf("labels and limits are not saved: %v %d %d", spec.Labels, spec.DownloadLimit, spec.UploadLimit)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &rpcHandler{session: s}
+	err = h.SetConfig(&rpctypes.SetConfigRequest{Config: map[string]interface{}{
+		"MaxPeerDial":    7,
+		"RequestTimeout": "42s",
+	}}, &rpctypes.SetConfigResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := s.Config()
+	if cfg.MaxPeerDial != 7 || cfg.RequestTimeout != 42*time.Second {
+		t.Fatalf("session config is not updated: %d %s", cfg.MaxPeerDial, cfg.RequestTimeout)
+	}
+	// Config is applied in torrent loop. Stats() waits for previous commands to be handled.
+	tor.Stats()
+	if tor.torrent.config.MaxPeerDial != 7 {
+		t.Fatal("torrent config is not updated")
+	}
+
+	err = h.SetConfig(&rpctypes.SetConfigRequest{Config: map[string]interface{}{"PortBegin": 1}}, &rpctypes.SetConfigResponse{})
+	if _, ok := err.(*ConfigNotReloadableError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = h.SetConfig(&rpctypes.SetConfigRequest{Config: map[string]interface{}{"RPCToken": "x"}}, &rpctypes.SetConfigResponse{})
+	if err == nil {
+		t.Fatal("hidden field must not be settable")
+	}
+
+	var reply rpctypes.GetConfigResponse
+	err = h.GetConfig(&rpctypes.GetConfigRequest{}, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Config["RequestTimeout"] != "42s" {
+		t.Errorf("unexpected RequestTimeout: %v", reply.Config["RequestTimeout"])
+	}
+	if _, ok := reply.Config["RPCToken"]; ok {
+		t.Error("RPCToken must not be returned")
+	}
+}
+
+func TestUpdateConfigBlocklistURL(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("10.0.0.0/8\n192.168.1.0/24\n"))
+	}))
+	defer srv.Close()
+
+	cfg := s.Config()
+	cfg.BlocklistURL = srv.URL
+	err := s.UpdateConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBlocklist := func(n int) {
+		for i := 0; s.blocklist.Len() != n; i++ {
+			if i == 100 {
+				t.Fatalf("unexpected number of blocklist rules: %d", s.blocklist.Len())
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitBlocklist(2)
+	if !s.blocklist.Blocked(net.IPv4(10, 1, 2, 3)) {
+		t.Fatal("IP in new blocklist must be blocked")
+	}
+
+	cfg.BlocklistURL = ""
+	err = s.UpdateConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBlocklist(0)
+}
+
+func TestUpdateConfigDHT(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	cfg.DHTHost = "127.0.0.1"
+	cfg.DHTPort = 0
+	cfg.DHTBootstrapNodes = nil
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.LocalAddr().(*net.UDPAddr).Port
+	l.Close()
+
+	node := s.dht
+	cfg = s.Config()
+	cfg.DHTPort = uint16(port)
+	err = s.UpdateConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.dht == node {
+		t.Fatal("DHT node is not restarted")
+	}
+	if p := s.dht.Port(); p != port {
+		t.Fatalf("DHT node listens on port %d, expected %d", p, port)
+	}
+
+	// Node is started with previous config if the new address is not valid.
+	node = s.dht
+	cfg.DHTHost = "invalid host"
+	err = s.UpdateConfig(cfg)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if s.Config().DHTHost != "127.0.0.1" {
+		t.Fatalf("DHT host must not change: %s", s.Config().DHTHost)
+	}
+	if s.dht == nil || s.dht == node || s.dht.Port() != port {
+		t.Fatal("DHT node is not started with previous config")
+	}
+
+	cfg = s.Config()
+	cfg.DHTEnabled = false
+	err = s.UpdateConfig(cfg)
+	if e, ok := err.(*ConfigNotReloadableError); !ok || len(e.Fields) != 1 || e.Fields[0] != "DHTEnabled" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUpdateConfigWhileAdding(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			cfg := s.Config()
+			cfg.MaxPeerDial = i + 1
+			_ = s.UpdateConfig(cfg)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := s.AddURIWithOptions(fmt.Sprintf("magnet:?xt=urn:btih:%040x", i+1), &AddTorrentOptions{Stopped: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if len(s.ListTorrents()) != 10 {
+		t.Fatalf("unexpected number of torrents: %d", len(s.ListTorrents()))
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	s.config.RPCWebUIEnabled = true
+
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	for _, path := range []string{"/ui/", "/ui/app.js", "/ui/style.css"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status for %s: %d", path, resp.StatusCode)
+		}
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := tor.Files()
+	if len(files) == 0 {
+		t.Fatal("no files")
+	}
+	for _, fi := range files {
+		if fi.Completed != 0 {
+			t.Errorf("file %s must not be completed: %d", fi.Path, fi.Completed)
+		}
+	}
+}
+
+func TestPieceMap(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &rpcHandler{session: s}
+	var reply rpctypes.GetTorrentPiecesResponse
+	err = h.GetTorrentPieces(&rpctypes.GetTorrentPiecesRequest{ID: tor.ID()}, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.NumPieces == 0 || len(reply.Availability) != int(reply.NumPieces) {
+		t.Fatalf("unexpected number of pieces: %d %d", reply.NumPieces, len(reply.Availability))
+	}
+	have, err := base64.StdEncoding.DecodeString(reply.Have)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != int(reply.NumPieces+7)/8 {
+		t.Errorf("unexpected bitfield length: %d", len(have))
+	}
+}
+
+func TestBans(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.AddBan(net.ParseIP("1.2.3.4"), "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddBan(net.ParseIP("5.6.7.8"), "expired", time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	bans := s.ListBans()
+	if len(bans) != 1 || bans[0].IP.String() != "1.2.3.4" || bans[0].Reason != "test" {
+		t.Fatalf("unexpected bans: %v", bans)
+	}
+
+	// Bans must be loaded again after restart.
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.bans.Banned(net.ParseIP("1.2.3.4")) {
+		t.Fatal("ban is not loaded from db")
+	}
+	if s.bans.Len() != 1 {
+		t.Fatalf("expired ban is loaded from db")
+	}
+
+	srv := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/bans/1.2.3.4", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if len(s.ListBans()) != 0 {
+		t.Fatal("ban is not removed")
+	}
+}
+
+type testExtension struct {
+	messages chan []byte
+}
+
+func (e *testExtension) HandshakeKeys(torrentID string) map[string]interface{} {
+	return map[string]interface{}{"x_greeting": "hello"}
+}
+
+func (e *testExtension) HandlePeer(p *ExtensionPeer, keys map[string]interface{}) {
+	if keys["x_greeting"] == "hello" {
+		p.Send([]byte("ping"))
+	}
+}
+
+func (e *testExtension) HandleMessage(p *ExtensionPeer, payload []byte) {
+	e.messages <- payload
+}
+
+func (e *testExtension) HandleDisconnect(p *ExtensionPeer) {}
+
+func TestCustomExtension(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+
+	ext1 := &testExtension{messages: make(chan []byte, 1)}
+	ext2 := &testExtension{messages: make(chan []byte, 1)}
+	if err := s1.RegisterExtension("x_test", ext1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.RegisterExtension("x_test", ext2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.RegisterExtension("x_test", ext2); err == nil {
+		t.Fatal("duplicate extension is registered")
+	}
+	if err := s2.RegisterExtension(peerprotocol.ExtensionKeyPEX, ext2); err == nil {
+		t.Fatal("builtin extension is registered")
+	}
+
+	addTorrent := func(s *Session) *Torrent {
+		f, err := os.Open(torrentFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		tor, err := s.addTorrentStopped(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tor.torrent.trackers = nil
+		return tor
+	}
+	tor1 := addTorrent(s1)
+	tor1.Start()
+	var port int
+	select {
+	case port = <-tor1.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	tor2 := addTorrent(s2)
+	tor2.Start()
+	err := tor2.AddPeer("127.0.0.1:" + strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []*testExtension{ext1, ext2} {
+		select {
+		case msg := <-ext.messages:
+			if string(msg) != "ping" {
+				t.Fatalf("unexpected message: %q", msg)
+			}
+		case <-time.After(timeout):
+			t.Fatal("extension message is not received")
+		}
+	}
+}
+
+func TestMutableTorrentNextVersion(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	var ih1, ih2 [20]byte
+	ih1[0] = 1
+	ih2[0] = 2
+	publicKey := make([]byte, 32)
+	id, dest, err := s.nextTorrentDest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.addMagnetTorrent(&magnet.Magnet{InfoHash: ih1, Name: "nightly", PublicKey: publicKey}, id, dest, 1, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := *s.mutableTorrents[tor.ID()]
+	if mt.seq != 1 {
+		t.Fatalf("unexpected seq: %d", mt.seq)
+	}
+
+	dataDir := s.getConfig().DataDir
+	err = s.addNextVersion(tor.ID(), mt, &mutableresolver.Item{InfoHash: ih2, Seq: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents := s.ListTorrents()
+	if len(torrents) != 2 {
+		t.Fatalf("unexpected number of torrents: %d", len(torrents))
+	}
+	next := torrents[0]
+	if next.ID() == tor.ID() {
+		next = torrents[1]
+	}
+	if next.ID() != tor.ID()+"-v2" {
+		t.Fatalf("unexpected ID of new version: %s", next.ID())
+	}
+	if next.InfoHash() != InfoHash(ih2) {
+		t.Fatal("new version has invalid info hash")
+	}
+	if next.torrent.replaces != tor.ID() {
+		t.Fatal("new version does not replace the old one")
+	}
+	if _, ok := s.mutableTorrents[tor.ID()]; ok {
+		t.Fatal("old version must not follow the public key")
+	}
+	if s.mutableTorrents[next.ID()].seq != 2 {
+		t.Fatal("new version must follow the public key")
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.PublicKey != nil {
+		t.Fatal("public key of old version must be deleted")
+	}
+	spec, err = s.resumer.Read(next.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Seq != 2 || spec.Replaces != tor.ID() {
+		t.Fatalf("unexpected spec: %+v", spec)
+	}
+	if spec.Dest != filepath.Join(filepath.Dir(dest), next.ID()) {
+		t.Fatalf("new version must be saved next to the old one: %s", spec.Dest)
+	}
+	if s.getConfig().DataDir != dataDir {
+		t.Fatalf("DataDir must not change: %s", s.getConfig().DataDir)
+	}
+}
+
+func TestMutableTorrentDefaultConfig(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	// Session must follow mutable torrents without any config change.
+	cfg := s.getConfig()
+	if cfg.MutableTorrentUpdateInterval != DefaultConfig.MutableTorrentUpdateInterval || cfg.MutableTorrentUpdateInterval <= 0 {
+		t.Fatalf("unexpected update interval: %s", cfg.MutableTorrentUpdateInterval)
+	}
+	if cfg.MutableTorrentResolveTimeout != DefaultConfig.MutableTorrentResolveTimeout || cfg.MutableTorrentResolveTimeout <= 0 {
+		t.Fatalf("unexpected resolve timeout: %s", cfg.MutableTorrentResolveTimeout)
+	}
+}
+
+func newTestTorrentFile(t *testing.T, name string, files [][2]string, similar [][]byte) []byte {
+	const pieceLength = 4
+	var data []byte
+	var dicts []map[string]interface{}
+	for _, f := range files {
+		data = append(data, f[1]...)
+		dicts = append(dicts, map[string]interface{}{"length": len(f[1]), "path": []string{f[0]}})
+	}
+	var pieces []byte
+	for i := 0; i < len(data); i += pieceLength {
+		sum := sha1.Sum(data[i : i+pieceLength]) // nolint: gosec
+		pieces = append(pieces, sum[:]...)
+	}
+	info := map[string]interface{}{
+		"name":         name,
+		"piece length": pieceLength,
+		"pieces":       pieces,
+		"files":        dicts,
+	}
+	if len(similar) > 0 {
+		info["similar"] = similar
+	}
+	b, err := bencode.EncodeBytes(map[string]interface{}{"info": info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// withCollections adds collections to the top level of torrent file b, outside of the info dictionary.
+func withCollections(t *testing.T, b []byte, collections ...string) []byte {
+	var m map[string]interface{}
+	err := bencode.DecodeBytes(b, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m["collections"] = collections
+	b, err = bencode.EncodeBytes(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSimilarTorrents(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tmp := s.config.DataDir
+
+	s.config.DataDir = filepath.Join(tmp, "a")
+	torA, err := s.addTorrentStopped(bytes.NewReader(withCollections(t, newTestTorrentFile(t, "v1", [][2]string{{"a", "01234567"}, {"b", "abcd"}}, nil), "nightly")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcA := filepath.Join(tmp, "a", "v1", "a")
+	for name, data := range map[string]string{srcA: "01234567", filepath.Join(tmp, "a", "v1", "b"): "abcd"} {
+		err = os.MkdirAll(filepath.Dir(name), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(name, []byte(data), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.resumer.WriteBitfield(torA.ID(), []byte{0xe0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ihA := torA.InfoHash()
+	s.config.DataDir = filepath.Join(tmp, "b")
+	torB, err := s.addTorrentStopped(bytes.NewReader(newTestTorrentFile(t, "v2", [][2]string{{"a", "01234567"}, {"c", "wxyz"}}, [][]byte{ihA[:]})), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(tmp, "b", "v2", "a")); !os.IsNotExist(err) {
+		t.Fatal("files must be linked when the torrent is started, not when it is added")
+	}
+	torB.torrent.trackers = nil
+	err = torB.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// First file is 2 pieces and they are verified after allocation.
+	waitStats(t, torB, func(st Stats) bool { return st.Pieces.Have == 2 }, "pieces of linked file")
+	fiA, err := os.Stat(srcA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fiB, err := os.Stat(filepath.Join(tmp, "b", "v2", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filestorage.DetectsLinks && !os.SameFile(fiA, fiB) {
+		t.Fatal("identical file must be linked")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(tmp, "b", "v2", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "01234567" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+	if st := torB.Stats(); st.Pieces.Have != 2 {
+		t.Fatalf("file that is not in similar torrent must not be reused, have %d pieces", st.Pieces.Have)
+	}
+
+	// Collections outside of the info dictionary of the other torrent are matched too.
+	s.config.DataDir = filepath.Join(tmp, "c")
+	torC, err := s.addTorrentStopped(bytes.NewReader(withCollections(t, newTestTorrentFile(t, "v3", [][2]string{{"b", "abcd"}}, nil), "nightly")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torC.torrent.trackers = nil
+	err = torC.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, torC, func(st Stats) bool { return st.Pieces.Have == 1 }, "pieces of linked file")
+	b, err = ioutil.ReadFile(filepath.Join(tmp, "c", "v3", "b"))
+	if err != nil {
+		t.Fatal("file is not copied from torrent in same collection:", err)
+	}
+	if string(b) != "abcd" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+}
+
+// addVerifyTestTorrent adds a stopped torrent with 3 pieces and writes its data to disk.
+func addVerifyTestTorrent(t *testing.T, s *Session) (*Torrent, string) {
+	tmp := s.config.DataDir
+	s.config.DataDir = filepath.Join(tmp, "verify")
+	tor, err := s.addTorrentStopped(bytes.NewReader(newTestTorrentFile(t, "data", [][2]string{{"a", "01234567"}, {"b", "abcd"}}, nil)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.DataDir = tmp
+	dir := filepath.Join(tmp, "verify", "data")
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"a": "01234567", "b": "abcd"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tor, dir
+}
+
+func waitStatus(t *testing.T, tor *Torrent, status Status) {
+	deadline := time.Now().Add(timeout)
+	for tor.Stats().Status != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for status %d, current status: %d", status, tor.Stats().Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVerifyStopped(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, _ := addVerifyTestTorrent(t, s)
+	sub := s.Subscribe()
+	defer sub.Close()
+
+	res, err := tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Have != 3 || len(res.Found) != 3 || len(res.Lost) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if st := tor.Stats().Status; st != Stopped {
+		t.Fatalf("torrent must stay stopped after verification, status: %d", st)
+	}
+	for {
+		select {
+		case e := <-sub.C:
+			if e.TorrentID == tor.ID() && (e.Type == EventStarted || e.Type == EventStopped) {
+				t.Fatalf("torrent is started for verification: %v", e)
+			}
+			continue
+		default:
+		}
+		break
+	}
+}
+
+func TestVerifyRunning(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, dir := addVerifyTestTorrent(t, s)
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+
+	// Corrupt the last piece.
+	err = ioutil.WriteFile(filepath.Join(dir, "b"), []byte("abcx"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Have != 2 || len(res.Found) != 0 || len(res.Lost) != 1 || res.Lost[0] != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	waitStatus(t, tor, Downloading)
+}
+
+func TestWriteCacheError(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, dir := addVerifyTestTorrent(t, s)
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+
+	// Stats() waits for the run loop, so files are not changed after this point.
+	tor.Stats()
+	var cf *writecache.File
+	for f := range tor.torrent.cacheFiles {
+		cf = f
+	}
+	if cf == nil {
+		t.Fatal("files are not wrapped by write cache")
+	}
+	// Cached data of the last piece is lost.
+	err = ioutil.WriteFile(filepath.Join(dir, "b"), []byte("abcx"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.cacheWriteErrorC <- cacheWriteError{file: cf, err: errors.New("disk is full")}
+	waitStatus(t, tor, Stopped)
+	if tor.Stats().Error == nil {
+		t.Fatal("torrent must be stopped with error")
+	}
+
+	// Files are verified again and the lost piece is downloaded.
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Downloading)
+	if have := tor.Stats().Pieces.Have; have != 2 {
+		t.Fatalf("unexpected number of pieces: %d", have)
+	}
+}
+
+func TestFindExistingData(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tmp := s.config.DataDir
+
+	existing := filepath.Join(tmp, "existing")
+	for name, data := range map[string]string{"a": "01234567", "renamed": "abcd"} {
+		err := os.MkdirAll(existing, 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(existing, name), []byte(data), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := s.AddTorrentWithOptions(bytes.NewReader(newTestTorrentFile(t, "foo", [][2]string{{"a", "01234567"}}, nil)), &AddTorrentOptions{FindExistingDataIn: filepath.Join(tmp, "missing")})
+	if !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.config.DataDir = filepath.Join(tmp, "data")
+	tor, err := s.AddTorrentWithOptions(bytes.NewReader(newTestTorrentFile(t, "foo", [][2]string{{"a", "01234567"}, {"b", "abcd"}}, nil)), &AddTorrentOptions{FindExistingDataIn: existing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files are searched and linked in background after the torrent is started.
+	waitStatus(t, tor, Seeding)
+	if tor.torrent.existingDataDir != "" {
+		t.Fatal("existing data must be searched only once")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(tmp, "data", "foo", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcd" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+}
+
+func TestVerifyCancel(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, _ := addVerifyTestTorrent(t, s)
+
+	// Keep hash workers busy so the verification cannot finish.
+	releaseC := make(chan struct{})
+	defer close(releaseC)
+	for i := 0; i < s.hashPool.Workers(); i++ {
+		go s.hashPool.Do(func(h hash.Hash) { <-releaseC }, nil)
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := tor.Verify()
+		errC <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	err := tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-errC:
+		if err != errVerifyCancelled {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("timeout")
+	}
+	if st := tor.Stats().Status; st != Stopped {
+		t.Fatalf("unexpected status: %d", st)
+	}
+}
+
+func TestCompletedEvent(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, _ := addVerifyTestTorrent(t, s)
+	sub := s.Subscribe()
+	defer sub.Close()
+
+	completedEvents := func() int {
+		var n int
+		for {
+			select {
+			case e := <-sub.C:
+				if e.TorrentID == tor.ID() && e.Type == EventCompleted {
+					n++
+				}
+			case <-time.After(100 * time.Millisecond):
+				return n
+			}
+		}
+	}
+
+	// Data is found on first start.
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+	if n := completedEvents(); n != 1 {
+		t.Fatalf("unexpected number of completed events: %d", n)
+	}
+
+	// Already complete torrent is started again.
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Stopped)
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+	_, err = tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := completedEvents(); n != 0 {
+		t.Fatalf("completed event is published for complete torrent: %d", n)
+	}
+}
+
+func TestTransmissionRemoveAndPausedAdd(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newTransmissionHandler(s))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"method":"session-get"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	sessionID := resp.Header.Get(transmissionSessionIDHeader)
+	call := func(body string) {
+		req, err2 := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		req.Header.Set(transmissionSessionIDHeader, sessionID)
+		resp, err2 := http.DefaultClient.Do(req)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		defer resp.Body.Close()
+		var reply struct{ Result string }
+		err2 = json.NewDecoder(resp.Body).Decode(&reply)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		if reply.Result != "success" {
+			t.Fatalf("unexpected result: %s", reply.Result)
+		}
+	}
+
+	_, dir := addVerifyTestTorrent(t, s)
+	call(`{"method":"torrent-remove","arguments":{"delete-local-data":false}}`)
+	if len(s.ListTorrents()) != 0 {
+		t.Fatal("torrent is not removed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err = os.Stat(filepath.Join(dir, "a")); err != nil {
+		t.Fatal("data is deleted:", err)
+	}
+
+	addVerifyTestTorrent(t, s)
+	call(`{"method":"torrent-remove","arguments":{"delete-local-data":true}}`)
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err = os.Stat(filepath.Join(dir, "a")); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("data is not deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sub := s.Subscribe()
+	defer sub.Close()
+	tmp := s.config.DataDir
+	s.config.DataDir = filepath.Join(tmp, "paused")
+	encoded := base64.StdEncoding.EncodeToString(newTestTorrentFile(t, "data", [][2]string{{"a", "01234567"}}, nil))
+	call(`{"method":"torrent-add","arguments":{"paused":true,"metainfo":"` + encoded + `"}}`)
+	s.config.DataDir = tmp
+	torrents := s.ListTorrents()
+	if len(torrents) != 1 || torrents[0].Stats().Status != Stopped {
+		t.Fatalf("paused torrent is not added as stopped: %v", torrents)
+	}
+	for {
+		select {
+		case e := <-sub.C:
+			if e.Type == EventStarted {
+				t.Fatal("paused torrent is started")
+			}
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+}
+
+// fakePeer is a seeder that implements the part of the peer protocol needed for testing downloads.
+type fakePeer struct {
+	l     net.Listener
+	mConn sync.Mutex
+	conn  net.Conn
+	// Extension handshakes received from the torrent if the peer supports extension protocol.
+	handshakes chan peerprotocol.ExtensionHandshakeMessage
+}
+
+// newFakePeer listens on ip and sends bitfield and unchoke messages to the first peer connecting for the torrent with ih.
+// onRequest is called in the read loop with the number of times that the block at begin of the piece at index is requested.
+func newFakePeer(t *testing.T, ip string, ih [20]byte, bitfield []byte, onRequest func(p *fakePeer, index, begin uint32, n int)) *fakePeer {
+	return newFakePeerWithExtensions(t, ip, ih, bitfield, nil, onRequest)
+}
+
+// newFakePeerWithExtensions is same as newFakePeer but the peer supports extension protocol (BEP 10).
+// If handshake is not nil, it is sent after the unchoke message.
+func newFakePeerWithExtensions(t *testing.T, ip string, ih [20]byte, bitfield []byte, handshake *peerprotocol.ExtensionHandshakeMessage, onRequest func(p *fakePeer, index, begin uint32, n int)) *fakePeer {
+	l, err := net.Listen("tcp4", ip+":0")
+	if err != nil {
+		t.Skip("cannot listen on", ip, err)
+	}
+	p := &fakePeer{l: l, handshakes: make(chan peerprotocol.ExtensionHandshakeMessage, 10)}
+	var extensions [8]byte
+	if handshake != nil {
+		extensions[5] |= 0x10 // Extension Protocol (BEP 10)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		var id [20]byte
+		copy(id[:], "-FAKE-"+ip)
+		conn, _, _, _, _, err = btconn.Accept(conn, timeout, func([20]byte) []byte { return ih[:] }, false, func(h [20]byte) bool { return h == ih }, nil, extensions, id)
+		if err != nil {
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+		p.mConn.Lock()
+		p.conn = conn
+		p.mConn.Unlock()
+		p.send(peerprotocol.Bitfield, bitfield)
+		p.send(peerprotocol.Unchoke, nil)
+		if handshake != nil {
+			p.sendExtensionHandshake(*handshake)
+		}
+		requests := make(map[[2]uint32]int)
+		for {
+			var length uint32
+			if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+				return
+			}
+			msg := make([]byte, length)
+			if _, err = io.ReadFull(conn, msg); err != nil {
+				return
+			}
+			if length > 2 && msg[0] == byte(peerprotocol.Extension) && msg[1] == peerprotocol.ExtensionIDHandshake {
+				var hs peerprotocol.ExtensionHandshakeMessage
+				if bencode.DecodeBytes(msg[2:], &hs) == nil {
+					p.handshakes <- hs
+				}
+				continue
+			}
+			if length != 13 || msg[0] != byte(peerprotocol.Request) {
+				continue
+			}
+			index, begin := binary.BigEndian.Uint32(msg[1:5]), binary.BigEndian.Uint32(msg[5:9])
+			requests[[2]uint32{index, begin}]++
+			onRequest(p, index, begin, requests[[2]uint32{index, begin}])
+		}
+	}()
+	return p
+}
+
+func (p *fakePeer) Addr() string {
+	return p.l.Addr().String()
+}
+
+func (p *fakePeer) Close() {
+	p.l.Close()
+	p.mConn.Lock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.mConn.Unlock()
+}
+
+func (p *fakePeer) send(id peerprotocol.MessageID, payload []byte) {
+	b := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(1+len(payload)))
+	b[4] = byte(id)
+	p.mConn.Lock()
+	_, _ = p.conn.Write(append(b, payload...))
+	p.mConn.Unlock()
+}
+
+func (p *fakePeer) sendExtensionHandshake(msg peerprotocol.ExtensionHandshakeMessage) {
+	b, err := bencode.EncodeBytes(msg)
+	if err != nil {
+		panic(err)
+	}
+	p.send(peerprotocol.Extension, append([]byte{peerprotocol.ExtensionIDHandshake}, b...))
+}
+
+func (p *fakePeer) sendBlock(index, begin uint32, data []byte) {
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, index)
+	binary.BigEndian.PutUint32(b[4:], begin)
+	p.send(peerprotocol.Piece, append(b, data...))
+}
+
+// newTestTorrent returns a torrent file for data with the piece length.
+func newTestTorrent(t *testing.T, name string, data []byte, pieceLength int) []byte {
+	var pieces []byte
+	for i := 0; i < len(data); i += pieceLength {
+		sum := sha1.Sum(data[i : i+pieceLength]) // nolint: gosec
+		pieces = append(pieces, sum[:]...)
+	}
+	b, err := bencode.EncodeBytes(map[string]interface{}{"info": map[string]interface{}{
+		"name":         name,
+		"piece length": pieceLength,
+		"pieces":       pieces,
+		"length":       len(data),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// waitStats waits until the stats of the torrent satisfy cond.
+func waitStats(t *testing.T, tor *Torrent, cond func(Stats) bool, msg string) Stats {
+	deadline := time.Now().Add(timeout)
+	for {
+		stats := tor.Stats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s, downloads: %+v", msg, stats.Downloads)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSmartBan(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	// Torrent has a single piece with 2 blocks.
+	data := bytes.Repeat([]byte{1}, 2*piece.BlockSize)
+	tor, err := s.addTorrentStopped(bytes.NewReader(newTestTorrent(t, "smartban", data, len(data))), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	ih := [20]byte(tor.InfoHash())
+
+	// Good peer sends the first block after the piece is requested from both peers, so the blocks are merged.
+	// Second block is sent when the piece is downloaded again after the hash check fails.
+	bRequested := make(chan struct{})
+	var closeRequested sync.Once
+	peerA := newFakePeer(t, "127.0.0.1", ih, []byte{0x80}, func(p *fakePeer, index, begin uint32, n int) {
+		switch {
+		case begin == 0:
+			<-bRequested
+			p.sendBlock(index, begin, data[:piece.BlockSize])
+		case n > 1:
+			p.sendBlock(index, begin, data[piece.BlockSize:])
+		}
+	})
+	defer peerA.Close()
+	// Bad peer sends only a corrupt second block.
+	peerB := newFakePeer(t, "127.0.0.2", ih, []byte{0x80}, func(p *fakePeer, index, begin uint32, n int) {
+		closeRequested.Do(func() { close(bRequested) })
+		if begin == piece.BlockSize && n == 1 {
+			p.sendBlock(index, begin, make([]byte, piece.BlockSize))
+		}
+	})
+	defer peerB.Close()
+
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{peerA.Addr(), peerB.Addr()} {
+		err = tor.AddPeer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download is not completed")
+	}
+	bans := s.ListBans()
+	if len(bans) != 1 || !bans[0].IP.Equal(net.ParseIP("127.0.0.2")) {
+		t.Fatalf("unexpected bans: %v", bans)
+	}
+	if stats := tor.Stats(); stats.Pieces.Have != 1 {
+		t.Fatalf("unexpected number of pieces: %d", stats.Pieces.Have)
+	}
+}
+
+func TestUploadOnlyHandshake(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	data := bytes.Repeat([]byte{1}, piece.BlockSize)
+	tor, err := s.addTorrentStopped(bytes.NewReader(newTestTorrent(t, "uploadonly", data, len(data))), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	ih := [20]byte(tor.InfoHash())
+
+	// Blocks are sent after both peers are connected and their handshakes are handled.
+	releaseC := make(chan struct{})
+	onRequest := func(p *fakePeer, index, begin uint32, n int) {
+		go func() {
+			<-releaseC
+			p.sendBlock(index, begin, data)
+		}()
+	}
+	// Peer A is a leecher that is interested in our pieces.
+	peerA := newFakePeerWithExtensions(t, "127.0.0.1", ih, []byte{0x80}, &peerprotocol.ExtensionHandshakeMessage{}, onRequest)
+	defer peerA.Close()
+	// Peer B tells that it is upload only in its second handshake.
+	peerB := newFakePeerWithExtensions(t, "127.0.0.2", ih, []byte{0x80}, &peerprotocol.ExtensionHandshakeMessage{}, onRequest)
+	defer peerB.Close()
+
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{peerA.Addr(), peerB.Addr()} {
+		err = tor.AddPeer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Total == 2 }, "peers")
+	for _, p := range []*fakePeer{peerA, peerB} {
+		hs := <-p.handshakes
+		if hs.UploadOnly != 0 {
+			t.Fatal("torrent must not be upload only before it is completed")
+		}
+	}
+	peerA.send(peerprotocol.Interested, nil)
+	peerB.send(peerprotocol.Interested, nil)
+	peerB.sendExtensionHandshake(peerprotocol.ExtensionHandshakeMessage{UploadOnly: 1})
+	time.Sleep(100 * time.Millisecond)
+	close(releaseC)
+
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download is not completed")
+	}
+	select {
+	case hs := <-peerA.handshakes:
+		if hs.UploadOnly != 1 {
+			t.Fatal("handshake sent after completion must be upload only")
+		}
+	case <-time.After(timeout):
+		t.Fatal("handshake is not sent after completion")
+	}
+	// There is nothing to exchange with the upload only peer while seeding.
+	peers := tor.Peers()
+	if len(peers) != 1 || peers[0].Addr.String() != peerA.Addr() {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+}
+
+// dialHolepunchRelay connects to the torrent listening on port from 127.0.0.2 as a relay that supports ut_holepunch extension.
+// Relay uses a different IP than the peers, otherwise they would not connect to each other
+// because they are already connected to the same IP.
+// It returns the ID of ut_holepunch extension in the handshake of the torrent.
+func dialHolepunchRelay(t *testing.T, port int, ih [20]byte) (*fakePeer, uint8) {
+	var extensions [8]byte
+	extensions[5] |= 0x10 // Extension Protocol (BEP 10)
+	var id [20]byte
+	copy(id[:], "-RELAY-")
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	conn, _, _, _, err := btconn.Dial(addr, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}, timeout, timeout, false, false, extensions, ih, id, nil, nil)
+	if err != nil {
+		t.Skip("cannot connect from 127.0.0.2", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	p := &fakePeer{conn: conn}
+	p.sendExtensionHandshake(peerprotocol.ExtensionHandshakeMessage{
+		M: map[string]uint8{peerprotocol.ExtensionKeyHolepunch: peerprotocol.ExtensionIDHolepunch},
+	})
+	for {
+		var length uint32
+		if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, length)
+		if _, err = io.ReadFull(conn, msg); err != nil {
+			t.Fatal(err)
+		}
+		if length > 2 && msg[0] == byte(peerprotocol.Extension) && msg[1] == peerprotocol.ExtensionIDHandshake {
+			var hs peerprotocol.ExtensionHandshakeMessage
+			if err = bencode.DecodeBytes(msg[2:], &hs); err != nil {
+				t.Fatal(err)
+			}
+			_ = conn.SetDeadline(time.Time{})
+			go func() { _, _ = io.Copy(ioutil.Discard, conn) }()
+			return p, hs.M[peerprotocol.ExtensionKeyHolepunch]
+		}
+	}
+}
+
+func (p *fakePeer) sendHolepunch(id uint8, msg peerprotocol.ExtensionHolepunchMessage) {
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	p.send(peerprotocol.Extension, append([]byte{id}, b...))
+}
+
+func TestHolepunch(t *testing.T) {
+	// Target is a seeder, initiator downloads the torrent from it.
+	// Relay is connected to both of them.
+	_, targetPort, closeTarget := seederTorrent(t)
+	defer closeTarget()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	initiator, err := s.addTorrentStopped(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator.torrent.trackers = nil
+	err = initiator.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var initiatorPort int
+	select {
+	case initiatorPort = <-initiator.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("initiator is not ready")
+	}
+	ih := [20]byte(initiator.InfoHash())
+
+	targetRelay, targetID := dialHolepunchRelay(t, targetPort, ih)
+	defer targetRelay.conn.Close()
+	initiatorRelay, initiatorID := dialHolepunchRelay(t, initiatorPort, ih)
+	defer initiatorRelay.conn.Close()
+
+	// Initiator dials first but NAT in front of the target drops its packets.
+	// A listener that never completes the handshake stands for the address of the target behind NAT.
+	nat, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nat.Close()
+	initiatorRelay.sendHolepunch(initiatorID, peerprotocol.ExtensionHolepunchMessage{
+		Type: peerprotocol.HolepunchConnect,
+		Addr: nat.Addr().(*net.TCPAddr),
+	})
+	conn, err := nat.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if port := conn.RemoteAddr().(*net.TCPAddr).Port; port != initiatorPort {
+		t.Fatalf("holepunch must be dialed from listen port %d, dialed from %d", initiatorPort, port)
+	}
+	// Target dials the initiator and its connection is accepted while the initiator is still dialing.
+	targetRelay.sendHolepunch(targetID, peerprotocol.ExtensionHolepunchMessage{
+		Type: peerprotocol.HolepunchConnect,
+		Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: initiatorPort},
+	})
+	select {
+	case <-initiator.torrent.NotifyComplete():
+	case err = <-initiator.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download is not completed")
+	}
+}
+
+func TestPieceDownloadsPerPeer(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	// Memory for 3 pieces, so some downloads wait for memory.
+	cfg.MaxActivePieceBytes = 3 * piece.BlockSize
+	// Snub timeout
+	cfg.RequestTimeout = time.Second
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const numPieces = 400
+	data := make([]byte, numPieces*piece.BlockSize)
+	for i := range data {
+		data[i] = byte(i / piece.BlockSize)
+	}
+	tor, err := s.addTorrentStopped(bytes.NewReader(newTestTorrent(t, "downloads", data, piece.BlockSize)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+
+	// Peer sends a block in every 30ms, so the download is slow enough to see several pieces being downloaded.
+	// Requests received before pausing are dropped.
+	type request struct{ index, begin, gen uint32 }
+	var gen, paused uint32
+	requestC := make(chan request, 2*numPieces)
+	doneC := make(chan struct{})
+	defer close(doneC)
+	bitfield := bytes.Repeat([]byte{0xff}, numPieces/8)
+	pe := newFakePeer(t, "127.0.0.1", [20]byte(tor.InfoHash()), bitfield, func(p *fakePeer, index, begin uint32, n int) {
+		requestC <- request{index, begin, atomic.LoadUint32(&gen)}
+	})
+	defer pe.Close()
+	go func() {
+		for {
+			select {
+			case req := <-requestC:
+				time.Sleep(30 * time.Millisecond)
+				if atomic.LoadUint32(&paused) == 1 || req.gen != atomic.LoadUint32(&gen) {
+					continue
+				}
+				pe.sendBlock(req.index, req.begin, data[int(req.index)*piece.BlockSize+int(req.begin):][:piece.BlockSize])
+			case <-doneC:
+				return
+			}
+		}
+	}()
+	pause := func() {
+		atomic.StoreUint32(&paused, 1)
+		atomic.AddUint32(&gen, 1)
+	}
+	// Peer must not have more than one download waiting for memory.
+	checkRAM := func() {
+		if st := s.ram.Stats(); st.Waiting > 1 {
+			t.Fatalf("peer has %d downloads waiting for memory", st.Waiting)
+		}
+	}
+
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(pe.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More pieces are downloaded at once after the download speed of the peer is measured.
+	waitStats(t, tor, func(st Stats) bool { return st.Downloads.Total >= 2 }, "several downloads")
+	checkRAM()
+
+	// All downloads of the peer are choked.
+	pause()
+	pe.send(peerprotocol.Choke, nil)
+	stats := waitStats(t, tor, func(st Stats) bool { return st.Downloads.Choked >= 2 && st.Downloads.Choked == st.Downloads.Total }, "choked downloads")
+	checkRAM()
+
+	// Blocks are requested again after unchoke.
+	atomic.StoreUint32(&paused, 0)
+	pe.send(peerprotocol.Unchoke, nil)
+	have := stats.Pieces.Have
+	waitStats(t, tor, func(st Stats) bool { return st.Downloads.Choked == 0 && st.Pieces.Have >= have+2 }, "unchoked downloads")
+	checkRAM()
+
+	// All downloads of the peer are snubbed when it stops sending blocks.
+	pause()
+	waitStats(t, tor, func(st Stats) bool { return st.Downloads.Snubbed >= 1 && st.Downloads.Snubbed == st.Downloads.Total }, "snubbed downloads")
+	checkRAM()
+
+	// Downloads are closed and their memory is released when the peer disconnects.
+	pe.Close()
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Total == 0 && st.Downloads.Total == 0 }, "closed downloads")
+	deadline := time.Now().Add(timeout)
+	for st := s.ram.Stats(); st.Used != 0 || st.Waiting != 0; st = s.ram.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("memory is not released: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
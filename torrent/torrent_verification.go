@@ -1,8 +1,10 @@
 package torrent
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/ProtocolONE/rain/internal/bitfield"
 	"github.com/ProtocolONE/rain/internal/peerprotocol"
 	"github.com/ProtocolONE/rain/internal/verifier"
 )
@@ -49,9 +51,129 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	}
 
 	t.checkCompletion()
+
+	if !t.completeVerifyCommand() {
+		// Torrent was not running. Close the files opened for verification.
+		t.closeData()
+		return
+	}
+
 	t.processQueuedMessages()
 	t.addFixedPeers()
 	t.startAcceptor()
 	t.startAnnouncers()
 	t.startPieceDownloaders()
 }
+
+var errVerifyCancelled = errors.New("verification is cancelled")
+
+type verifyCommand struct {
+	response     chan verifyResponse
+	prevBitfield *bitfield.Bitfield
+	wasRunning   bool
+}
+
+func (t *torrent) handleVerifyCommand(req verifyRequest) {
+	switch {
+	case t.info == nil:
+		req.Response <- verifyResponse{Error: errors.New("torrent metadata is not downloaded yet")}
+		return
+	case t.verifyCmd != nil || t.verifier != nil:
+		req.Response <- verifyResponse{Error: errors.New("torrent is already being verified")}
+		return
+	case t.allocator != nil:
+		req.Response <- verifyResponse{Error: errors.New("torrent files are being allocated")}
+		return
+	case t.status() == Stopping:
+		req.Response <- verifyResponse{Error: errors.New("torrent is stopping")}
+		return
+	}
+
+	t.log.Info("verifying torrent data")
+	t.verifyCmd = &verifyCommand{
+		response:     req.Response,
+		prevBitfield: t.bitfield,
+		wasRunning:   t.status() != Stopped,
+	}
+
+	// Bitfield will be recreated by Verifier.
+	t.mBitfield.Lock()
+	t.bitfield = nil
+	t.mBitfield.Unlock()
+	t.smartBan.Reset()
+
+	if t.completed {
+		t.completed = false
+		t.completeC = make(chan struct{})
+	}
+
+	if !t.verifyCmd.wasRunning {
+		// Open the files and start Verifier without starting the torrent,
+		// so it does not announce to trackers or connect to peers.
+		t.startAllocator()
+		return
+	}
+
+	// Stop all transfers but keep the torrent in running state.
+	t.stopAcceptor()
+	t.stopPeers()
+	t.stopPiecedownloaders()
+	t.stopInfoDownloaders()
+	t.stopWebseedDownloads()
+	t.stopOutgoingHandshakers()
+	t.stopIncomingHandshakers()
+	t.stopPeriodicalAnnouncers()
+	t.resetSpeeds()
+	t.addrList.Reset()
+
+	// Acceptor sends the port again when it is restarted after verification.
+	t.portC = make(chan int, 1)
+
+	// Reopen files so the verifier reads the current data on disk.
+	t.closeData()
+	t.startAllocator()
+}
+
+// completeVerifyCommand sends the result of the verification started by Verify() command.
+// Returns false if the torrent must not continue running after the verification.
+func (t *torrent) completeVerifyCommand() bool {
+	cmd := t.verifyCmd
+	if cmd == nil {
+		return true
+	}
+	t.verifyCmd = nil
+	var res VerifyResult
+	res.Have = t.bitfield.Count()
+	for i := uint32(0); i < t.bitfield.Len(); i++ {
+		had := cmd.prevBitfield != nil && cmd.prevBitfield.Test(i)
+		have := t.bitfield.Test(i)
+		switch {
+		case have && !had:
+			res.Found = append(res.Found, i)
+		case had && !have:
+			res.Lost = append(res.Lost, i)
+		}
+	}
+	t.log.Infof("verification done. have: %d found: %d lost: %d", res.Have, len(res.Found), len(res.Lost))
+	cmd.response <- verifyResponse{Result: res}
+	return cmd.wasRunning
+}
+
+// cancelVerifyCommand is called when torrent is stopped while verification started by Verify() command is in progress.
+func (t *torrent) cancelVerifyCommand(err error) {
+	cmd := t.verifyCmd
+	if cmd == nil {
+		return
+	}
+	t.verifyCmd = nil
+	// Keep the previous bitfield so we don't need to verify again on next start.
+	if t.bitfield == nil {
+		t.mBitfield.Lock()
+		t.bitfield = cmd.prevBitfield
+		t.mBitfield.Unlock()
+	}
+	if err == nil {
+		err = errVerifyCancelled
+	}
+	cmd.response <- verifyResponse{Error: err}
+}
@@ -43,7 +43,8 @@ func (t *torrent) handleWebseedPieceResult(msg *urldownloader.PieceResult) {
 	t.webseedPieceResultC.Suspend()
 
 	pw := piecewriter.New(piece, msg.Downloader, msg.Buffer)
-	go pw.Run(t.pieceWriterResultC, t.doneC)
+	pw.HashBlocks = t.smartBan.Has(piece.Index)
+	go pw.Run(t.session.hashPool, t.pieceWriterResultC, t.doneC)
 
 	if msg.Done {
 		for _, src := range t.webseedSources {
@@ -19,25 +19,38 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 
 	pw.Buffer.Release()
 
+	// Torrent may be re-verified with Verify() while the piece is being written.
+	// Drop the result because the bitfield is recreated from files on disk.
+	if t.bitfield == nil || (t.pieces != nil && &t.pieces[pw.Piece.Index] != pw.Piece) {
+		return
+	}
+
+	if pw.Error != nil {
+		t.stop(pw.Error)
+		return
+	}
+
 	if !pw.HashOK {
 		t.counters.Incr(counters.BytesWasted, int64(len(pw.Buffer.Data)))
-		switch src := pw.Source.(type) {
-		case *peer.Peer:
-			t.log.Errorln("received corrupt piece from peer", src.String())
-			t.closePeer(src)
-			t.bannedPeerIPs[src.IP()] = struct{}{}
-		case *urldownloader.URLDownloader:
-			t.log.Errorln("received corrupt piece from webseed", src.URL)
-			t.disableSource(src.URL, errors.New("corrupt piece"), false)
-		default:
-			panic("unhandled piece source")
+		t.counters.Incr(counters.HashFailures, 1)
+		if pw.MultiSource() {
+			// Cannot tell which source sent the corrupt data yet.
+			// Block checksums are compared with the good copy of the piece after it is downloaded again.
+			t.log.Errorf("received corrupt piece #%d from multiple sources", pw.Piece.Index)
+			t.smartBan.PieceFailed(pw.Piece.Index, pw.BlockChecksums, pw.BlockSources)
+		} else {
+			t.handleCorruptSource(pw.Source, "sent corrupt piece")
+		}
+		// Other downloads of the piece may contain the blocks merged from the corrupt one.
+		if t.piecePicker != nil {
+			t.closePieceDownloadersOf(pw.Piece.Index)
 		}
 		t.startPieceDownloaders()
 		return
 	}
-	if pw.Error != nil {
-		t.stop(pw.Error)
-		return
+
+	for _, src := range t.smartBan.PiecePassed(pw.Piece.Index, pw.BlockChecksums) {
+		t.handleCorruptSource(src, "sent corrupt block")
 	}
 
 	pw.Piece.Done = true
@@ -47,6 +60,7 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	t.mBitfield.Lock()
 	t.bitfield.Set(pw.Piece.Index)
 	t.mBitfield.Unlock()
+	t.session.publishEvent(Event{Type: EventPieceCompleted, TorrentID: t.id, Piece: pw.Piece.Index})
 
 	if t.piecePicker != nil {
 
@@ -60,12 +74,7 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 			}
 		}
 
-		for _, pe := range t.piecePicker.RequestedPeers(pw.Piece.Index) {
-			pd2 := t.pieceDownloaders[pe]
-			t.closePieceDownloader(pd2)
-			pd2.CancelPending()
-			t.startPieceDownloaderFor(pe)
-		}
+		t.closePieceDownloadersOf(pw.Piece.Index)
 	}
 
 	// Tell everyone that we have this piece
@@ -82,9 +91,51 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	completed := t.checkCompletion()
 	if completed {
 		t.log.Info("download completed")
+		// Tell the remaining peers that we are not going to download anymore.
+		for pe := range t.peers {
+			if pe.ExtensionsEnabled {
+				t.sendExtensionHandshake(pe)
+			}
+		}
 		err := t.writeBitfield()
 		if err != nil {
 			t.stop(err)
 		}
 	}
 }
+
+// closePieceDownloadersOf closes the downloads of the piece at index from all peers and starts new downloads.
+func (t *torrent) closePieceDownloadersOf(index uint32) {
+	// Copy the list because closing downloaders modifies it.
+	peers := append([]*peer.Peer(nil), t.piecePicker.RequestedPeers(index)...)
+	for _, pe := range peers {
+		pd := t.pieceDownloaderFor(pe, index)
+		if pd == nil {
+			continue
+		}
+		t.closePieceDownloader(pd)
+		pd.CancelPending()
+		t.startPieceDownloaderFor(pe)
+	}
+}
+
+// handleCorruptSource bans the peer or disables the webseed that sent corrupt data.
+func (t *torrent) handleCorruptSource(source interface{}, reason string) {
+	switch src := source.(type) {
+	case *peer.Peer:
+		t.log.Errorln("peer", src.String(), reason)
+		// Peer may be disconnected while waiting for the piece to be downloaded again.
+		if _, ok := t.peers[src]; ok {
+			t.closePeer(src)
+		}
+		err := t.session.AddBan(src.Addr().IP, reason, t.config.CorruptPieceBanDuration)
+		if err != nil {
+			t.log.Errorln("cannot ban peer:", err)
+		}
+	case *urldownloader.URLDownloader:
+		t.log.Errorln("webseed", src.URL, reason)
+		t.disableSource(src.URL, errors.New(reason), false)
+	default:
+		panic("unhandled piece source")
+	}
+}